@@ -1,6 +1,9 @@
 package v1alpha1
 
 import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -16,17 +19,52 @@ type Resource struct {
 	// Namespace is the source namespace (optional, defaults to ShareKube CRD namespace)
 	// +optional
 	Namespace string `json:"namespace,omitempty"`
+
+	// SkipReferenceRewrite copies the resource without rewriting references to the source namespace
+	// +optional
+	SkipReferenceRewrite bool `json:"skipReferenceRewrite,omitempty"`
+
+	// VolumeCopyMode overrides spec.volumeCopy.mode for a PersistentVolumeClaim (Empty, Snapshot or Clone)
+	// +kubebuilder:validation:Enum=Empty;Snapshot;Clone
+	// +optional
+	VolumeCopyMode string `json:"volumeCopyMode,omitempty"`
+
+	// Wave orders the copy: lower waves are copied first, and a wave is copied once the copies of the previous ones are ready
+	// +optional
+	Wave int32 `json:"wave,omitempty"`
+
+	// ConflictPolicy overrides spec.conflictPolicy for this resource (Fail, Skip, Overwrite or Adopt)
+	// +kubebuilder:validation:Enum=Fail;Skip;Overwrite;Adopt
+	// +optional
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
 }
 
 // TransformationRule defines how resources should be transformed during copying
-// This is a future feature and not implemented in the initial version
 type TransformationRule struct {
 	// Kind is the resource type to apply transformations to
 	Kind string `json:"kind"`
 
+	// Filter is a CEL expression over `object` selecting the copies the rule applies to
+	// (e.g., object.metadata.labels.tier == 'db'). Without a filter the rule applies to every copy of the kind.
+	// +optional
+	Filter string `json:"filter,omitempty"`
+
 	// RemoveFields is a list of fields to remove from the resource
 	// +optional
 	RemoveFields []string `json:"removeFields,omitempty"`
+
+	// Mutations set fields of the resource to values computed by CEL expressions, in order
+	// +optional
+	Mutations []FieldMutation `json:"mutations,omitempty"`
+}
+
+// FieldMutation sets a field to the result of a CEL expression
+type FieldMutation struct {
+	// Path is the dot-separated path of the field to set (e.g., spec.replicas); dots in keys are escaped with a backslash
+	Path string `json:"path"`
+
+	// Expression is a CEL expression over `object` whose result becomes the field's value
+	Expression string `json:"expression"`
 }
 
 // TargetCluster defines a remote Kubernetes cluster
@@ -54,6 +92,295 @@ type AccessControl struct {
 	AllowedTargetNamespaces []string `json:"allowedTargetNamespaces,omitempty"`
 }
 
+// Isolation defines the NetworkPolicies generated in the target namespace
+type Isolation struct {
+	// AllowDNS permits egress to the cluster DNS service (defaults to true)
+	// +optional
+	AllowDNS *bool `json:"allowDNS,omitempty"`
+
+	// AllowedNamespaces lists namespaces whose pods may exchange traffic with the preview
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// AllowedIngressCIDRs lists IP blocks allowed to reach the preview
+	// +optional
+	AllowedIngressCIDRs []string `json:"allowedIngressCIDRs,omitempty"`
+
+	// AllowedEgressCIDRs lists IP blocks the preview may reach
+	// +optional
+	AllowedEgressCIDRs []string `json:"allowedEgressCIDRs,omitempty"`
+}
+
+// NamespaceLimits defines the ResourceQuota and LimitRange provisioned in the target namespace
+type NamespaceLimits struct {
+	// ResourceQuota is the spec of the ResourceQuota created in the target namespace
+	// +optional
+	ResourceQuota *corev1.ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+
+	// LimitRange is the spec of the LimitRange created in the target namespace
+	// +optional
+	LimitRange *corev1.LimitRangeSpec `json:"limitRange,omitempty"`
+
+	// QuotaViolationPolicy decides what happens to workloads that do not fit the quota (Reject or ScaleDown, defaults to Reject)
+	// +kubebuilder:validation:Enum=Reject;ScaleDown
+	// +optional
+	QuotaViolationPolicy string `json:"quotaViolationPolicy,omitempty"`
+}
+
+// ScalingRules defines how copied Deployments, StatefulSets and ReplicaSets are resized for the preview
+type ScalingRules struct {
+	// Replicas sets a fixed replica count, taking precedence over ReplicaFactor
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// ReplicaFactor multiplies the source replica count (e.g., "0.5"), rounding up to at least one replica
+	// +optional
+	ReplicaFactor string `json:"replicaFactor,omitempty"`
+
+	// MaxReplicas caps the replica count after the other rules are applied
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// RequestFactor multiplies container CPU and memory requests (e.g., "0.25")
+	// +optional
+	RequestFactor string `json:"requestFactor,omitempty"`
+
+	// LimitFactor multiplies container CPU and memory limits (e.g., "0.25")
+	// +optional
+	LimitFactor string `json:"limitFactor,omitempty"`
+
+	// MaxCPUPerContainer caps the CPU request and limit of every container
+	// +optional
+	MaxCPUPerContainer *resource.Quantity `json:"maxCPUPerContainer,omitempty"`
+
+	// MaxMemoryPerContainer caps the memory request and limit of every container
+	// +optional
+	MaxMemoryPerContainer *resource.Quantity `json:"maxMemoryPerContainer,omitempty"`
+
+	// HorizontalPodAutoscalers decides what happens to copied HPAs (Clamp or Drop, defaults to Clamp)
+	// +kubebuilder:validation:Enum=Clamp;Drop
+	// +optional
+	HorizontalPodAutoscalers string `json:"horizontalPodAutoscalers,omitempty"`
+}
+
+// ActiveWindow is a recurring period during which the preview's workloads run
+type ActiveWindow struct {
+	// Start is a cron expression marking the beginning of the window (e.g., "0 8 * * 1-5")
+	Start string `json:"start"`
+
+	// End is a cron expression marking the end of the window (e.g., "0 20 * * 1-5")
+	End string `json:"end"`
+}
+
+// Schedule defines when the preview runs and when it hibernates
+type Schedule struct {
+	// Timezone is the IANA time zone the windows are evaluated in (defaults to UTC)
+	// +optional
+	Timezone string `json:"timezone,omitempty"`
+
+	// ActiveWindows lists the periods during which workloads run; outside them the preview hibernates
+	ActiveWindows []ActiveWindow `json:"activeWindows"`
+}
+
+// ReferenceRewrite controls how references to the source namespace are rewritten in copies
+type ReferenceRewrite struct {
+	// Disabled turns off rewriting for all resources
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Patterns lists strings containing $(NAMESPACE) that are rewritten in ConfigMap data (e.g., "db-$(NAMESPACE).internal")
+	// +optional
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// ParentReference identifies a Gateway (or Gateway listener) copied HTTPRoutes attach to
+type ParentReference struct {
+	// Name is the name of the Gateway
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the Gateway (defaults to the target namespace)
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// SectionName selects a listener of the Gateway
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// HostRewrite defines how hostnames of copied Ingresses and HTTPRoutes are rewritten
+type HostRewrite struct {
+	// Template renders each preview hostname with the fields .name (ShareKube name), .namespace (target namespace),
+	// .host (original hostname) and .subdomain (first label of the original hostname), e.g. "{{.name}}.preview.example.com"
+	Template string `json:"template"`
+
+	// TLSSecretName replaces the TLS secret of rewritten Ingress hosts, such as a wildcard certificate for the preview domain
+	// +optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// ParentRefs replaces the parentRefs of copied HTTPRoutes
+	// +optional
+	ParentRefs []ParentReference `json:"parentRefs,omitempty"`
+}
+
+// KRMFunction is a step of the transformation pipeline run on the copied objects before they are written
+type KRMFunction struct {
+	// Name identifies the function in results and conditions
+	Name string `json:"name"`
+
+	// Builtin is the name of an in-process function (e.g., set-labels)
+	// +optional
+	Builtin string `json:"builtin,omitempty"`
+
+	// Exec is the absolute path of an executable allowed by the operator's function allowlist
+	// +optional
+	Exec string `json:"exec,omitempty"`
+
+	// Args are passed to the executable
+	// +optional
+	Args []string `json:"args,omitempty"`
+
+	// Config is passed to the function as its functionConfig
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Config *runtime.RawExtension `json:"config,omitempty"`
+}
+
+// SecretPolicy defines what happens to the data of copied Secrets
+type SecretPolicy struct {
+	// Rules are matched in order, and the first rule matching a Secret and key decides its action.
+	// Keys no rule matches are copied.
+	// +optional
+	Rules []SecretRule `json:"rules,omitempty"`
+}
+
+// SecretRule decides the action for keys of copied Secrets
+type SecretRule struct {
+	// Name limits the rule to the Secret with this source name
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Keys limits the rule to these data keys
+	// +optional
+	Keys []string `json:"keys,omitempty"`
+
+	// Action is Copy, Drop, Random, Placeholder or Template
+	// +kubebuilder:validation:Enum=Copy;Drop;Random;Placeholder;Template
+	Action string `json:"action"`
+
+	// Length is the length of values generated by Random (defaults to 32)
+	// +optional
+	Length int `json:"length,omitempty"`
+
+	// Charset holds the characters Random draws from (defaults to letters and digits)
+	// +optional
+	Charset string `json:"charset,omitempty"`
+
+	// Value replaces the data with Placeholder (defaults to REDACTED)
+	// +optional
+	Value string `json:"value,omitempty"`
+
+	// Template is the Go template the Template action renders the value from. It can use .name (the ShareKube),
+	// .namespace, .secret, .key and .data, the final values of the copy's keys that are not templated
+	// +optional
+	Template string `json:"template,omitempty"`
+}
+
+// ConfigMapPolicy defines how the data of copied ConfigMaps is anonymized
+type ConfigMapPolicy struct {
+	// Rules are applied in order, each to the ConfigMaps and keys it matches
+	// +optional
+	Rules []ConfigMapRule `json:"rules,omitempty"`
+}
+
+// ConfigMapRule anonymizes keys of copied ConfigMaps
+type ConfigMapRule struct {
+	// Name limits the rule to the ConfigMap with this source name
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Keys limits the rule to these data keys
+	// +optional
+	Keys []string `json:"keys,omitempty"`
+
+	// RemoveKeys drops the matching keys
+	// +optional
+	RemoveKeys bool `json:"removeKeys,omitempty"`
+
+	// Replacements replace regular expression matches in the values of the matching keys
+	// +optional
+	Replacements []RegexReplacement `json:"replacements,omitempty"`
+
+	// DocumentEdits edit fields of the JSON or YAML documents stored in the matching keys
+	// +optional
+	DocumentEdits []DocumentEdit `json:"documentEdits,omitempty"`
+}
+
+// RegexReplacement replaces the matches of a regular expression
+type RegexReplacement struct {
+	// Pattern is a regular expression in Go syntax
+	Pattern string `json:"pattern"`
+
+	// Replacement replaces every match and may refer to capture groups (e.g., ${1})
+	Replacement string `json:"replacement"`
+}
+
+// DocumentEdit sets or removes a field of an embedded JSON or YAML document
+type DocumentEdit struct {
+	// Path is the dot-separated path of the field, with list indices as numbers (e.g., users.0.email);
+	// dots in keys are escaped with a backslash
+	Path string `json:"path"`
+
+	// Value is the new value of the field
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Value *runtime.RawExtension `json:"value,omitempty"`
+
+	// Remove deletes the field instead of setting it
+	// +optional
+	Remove bool `json:"remove,omitempty"`
+}
+
+// VolumeCopy defines how copied PersistentVolumeClaims get their data
+type VolumeCopy struct {
+	// Mode is Empty (provision a new empty volume), Snapshot (restore a VolumeSnapshot of the source claim)
+	// or Clone (CSI volume cloning, when source and target namespace are the same). Defaults to Empty.
+	// +kubebuilder:validation:Enum=Empty;Snapshot;Clone
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// VolumeSnapshotClassName is the class of the snapshots taken of source claims (defaults to the cluster default)
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// Hooks are Jobs run in the target namespace at points of the preview's lifecycle
+type Hooks struct {
+	// PreCopy hooks run in order before any resource is copied
+	// +optional
+	PreCopy []Hook `json:"preCopy,omitempty"`
+
+	// PostCopy hooks run in order after the resources are copied, and the preview is Ready once they succeed
+	// +optional
+	PostCopy []Hook `json:"postCopy,omitempty"`
+
+	// PreDelete hooks run in order before the copies are deleted
+	// +optional
+	PreDelete []Hook `json:"preDelete,omitempty"`
+}
+
+// Hook runs a Job built from a template
+type Hook struct {
+	// Name identifies the hook in status and names its Job
+	Name string `json:"name"`
+
+	// Template is the spec of the Job
+	Template batchv1.JobSpec `json:"template"`
+
+	// Timeout is how long the Job may take before the hook fails (e.g., 10m, defaults to 10m)
+	// +optional
+	Timeout string `json:"timeout,omitempty"`
+}
+
 // ShareKubeSpec defines the desired state of ShareKube
 type ShareKubeSpec struct {
 	// TargetNamespace is the destination namespace for copied resources
@@ -62,10 +389,22 @@ type ShareKubeSpec struct {
 	// TTL is the time-to-live for the preview environment (e.g., 1h, 24h, 7d)
 	TTL string `json:"ttl"`
 
+	// NameTemplate renames copies, with $(NAME) replaced by the source name (e.g., "$(NAME)-pr123")
+	// +optional
+	NameTemplate string `json:"nameTemplate,omitempty"`
+
+	// IdleTimeout expires the preview this long after its last recorded activity, or its creation without any, within its TTL (e.g., 2h)
+	// +optional
+	IdleTimeout string `json:"idleTimeout,omitempty"`
+
+	// ReadinessTimeout is how long after its creation the preview may take to become ready before it fails (e.g., 15m)
+	// +optional
+	ReadinessTimeout string `json:"readinessTimeout,omitempty"`
+
 	// Resources is the list of resources to be copied
 	Resources []Resource `json:"resources"`
 
-	// TransformationRules is the list of transformation rules to apply (future feature)
+	// TransformationRules is the list of transformation rules applied to copies, in order
 	// +optional
 	TransformationRules []TransformationRule `json:"transformationRules,omitempty"`
 
@@ -76,8 +415,168 @@ type ShareKubeSpec struct {
 	// AccessControl defines permission settings for this ShareKube resource
 	// +optional
 	AccessControl *AccessControl `json:"accessControl,omitempty"`
+
+	// Isolation generates default-deny NetworkPolicies in the target namespace
+	// +optional
+	Isolation *Isolation `json:"isolation,omitempty"`
+
+	// Limits provisions a ResourceQuota and LimitRange in the target namespace before workloads are copied
+	// +optional
+	Limits *NamespaceLimits `json:"limits,omitempty"`
+
+	// Scaling resizes copied workloads for the preview
+	// +optional
+	Scaling *ScalingRules `json:"scaling,omitempty"`
+
+	// Schedule hibernates the preview outside its active windows
+	// +optional
+	Schedule *Schedule `json:"schedule,omitempty"`
+
+	// ReferenceRewrite configures how references to the source namespace are pointed at the target namespace
+	// +optional
+	ReferenceRewrite *ReferenceRewrite `json:"referenceRewrite,omitempty"`
+
+	// Hosts rewrites the hostnames of copied Ingresses and HTTPRoutes
+	// +optional
+	Hosts *HostRewrite `json:"hosts,omitempty"`
+
+	// ServiceTypePolicy decides whether copied NodePort and LoadBalancer Services become ClusterIP Services
+	// (ConvertToClusterIP or Preserve, defaults to ConvertToClusterIP)
+	// +kubebuilder:validation:Enum=ConvertToClusterIP;Preserve
+	// +optional
+	ServiceTypePolicy string `json:"serviceTypePolicy,omitempty"`
+
+	// Functions is a pipeline of KRM functions that transforms the copied objects before they are written
+	// +optional
+	Functions []KRMFunction `json:"functions,omitempty"`
+
+	// SecretPolicy masks or regenerates the data of copied Secrets
+	// +optional
+	SecretPolicy *SecretPolicy `json:"secretPolicy,omitempty"`
+
+	// ConfigMapPolicy anonymizes the data of copied ConfigMaps
+	// +optional
+	ConfigMapPolicy *ConfigMapPolicy `json:"configMapPolicy,omitempty"`
+
+	// VolumeCopy decides how copied PersistentVolumeClaims get their data
+	// +optional
+	VolumeCopy *VolumeCopy `json:"volumeCopy,omitempty"`
+
+	// Hooks run Jobs in the target namespace before and after copying, and before deletion
+	// +optional
+	Hooks *Hooks `json:"hooks,omitempty"`
+
+	// DriftPolicy decides what happens to copies that were edited in the preview or whose sources changed:
+	// Correct restores them, Report records them in the Drifted condition, Ignore leaves them (defaults to Ignore)
+	// +kubebuilder:validation:Enum=Ignore;Report;Correct
+	// +optional
+	DriftPolicy string `json:"driftPolicy,omitempty"`
+
+	// Atomic deletes the copies when any resource fails to copy, so the preview has all of its copies or none.
+	// The copy is retried with an exponential backoff.
+	// +optional
+	Atomic bool `json:"atomic,omitempty"`
+
+	// ConflictPolicy decides what happens when the name of a copy is taken in the target namespace by an object
+	// the ShareKube does not own: Fail reports the resource as failed, Skip leaves it out, Overwrite replaces the object,
+	// and Adopt labels the object as owned and keeps its content (defaults to Fail).
+	// Copies of other ShareKubes are never overwritten or adopted.
+	// +kubebuilder:validation:Enum=Fail;Skip;Overwrite;Adopt
+	// +optional
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+
+	// NamespaceClaim decides whether the ShareKube holds the target namespace alone (Exclusive, the default)
+	// or shares it with other ShareKubes that claim it as Shared
+	// +kubebuilder:validation:Enum=Exclusive;Shared
+	// +optional
+	NamespaceClaim string `json:"namespaceClaim,omitempty"`
+}
+
+// Endpoint is a URL at which a copied Ingress or HTTPRoute serves the preview
+type Endpoint struct {
+	// Kind is the kind of the resource serving the endpoint
+	Kind string `json:"kind"`
+
+	// Name is the name of the copied resource
+	Name string `json:"name"`
+
+	// URL is the preview URL
+	URL string `json:"url"`
 }
 
+// InventoryEntry identifies an object ShareKube wrote to the target namespace
+type InventoryEntry struct {
+	// APIVersion is the API version of the object
+	APIVersion string `json:"apiVersion"`
+
+	// Kind is the kind of the object
+	Kind string `json:"kind"`
+
+	// Namespace is the namespace of the object
+	Namespace string `json:"namespace"`
+
+	// Name is the name of the object
+	Name string `json:"name"`
+
+	// Adopted marks an object that existed before the ShareKube adopted or overwrote it.
+	// A rolled back atomic copy releases it instead of deleting it.
+	// +optional
+	Adopted bool `json:"adopted,omitempty"`
+}
+
+// ResourceStatus reports the outcome of copying a single resource
+type ResourceStatus struct {
+	// Kind is the type of the resource
+	Kind string `json:"kind"`
+
+	// Name is the name of the resource
+	Name string `json:"name"`
+
+	// Namespace is the source namespace of the resource
+	Namespace string `json:"namespace"`
+
+	// TargetName is the name of the copy when it differs from the source name
+	// +optional
+	TargetName string `json:"targetName,omitempty"`
+
+	// Outcome is the result of the copy (Copied, ScaledDown, Pending, Skipped, Rejected, Failed, RolledBack)
+	Outcome string `json:"outcome"`
+
+	// Message gives details about the outcome
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Snapshot is the VolumeSnapshot a copied PersistentVolumeClaim is restored from
+	// +optional
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// SnapshotReady reports whether the snapshot of the source claim is ready to use
+	// +optional
+	SnapshotReady bool `json:"snapshotReady,omitempty"`
+
+	// Ready reports whether the copy has reached its desired state, e.g. a Deployment has all replicas available
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+}
+
+// Outcomes reported in ResourceStatus.Outcome
+const (
+	// OutcomeCopied means the resource was copied unchanged
+	OutcomeCopied = "Copied"
+	// OutcomeScaledDown means the resource was copied with fewer replicas to fit the quota
+	OutcomeScaledDown = "ScaledDown"
+	// OutcomePending means the copy waits for something to become ready, e.g. a volume snapshot or an earlier wave
+	OutcomePending = "Pending"
+	// OutcomeSkipped means the resource was intentionally left out, e.g. by share annotations or scaling rules
+	OutcomeSkipped = "Skipped"
+	// OutcomeRejected means the resource was not copied because it would violate the quota
+	OutcomeRejected = "Rejected"
+	// OutcomeFailed means copying the resource returned an error
+	OutcomeFailed = "Failed"
+	// OutcomeRolledBack means the copy was deleted because another resource of an atomic preview failed
+	OutcomeRolledBack = "RolledBack"
+)
+
 // ShareKubeStatus defines the observed state of ShareKube
 type ShareKubeStatus struct {
 	// Phase is the current phase of the ShareKube resource
@@ -96,6 +595,22 @@ type ShareKubeStatus struct {
 	// +optional
 	CopiedResources []string `json:"copiedResources,omitempty"`
 
+	// Resources reports the outcome of copying each resource
+	// +optional
+	Resources []ResourceStatus `json:"resources,omitempty"`
+
+	// Endpoints lists the preview URLs served by copied Ingresses and HTTPRoutes
+	// +optional
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
+	// ReadyResources is the number of copies that are ready
+	// +optional
+	ReadyResources int32 `json:"readyResources,omitempty"`
+
+	// ReadyTime is when the preview first became Ready; the readiness timeout no longer applies after it
+	// +optional
+	ReadyTime *metav1.Time `json:"readyTime,omitempty"`
+
 	// Conditions represent the latest available observations of the ShareKube's state
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
@@ -103,13 +618,105 @@ type ShareKubeStatus struct {
 	// DynamicPermissions tracks the permissions created for this ShareKube instance
 	// +optional
 	DynamicPermissions []string `json:"dynamicPermissions,omitempty"`
+
+	// ResourceRequests is the aggregate CPU and memory requested by the copied workloads
+	// +optional
+	ResourceRequests corev1.ResourceList `json:"resourceRequests,omitempty"`
+
+	// Hooks reports the Jobs run by the hooks
+	// +optional
+	Hooks []HookStatus `json:"hooks,omitempty"`
+
+	// TargetNamespace is the namespace the copies were written to, which is cleaned up when spec.targetNamespace changes
+	// +optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// Inventory lists the objects written to the target namespace; those no longer desired are pruned
+	// +optional
+	Inventory []InventoryEntry `json:"inventory,omitempty"`
+
+	// Attempts is the number of atomic copy attempts that were rolled back
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// NextAttemptTime is when a rolled back atomic copy is retried
+	// +optional
+	NextAttemptTime *metav1.Time `json:"nextAttemptTime,omitempty"`
 }
 
+// HookStatus reports the Job of a hook
+type HookStatus struct {
+	// Name is the name of the hook
+	Name string `json:"name"`
+
+	// Stage is the point of the lifecycle the hook runs at (PreCopy, PostCopy, PreDelete)
+	Stage string `json:"stage"`
+
+	// Job is the name of the hook's Job in the target namespace
+	Job string `json:"job"`
+
+	// State is Running, Succeeded or Failed
+	State string `json:"state"`
+
+	// StartTime is when the Job was created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the hook succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Message gives details about a failure
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Logs is the tail of the log of the Job's last pod
+	// +optional
+	Logs string `json:"logs,omitempty"`
+}
+
+// Hook stages reported in HookStatus.Stage
+const (
+	HookStagePreCopy   = "PreCopy"
+	HookStagePostCopy  = "PostCopy"
+	HookStagePreDelete = "PreDelete"
+)
+
+// Hook states reported in HookStatus.State
+const (
+	HookRunning   = "Running"
+	HookSucceeded = "Succeeded"
+	HookFailed    = "Failed"
+)
+
+// Condition types reported in ShareKubeStatus.Conditions
+const (
+	// ConditionQuotaExceeded is True while the preview is held back by a quota
+	ConditionQuotaExceeded = "QuotaExceeded"
+
+	// ConditionTransformed reports the outcome and results of the KRM function pipeline
+	ConditionTransformed = "Transformed"
+
+	// ConditionReady is True once every copy is ready and the postCopy hooks succeeded
+	ConditionReady = "Ready"
+
+	// ConditionDrifted is True while copies differ from their sources, and lists the fields that differ
+	ConditionDrifted = "Drifted"
+
+	// ConditionTargetNamespaceClaimed is True while another ShareKube's claim on the target namespace holds the preview back
+	ConditionTargetNamespaceClaimed = "TargetNamespaceClaimed"
+)
+
+// CreatorAnnotation records the user who created a ShareKube. The admission webhook sets it from the request
+// and rejects values naming anyone else, so per-creator quotas cannot be evaded.
+const CreatorAnnotation = "sharekube.dev/creator"
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Target",type="string",JSONPath=".spec.targetNamespace"
 //+kubebuilder:printcolumn:name="TTL",type="string",JSONPath=".spec.ttl"
 //+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyResources"
 //+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // ShareKube is the Schema for the sharekubes API
@@ -175,6 +782,246 @@ func (in *ShareKubeSpec) DeepCopyInto(out *ShareKubeSpec) {
 		*out = new(AccessControl)
 		(*in).DeepCopyInto(*out)
 	}
+
+	if in.Isolation != nil {
+		in, out := &in.Isolation, &out.Isolation
+		*out = new(Isolation)
+		(*in).DeepCopyInto(*out)
+	}
+
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = new(NamespaceLimits)
+		(*in).DeepCopyInto(*out)
+	}
+
+	if in.Scaling != nil {
+		in, out := &in.Scaling, &out.Scaling
+		*out = new(ScalingRules)
+		(*in).DeepCopyInto(*out)
+	}
+
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(Schedule)
+		(*in).DeepCopyInto(*out)
+	}
+
+	if in.ReferenceRewrite != nil {
+		in, out := &in.ReferenceRewrite, &out.ReferenceRewrite
+		*out = new(ReferenceRewrite)
+		(*in).DeepCopyInto(*out)
+	}
+
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = new(HostRewrite)
+		(*in).DeepCopyInto(*out)
+	}
+
+	if in.Functions != nil {
+		in, out := &in.Functions, &out.Functions
+		*out = make([]KRMFunction, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+
+	if in.SecretPolicy != nil {
+		in, out := &in.SecretPolicy, &out.SecretPolicy
+		*out = new(SecretPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+
+	if in.ConfigMapPolicy != nil {
+		in, out := &in.ConfigMapPolicy, &out.ConfigMapPolicy
+		*out = new(ConfigMapPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+
+	if in.VolumeCopy != nil {
+		in, out := &in.VolumeCopy, &out.VolumeCopy
+		*out = new(VolumeCopy)
+		**out = **in
+	}
+
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = new(Hooks)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopyInto for ConfigMapPolicy
+func (in *ConfigMapPolicy) DeepCopyInto(out *ConfigMapPolicy) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]ConfigMapRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopyInto for ConfigMapRule
+func (in *ConfigMapRule) DeepCopyInto(out *ConfigMapRule) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Replacements != nil {
+		in, out := &in.Replacements, &out.Replacements
+		*out = make([]RegexReplacement, len(*in))
+		copy(*out, *in)
+	}
+	if in.DocumentEdits != nil {
+		in, out := &in.DocumentEdits, &out.DocumentEdits
+		*out = make([]DocumentEdit, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopyInto for DocumentEdit
+func (in *DocumentEdit) DeepCopyInto(out *DocumentEdit) {
+	*out = *in
+	if in.Value != nil {
+		in, out := &in.Value, &out.Value
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopyInto for SecretPolicy
+func (in *SecretPolicy) DeepCopyInto(out *SecretPolicy) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]SecretRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopyInto for SecretRule
+func (in *SecretRule) DeepCopyInto(out *SecretRule) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopyInto for KRMFunction
+func (in *KRMFunction) DeepCopyInto(out *KRMFunction) {
+	*out = *in
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopyInto for HostRewrite
+func (in *HostRewrite) DeepCopyInto(out *HostRewrite) {
+	*out = *in
+	if in.ParentRefs != nil {
+		in, out := &in.ParentRefs, &out.ParentRefs
+		*out = make([]ParentReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopyInto for ReferenceRewrite
+func (in *ReferenceRewrite) DeepCopyInto(out *ReferenceRewrite) {
+	*out = *in
+	if in.Patterns != nil {
+		in, out := &in.Patterns, &out.Patterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopyInto for Schedule
+func (in *Schedule) DeepCopyInto(out *Schedule) {
+	*out = *in
+	if in.ActiveWindows != nil {
+		in, out := &in.ActiveWindows, &out.ActiveWindows
+		*out = make([]ActiveWindow, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopyInto for ScalingRules
+func (in *ScalingRules) DeepCopyInto(out *ScalingRules) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxCPUPerContainer != nil {
+		in, out := &in.MaxCPUPerContainer, &out.MaxCPUPerContainer
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MaxMemoryPerContainer != nil {
+		in, out := &in.MaxMemoryPerContainer, &out.MaxMemoryPerContainer
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopyInto for NamespaceLimits
+func (in *NamespaceLimits) DeepCopyInto(out *NamespaceLimits) {
+	*out = *in
+	if in.ResourceQuota != nil {
+		in, out := &in.ResourceQuota, &out.ResourceQuota
+		*out = (*in).DeepCopy()
+	}
+	if in.LimitRange != nil {
+		in, out := &in.LimitRange, &out.LimitRange
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopyInto for Isolation
+func (in *Isolation) DeepCopyInto(out *Isolation) {
+	*out = *in
+	if in.AllowDNS != nil {
+		in, out := &in.AllowDNS, &out.AllowDNS
+		*out = new(bool)
+		**out = **in
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedIngressCIDRs != nil {
+		in, out := &in.AllowedIngressCIDRs, &out.AllowedIngressCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedEgressCIDRs != nil {
+		in, out := &in.AllowedEgressCIDRs, &out.AllowedEgressCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopyInto for AccessControl
@@ -200,6 +1047,11 @@ func (in *TransformationRule) DeepCopyInto(out *TransformationRule) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Mutations != nil {
+		in, out := &in.Mutations, &out.Mutations
+		*out = make([]FieldMutation, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopyInto for ShareKubeStatus
@@ -216,12 +1068,29 @@ func (in *ShareKubeStatus) DeepCopyInto(out *ShareKubeStatus) {
 		*out = (*in).DeepCopy()
 	}
 
+	if in.ReadyTime != nil {
+		in, out := &in.ReadyTime, &out.ReadyTime
+		*out = (*in).DeepCopy()
+	}
+
 	if in.CopiedResources != nil {
 		in, out := &in.CopiedResources, &out.CopiedResources
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
 
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]ResourceStatus, len(*in))
+		copy(*out, *in)
+	}
+
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]Endpoint, len(*in))
+		copy(*out, *in)
+	}
+
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
@@ -235,6 +1104,75 @@ func (in *ShareKubeStatus) DeepCopyInto(out *ShareKubeStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+
+	if in.ResourceRequests != nil {
+		in, out := &in.ResourceRequests, &out.ResourceRequests
+		*out = (*in).DeepCopy()
+	}
+
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]HookStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+
+	if in.Inventory != nil {
+		in, out := &in.Inventory, &out.Inventory
+		*out = make([]InventoryEntry, len(*in))
+		copy(*out, *in)
+	}
+
+	if in.NextAttemptTime != nil {
+		in, out := &in.NextAttemptTime, &out.NextAttemptTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopyInto for HookStatus
+func (in *HookStatus) DeepCopyInto(out *HookStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopyInto for Hooks
+func (in *Hooks) DeepCopyInto(out *Hooks) {
+	*out = *in
+	if in.PreCopy != nil {
+		in, out := &in.PreCopy, &out.PreCopy
+		*out = make([]Hook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PostCopy != nil {
+		in, out := &in.PostCopy, &out.PostCopy
+		*out = make([]Hook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PreDelete != nil {
+		in, out := &in.PreDelete, &out.PreDelete
+		*out = make([]Hook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopyInto for Hook
+func (in *Hook) DeepCopyInto(out *Hook) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
 }
 
 //+kubebuilder:object:root=true
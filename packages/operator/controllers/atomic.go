@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// Backoff between the attempts of an atomic copy, doubled after each rolled back attempt
+const (
+	atomicRetryBase = 30 * time.Second
+	atomicRetryMax  = 30 * time.Minute
+)
+
+// failedResource returns the first resource that failed to copy, or nil
+func failedResource(statuses []sharekubev1alpha1.ResourceStatus) *sharekubev1alpha1.ResourceStatus {
+	for i := range statuses {
+		if statuses[i].Outcome == sharekubev1alpha1.OutcomeFailed {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// atomicBackoff returns how long to wait before the next attempt after the given number of rolled back attempts
+func atomicBackoff(attempts int32) time.Duration {
+	backoff := atomicRetryBase
+	for i := int32(1); i < attempts; i++ {
+		backoff *= 2
+		if backoff >= atomicRetryMax {
+			return atomicRetryMax
+		}
+	}
+	return backoff
+}
+
+// rollback deletes the copies of an atomic preview after a resource failed to copy, and schedules the next attempt
+func (r *ShareKubeReconciler) rollback(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube, statuses []sharekubev1alpha1.ResourceStatus, failed sharekubev1alpha1.ResourceStatus) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Rolling back atomic copy",
+		"Kind", failed.Kind,
+		"Name", failed.Name,
+		"SourceNamespace", failed.Namespace,
+		"Reason", failed.Message)
+
+	// Objects that existed before the attempt are handed back rather than deleted
+	r.pruneInventory(ctx, sharekube, true)
+
+	for i := range statuses {
+		if statuses[i].Outcome == sharekubev1alpha1.OutcomeCopied || statuses[i].Outcome == sharekubev1alpha1.OutcomeScaledDown {
+			statuses[i].Outcome = sharekubev1alpha1.OutcomeRolledBack
+			statuses[i].Message = fmt.Sprintf("rolled back because %s %s failed to copy", failed.Kind, failed.Name)
+			statuses[i].Ready = false
+		}
+	}
+
+	sharekube.Status.Attempts++
+	backoff := atomicBackoff(sharekube.Status.Attempts)
+	next := metav1.NewTime(time.Now().Add(backoff))
+	sharekube.Status.NextAttemptTime = &next
+
+	sharekube.Status.CopiedResources = nil
+	sharekube.Status.Resources = statuses
+	sharekube.Status.ReadyResources = 0
+	sharekube.Status.Endpoints = nil
+	sharekube.Status.Phase = "Failed"
+	setReadyCondition(sharekube, metav1.ConditionFalse, "RolledBack",
+		fmt.Sprintf("%s %s failed to copy: %s; retrying in %s", failed.Kind, failed.Name, failed.Message, backoff))
+	if err := r.Status().Update(ctx, sharekube); err != nil {
+		logger.Error(err, "Failed to update ShareKube status")
+		return ctrl.Result{}, err
+	}
+	return waitForAttempt(sharekube, backoff), nil
+}
+
+// waitForAttempt requeues at the next attempt, or at the expiration when that comes first
+func waitForAttempt(sharekube *sharekubev1alpha1.ShareKube, wait time.Duration) ctrl.Result {
+	if expiration := waitForExpiration(sharekube); expiration.RequeueAfter > 0 && expiration.RequeueAfter < wait {
+		return expiration
+	}
+	return ctrl.Result{RequeueAfter: wait}
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestAtomicBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int32
+		want     time.Duration
+	}{
+		{attempts: 0, want: 30 * time.Second},
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: 6, want: 16 * time.Minute},
+		{attempts: 7, want: 30 * time.Minute},
+		{attempts: 100, want: 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := atomicBackoff(tt.attempts); got != tt.want {
+			t.Errorf("atomicBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestFailedResource(t *testing.T) {
+	copied := sharekubev1alpha1.ResourceStatus{Kind: "ConfigMap", Name: "settings", Outcome: sharekubev1alpha1.OutcomeCopied}
+	failedSecret := sharekubev1alpha1.ResourceStatus{Kind: "Secret", Name: "creds", Outcome: sharekubev1alpha1.OutcomeFailed}
+	failedDeployment := sharekubev1alpha1.ResourceStatus{Kind: "Deployment", Name: "api", Outcome: sharekubev1alpha1.OutcomeFailed}
+
+	tests := []struct {
+		name     string
+		statuses []sharekubev1alpha1.ResourceStatus
+		want     string
+	}{
+		{name: "first failure is reported", statuses: []sharekubev1alpha1.ResourceStatus{copied, failedSecret, failedDeployment}, want: "creds"},
+		{name: "no failure", statuses: []sharekubev1alpha1.ResourceStatus{copied}},
+		{name: "no resources"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := failedResource(tt.statuses)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("failedResource() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.Name != tt.want {
+				t.Errorf("failedResource() = %+v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	expiration := metav1.NewTime(time.Now().Add(time.Hour))
+	sk := &sharekubev1alpha1.ShareKube{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-preview", Namespace: "dev"},
+		Spec:       sharekubev1alpha1.ShareKubeSpec{TargetNamespace: "preview"},
+		Status: sharekubev1alpha1.ShareKubeStatus{
+			Phase:          "Processing",
+			Attempts:       1,
+			ExpirationTime: &expiration,
+			Inventory: []sharekubev1alpha1.InventoryEntry{
+				{APIVersion: "v1", Kind: "ConfigMap", Namespace: "preview", Name: "settings"},
+			},
+		},
+	}
+	c := newTestClient(t, sk)
+	r := &ShareKubeReconciler{Client: c, DynClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())}
+
+	statuses := []sharekubev1alpha1.ResourceStatus{
+		{Kind: "ConfigMap", Name: "settings", Outcome: sharekubev1alpha1.OutcomeCopied, Ready: true},
+		{Kind: "Deployment", Name: "api", Outcome: sharekubev1alpha1.OutcomeScaledDown},
+		{Kind: "Secret", Name: "creds", Outcome: sharekubev1alpha1.OutcomeFailed, Message: "forbidden"},
+	}
+	result, err := r.rollback(context.Background(), sk, statuses, statuses[2])
+	if err != nil {
+		t.Fatalf("rollback() error = %v", err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("rollback() requeues after %s, want 1m", result.RequeueAfter)
+	}
+
+	if sk.Status.Phase != "Failed" || sk.Status.Attempts != 2 || sk.Status.NextAttemptTime == nil {
+		t.Errorf("status = phase %s, attempts %d, next attempt %v, want Failed, 2 and a next attempt", sk.Status.Phase, sk.Status.Attempts, sk.Status.NextAttemptTime)
+	}
+	if len(sk.Status.Inventory) != 0 {
+		t.Errorf("inventory = %v, want it pruned", sk.Status.Inventory)
+	}
+	for _, status := range sk.Status.Resources[:2] {
+		if status.Outcome != sharekubev1alpha1.OutcomeRolledBack || status.Ready {
+			t.Errorf("%s %s = %s, ready %v, want RolledBack and not ready", status.Kind, status.Name, status.Outcome, status.Ready)
+		}
+	}
+	if sk.Status.Resources[2].Outcome != sharekubev1alpha1.OutcomeFailed {
+		t.Errorf("the failed resource became %s", sk.Status.Resources[2].Outcome)
+	}
+}
+
+func TestWaitForAttempt(t *testing.T) {
+	soon := metav1.NewTime(time.Now().Add(time.Minute))
+	tests := []struct {
+		name       string
+		expiration *metav1.Time
+		wait       time.Duration
+		sooner     bool
+	}{
+		{name: "no expiration", wait: time.Hour},
+		{name: "attempt first", expiration: &soon, wait: 30 * time.Second},
+		{name: "expiration first", expiration: &soon, wait: time.Hour, sooner: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := &sharekubev1alpha1.ShareKube{Status: sharekubev1alpha1.ShareKubeStatus{ExpirationTime: tt.expiration}}
+			result := waitForAttempt(sk, tt.wait)
+			if sooner := result.RequeueAfter < tt.wait; sooner != tt.sooner {
+				t.Errorf("waitForAttempt() requeues after %s, want before %s %v", result.RequeueAfter, tt.wait, tt.sooner)
+			}
+		})
+	}
+}
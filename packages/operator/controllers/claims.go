@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// Annotations on a target namespace recording the ShareKubes that claimed it, and whether they share it
+const (
+	ClaimedByAnnotation = "sharekube.dev/claimed-by"
+	ClaimModeAnnotation = "sharekube.dev/claim-mode"
+)
+
+// Namespace claim modes
+const (
+	ClaimExclusive = "Exclusive"
+	ClaimShared    = "Shared"
+)
+
+// claimRef identifies a ShareKube in a namespace claim
+func claimRef(sharekube *sharekubev1alpha1.ShareKube) string {
+	return sharekube.Namespace + "/" + sharekube.Name
+}
+
+// claimMode returns the claim mode of a ShareKube, defaulting to Exclusive
+func claimMode(sharekube *sharekubev1alpha1.ShareKube) string {
+	if sharekube.Spec.NamespaceClaim == ClaimShared {
+		return ClaimShared
+	}
+	return ClaimExclusive
+}
+
+// claimHolders returns the ShareKubes recorded as holding the claim on a namespace
+func claimHolders(namespace *corev1.Namespace) []string {
+	value := namespace.Annotations[ClaimedByAnnotation]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// setClaimHolders records the holders of the claim on a namespace, removing the claim when none is left.
+// It reports whether the annotations changed.
+func setClaimHolders(namespace *corev1.Namespace, holders []string, mode string) bool {
+	before := namespace.Annotations[ClaimedByAnnotation] + "|" + namespace.Annotations[ClaimModeAnnotation]
+	if len(holders) == 0 {
+		delete(namespace.Annotations, ClaimedByAnnotation)
+		delete(namespace.Annotations, ClaimModeAnnotation)
+	} else {
+		if namespace.Annotations == nil {
+			namespace.Annotations = make(map[string]string)
+		}
+		sort.Strings(holders)
+		namespace.Annotations[ClaimedByAnnotation] = strings.Join(holders, ",")
+		namespace.Annotations[ClaimModeAnnotation] = mode
+	}
+	return before != namespace.Annotations[ClaimedByAnnotation]+"|"+namespace.Annotations[ClaimModeAnnotation]
+}
+
+// claimTargetNamespace claims the target namespace for the ShareKube. A namespace is held by a single ShareKube,
+// or by several ones that all claim it in Shared mode. It returns the other ShareKubes whose claim blocks this one.
+func (r *ShareKubeReconciler) claimTargetNamespace(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube, namespace *corev1.Namespace) ([]string, error) {
+	logger := log.FromContext(ctx)
+	ref := claimRef(sharekube)
+	mode := claimMode(sharekube)
+
+	// Claims of ShareKubes that are gone or moved to another namespace are dropped
+	var others []string
+	for _, holder := range claimHolders(namespace) {
+		if holder == ref {
+			continue
+		}
+		held, err := r.holdsClaim(ctx, holder, namespace.Name)
+		if err != nil {
+			return nil, err
+		}
+		if held {
+			others = append(others, holder)
+		}
+	}
+	if len(others) > 0 && (mode != ClaimShared || namespace.Annotations[ClaimModeAnnotation] != ClaimShared) {
+		return others, nil
+	}
+
+	if !setClaimHolders(namespace, append(others, ref), mode) {
+		return nil, nil
+	}
+	if err := r.Update(ctx, namespace); err != nil {
+		return nil, err
+	}
+	logger.Info("Claimed target namespace", "Namespace", namespace.Name, "Mode", mode)
+	return nil, nil
+}
+
+// holdsClaim reports whether a ShareKube recorded in a claim still targets the namespace
+func (r *ShareKubeReconciler) holdsClaim(ctx context.Context, holder, namespace string) (bool, error) {
+	parts := strings.SplitN(holder, "/", 2)
+	if len(parts) != 2 {
+		return false, nil
+	}
+	sharekube := &sharekubev1alpha1.ShareKube{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: parts[0], Name: parts[1]}, sharekube); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return sharekube.Spec.TargetNamespace == namespace || sharekube.Status.TargetNamespace == namespace, nil
+}
+
+// releaseTargetNamespace removes the ShareKube's claim on its target namespace
+func (r *ShareKubeReconciler) releaseTargetNamespace(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) error {
+	namespace := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: sharekube.Spec.TargetNamespace}, namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	ref := claimRef(sharekube)
+	var remaining []string
+	for _, holder := range claimHolders(namespace) {
+		if holder != ref {
+			remaining = append(remaining, holder)
+		}
+	}
+	if !setClaimHolders(namespace, remaining, namespace.Annotations[ClaimModeAnnotation]) {
+		return nil
+	}
+	if err := r.Update(ctx, namespace); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Released target namespace", "Namespace", namespace.Name)
+	return nil
+}
+
+// claimedCondition builds the TargetNamespaceClaimed condition from the ShareKubes blocking the claim
+func claimedCondition(sharekube *sharekubev1alpha1.ShareKube, holders []string) metav1.Condition {
+	if len(holders) > 0 {
+		return metav1.Condition{
+			Type:               sharekubev1alpha1.ConditionTargetNamespaceClaimed,
+			Status:             metav1.ConditionTrue,
+			Reason:             "ClaimedByAnotherShareKube",
+			Message:            fmt.Sprintf("Target namespace %s is claimed by %s", sharekube.Spec.TargetNamespace, strings.Join(holders, ", ")),
+			ObservedGeneration: sharekube.Generation,
+		}
+	}
+	return metav1.Condition{
+		Type:               sharekubev1alpha1.ConditionTargetNamespaceClaimed,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ClaimHeld",
+		Message:            fmt.Sprintf("This ShareKube holds the %s claim on namespace %s", claimMode(sharekube), sharekube.Spec.TargetNamespace),
+		ObservedGeneration: sharekube.Generation,
+	}
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestSetClaimHolders(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		holders     []string
+		wantChanged bool
+		want        map[string]string
+	}{
+		{
+			name:        "claim sorts the holders",
+			holders:     []string{"dev/b", "dev/a"},
+			wantChanged: true,
+			want:        map[string]string{ClaimedByAnnotation: "dev/a,dev/b", ClaimModeAnnotation: ClaimShared},
+		},
+		{
+			name:        "same claim is unchanged",
+			annotations: map[string]string{ClaimedByAnnotation: "dev/a,dev/b", ClaimModeAnnotation: ClaimShared},
+			holders:     []string{"dev/a", "dev/b"},
+			want:        map[string]string{ClaimedByAnnotation: "dev/a,dev/b", ClaimModeAnnotation: ClaimShared},
+		},
+		{
+			name:        "release removes the claim",
+			annotations: map[string]string{ClaimedByAnnotation: "dev/a,dev/b", ClaimModeAnnotation: ClaimShared},
+			wantChanged: true,
+			want:        map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if changed := setClaimHolders(namespace, tt.holders, ClaimShared); changed != tt.wantChanged {
+				t.Errorf("setClaimHolders() = %v, want %v", changed, tt.wantChanged)
+			}
+			if len(namespace.Annotations) != len(tt.want) {
+				t.Fatalf("annotations = %v, want %v", namespace.Annotations, tt.want)
+			}
+			for key, value := range tt.want {
+				if namespace.Annotations[key] != value {
+					t.Errorf("annotation %s = %q, want %q", key, namespace.Annotations[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestClaimTargetNamespace(t *testing.T) {
+	preview := func(name, mode, target string) *sharekubev1alpha1.ShareKube {
+		return &sharekubev1alpha1.ShareKube{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "dev"},
+			Spec:       sharekubev1alpha1.ShareKubeSpec{TargetNamespace: target, NamespaceClaim: mode},
+		}
+	}
+	claimed := func(holders, mode string) map[string]string {
+		return map[string]string{ClaimedByAnnotation: holders, ClaimModeAnnotation: mode}
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		annotations map[string]string
+		existing    []client.Object
+		blockedBy   []string
+		wantHolders string
+	}{
+		{
+			name:        "unclaimed namespace",
+			wantHolders: "dev/new",
+		},
+		{
+			name:        "already held",
+			annotations: claimed("dev/new", ClaimExclusive),
+			wantHolders: "dev/new",
+		},
+		{
+			name:        "held exclusively by another preview",
+			annotations: claimed("dev/other", ClaimExclusive),
+			existing:    []client.Object{preview("other", "", "preview")},
+			blockedBy:   []string{"dev/other"},
+			wantHolders: "dev/other",
+		},
+		{
+			name:        "shared claim does not join an exclusive one",
+			mode:        ClaimShared,
+			annotations: claimed("dev/other", ClaimExclusive),
+			existing:    []client.Object{preview("other", "", "preview")},
+			blockedBy:   []string{"dev/other"},
+			wantHolders: "dev/other",
+		},
+		{
+			name:        "exclusive claim does not join a shared one",
+			annotations: claimed("dev/other", ClaimShared),
+			existing:    []client.Object{preview("other", ClaimShared, "preview")},
+			blockedBy:   []string{"dev/other"},
+			wantHolders: "dev/other",
+		},
+		{
+			name:        "shared claims join",
+			mode:        ClaimShared,
+			annotations: claimed("dev/other", ClaimShared),
+			existing:    []client.Object{preview("other", ClaimShared, "preview")},
+			wantHolders: "dev/new,dev/other",
+		},
+		{
+			name:        "claim of a deleted preview is dropped",
+			annotations: claimed("dev/gone", ClaimExclusive),
+			wantHolders: "dev/new",
+		},
+		{
+			name:        "claim of a preview targeting another namespace is dropped",
+			annotations: claimed("dev/other", ClaimExclusive),
+			existing:    []client.Object{preview("other", "", "staging")},
+			wantHolders: "dev/new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview", Annotations: tt.annotations}}
+			c := newTestClient(t, append(tt.existing, namespace.DeepCopy())...)
+			r := &ShareKubeReconciler{Client: c}
+
+			blockedBy, err := r.claimTargetNamespace(context.Background(), preview("new", tt.mode, "preview"), namespace)
+			if err != nil {
+				t.Fatalf("claimTargetNamespace() error = %v", err)
+			}
+			if !reflect.DeepEqual(blockedBy, tt.blockedBy) {
+				t.Errorf("claimTargetNamespace() = %v, want %v", blockedBy, tt.blockedBy)
+			}
+
+			stored := &corev1.Namespace{}
+			if err := c.Get(context.Background(), types.NamespacedName{Name: "preview"}, stored); err != nil {
+				t.Fatal(err)
+			}
+			if got := stored.Annotations[ClaimedByAnnotation]; got != tt.wantHolders {
+				t.Errorf("claimed-by = %q, want %q", got, tt.wantHolders)
+			}
+		})
+	}
+}
+
+func TestReleaseTargetNamespace(t *testing.T) {
+	tests := []struct {
+		name        string
+		released    []string
+		wantHolders string
+	}{
+		{name: "one holder remains", released: []string{"a"}, wantHolders: "dev/b"},
+		{name: "last holder removes the claim", released: []string{"a", "b"}},
+		{name: "unknown holder is ignored", released: []string{"c"}, wantHolders: "dev/a,dev/b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        "preview",
+				Annotations: map[string]string{ClaimedByAnnotation: "dev/a,dev/b", ClaimModeAnnotation: ClaimShared},
+			}}
+			c := newTestClient(t, namespace)
+			r := &ShareKubeReconciler{Client: c}
+
+			for _, name := range tt.released {
+				sk := &sharekubev1alpha1.ShareKube{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "dev"},
+					Spec:       sharekubev1alpha1.ShareKubeSpec{TargetNamespace: "preview"},
+				}
+				if err := r.releaseTargetNamespace(context.Background(), sk); err != nil {
+					t.Fatalf("releaseTargetNamespace() error = %v", err)
+				}
+			}
+
+			stored := &corev1.Namespace{}
+			if err := c.Get(context.Background(), types.NamespacedName{Name: "preview"}, stored); err != nil {
+				t.Fatal(err)
+			}
+			if got := stored.Annotations[ClaimedByAnnotation]; got != tt.wantHolders {
+				t.Errorf("claimed-by = %q, want %q", got, tt.wantHolders)
+			}
+			if tt.wantHolders == "" && len(stored.Annotations) != 0 {
+				t.Errorf("annotations = %v, want the claim removed", stored.Annotations)
+			}
+		})
+	}
+}
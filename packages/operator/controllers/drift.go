@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+// maxDriftFields bounds the fields listed per copy in the Drifted condition
+const maxDriftFields = 10
+
+// driftedCondition builds the Drifted condition from the drifted copies found while copying
+func driftedCondition(sharekube *sharekubev1alpha1.ShareKube, drift []resources.Drift) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               sharekubev1alpha1.ConditionDrifted,
+		Status:             metav1.ConditionFalse,
+		Reason:             "InSync",
+		Message:            "All copies match their sources",
+		ObservedGeneration: sharekube.Generation,
+	}
+	if len(drift) == 0 {
+		return condition
+	}
+
+	descriptions := make([]string, 0, len(drift))
+	for _, d := range drift {
+		fields := d.Fields
+		if len(fields) > maxDriftFields {
+			fields = append(fields[:maxDriftFields:maxDriftFields], fmt.Sprintf("and %d more", len(d.Fields)-maxDriftFields))
+		}
+		description := fmt.Sprintf("%s %s: %s", d.Kind, d.Name, strings.Join(fields, ", "))
+		if d.SourceChanged {
+			description += " (source changed)"
+		}
+		descriptions = append(descriptions, description)
+	}
+
+	if sharekube.Spec.DriftPolicy == resources.DriftCorrect {
+		condition.Reason = "DriftCorrected"
+		condition.Message = "Restored " + strings.Join(descriptions, "; ")
+		return condition
+	}
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "DriftDetected"
+	condition.Message = strings.Join(descriptions, "; ")
+	return condition
+}
+
+// recordDrift sets the Drifted condition, or removes it when drift is ignored
+func recordDrift(sharekube *sharekubev1alpha1.ShareKube, drift []resources.Drift) {
+	if sharekube.Spec.DriftPolicy == "" || sharekube.Spec.DriftPolicy == resources.DriftIgnore {
+		meta.RemoveStatusCondition(&sharekube.Status.Conditions, sharekubev1alpha1.ConditionDrifted)
+		return
+	}
+	meta.SetStatusCondition(&sharekube.Status.Conditions, driftedCondition(sharekube, drift))
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+// scheduleLookback is how far back the previous window boundaries are searched; it covers weekly schedules
+const scheduleLookback = 8 * 24 * time.Hour
+
+// scheduleState reports whether the schedule is active at now and when it next changes
+func scheduleState(schedule *sharekubev1alpha1.Schedule, now time.Time) (bool, time.Time, error) {
+	location := time.UTC
+	if schedule.Timezone != "" {
+		loc, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid schedule timezone %q: %w", schedule.Timezone, err)
+		}
+		location = loc
+	}
+	now = now.In(location)
+
+	active := false
+	var next time.Time
+	for _, window := range schedule.ActiveWindows {
+		start, err := cron.ParseStandard(window.Start)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid schedule start %q: %w", window.Start, err)
+		}
+		end, err := cron.ParseStandard(window.End)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid schedule end %q: %w", window.End, err)
+		}
+
+		// The window is open when it started more recently than it ended
+		lastStart := lastOccurrence(start, now)
+		lastEnd := lastOccurrence(end, now)
+		if !lastStart.IsZero() && lastStart.After(lastEnd) {
+			active = true
+		}
+
+		for _, t := range []time.Time{start.Next(now), end.Next(now)} {
+			if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+
+	return active, next, nil
+}
+
+// lastOccurrence returns the most recent activation of the schedule at or before now
+func lastOccurrence(schedule cron.Schedule, now time.Time) time.Time {
+	var last time.Time
+	for t := schedule.Next(now.Add(-scheduleLookback)); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		last = t
+	}
+	return last
+}
+
+// hibernate scales copied Deployments and StatefulSets to zero and suspends copied CronJobs
+func (r *ShareKubeReconciler) hibernate(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) error {
+	logger := log.FromContext(ctx)
+	opts := []client.ListOption{
+		client.InNamespace(sharekube.Spec.TargetNamespace),
+		client.MatchingLabels(ownerLabels(sharekube)),
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deployments, opts...); err != nil {
+		return fmt.Errorf("failed to list Deployments: %w", err)
+	}
+	for i := range deployments.Items {
+		deploy := &deployments.Items[i]
+		if _, ok := deploy.Annotations[resources.HibernatedReplicasAnnotation]; ok {
+			continue
+		}
+		patch := client.MergeFrom(deploy.DeepCopy())
+		metav1.SetMetaDataAnnotation(&deploy.ObjectMeta, resources.HibernatedReplicasAnnotation,
+			strconv.Itoa(int(resources.ReplicasOrDefault(deploy.Spec.Replicas))))
+		deploy.Spec.Replicas = new(int32)
+		if err := r.Patch(ctx, deploy, patch); err != nil {
+			return fmt.Errorf("failed to hibernate Deployment %s: %w", deploy.Name, err)
+		}
+		logger.Info("Hibernated Deployment", "Name", deploy.Name)
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := r.List(ctx, statefulSets, opts...); err != nil {
+		return fmt.Errorf("failed to list StatefulSets: %w", err)
+	}
+	for i := range statefulSets.Items {
+		sts := &statefulSets.Items[i]
+		if _, ok := sts.Annotations[resources.HibernatedReplicasAnnotation]; ok {
+			continue
+		}
+		patch := client.MergeFrom(sts.DeepCopy())
+		metav1.SetMetaDataAnnotation(&sts.ObjectMeta, resources.HibernatedReplicasAnnotation,
+			strconv.Itoa(int(resources.ReplicasOrDefault(sts.Spec.Replicas))))
+		sts.Spec.Replicas = new(int32)
+		if err := r.Patch(ctx, sts, patch); err != nil {
+			return fmt.Errorf("failed to hibernate StatefulSet %s: %w", sts.Name, err)
+		}
+		logger.Info("Hibernated StatefulSet", "Name", sts.Name)
+	}
+
+	cronJobs := &batchv1.CronJobList{}
+	if err := r.List(ctx, cronJobs, opts...); err != nil {
+		return fmt.Errorf("failed to list CronJobs: %w", err)
+	}
+	for i := range cronJobs.Items {
+		cronJob := &cronJobs.Items[i]
+		if _, ok := cronJob.Annotations[resources.HibernatedSuspendAnnotation]; ok {
+			continue
+		}
+		suspended := cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend
+		patch := client.MergeFrom(cronJob.DeepCopy())
+		metav1.SetMetaDataAnnotation(&cronJob.ObjectMeta, resources.HibernatedSuspendAnnotation, strconv.FormatBool(suspended))
+		cronJob.Spec.Suspend = &[]bool{true}[0]
+		if err := r.Patch(ctx, cronJob, patch); err != nil {
+			return fmt.Errorf("failed to suspend CronJob %s: %w", cronJob.Name, err)
+		}
+		logger.Info("Suspended CronJob", "Name", cronJob.Name)
+	}
+
+	return nil
+}
+
+// wake restores the replica counts and suspend flags remembered by hibernate
+func (r *ShareKubeReconciler) wake(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) error {
+	logger := log.FromContext(ctx)
+	opts := []client.ListOption{
+		client.InNamespace(sharekube.Spec.TargetNamespace),
+		client.MatchingLabels(ownerLabels(sharekube)),
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deployments, opts...); err != nil {
+		return fmt.Errorf("failed to list Deployments: %w", err)
+	}
+	for i := range deployments.Items {
+		deploy := &deployments.Items[i]
+		value, ok := deploy.Annotations[resources.HibernatedReplicasAnnotation]
+		if !ok {
+			continue
+		}
+		replicas, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation on Deployment %s: %w", resources.HibernatedReplicasAnnotation, deploy.Name, err)
+		}
+		patch := client.MergeFrom(deploy.DeepCopy())
+		delete(deploy.Annotations, resources.HibernatedReplicasAnnotation)
+		deploy.Spec.Replicas = &[]int32{int32(replicas)}[0]
+		if err := r.Patch(ctx, deploy, patch); err != nil {
+			return fmt.Errorf("failed to wake Deployment %s: %w", deploy.Name, err)
+		}
+		logger.Info("Woke Deployment", "Name", deploy.Name, "Replicas", replicas)
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := r.List(ctx, statefulSets, opts...); err != nil {
+		return fmt.Errorf("failed to list StatefulSets: %w", err)
+	}
+	for i := range statefulSets.Items {
+		sts := &statefulSets.Items[i]
+		value, ok := sts.Annotations[resources.HibernatedReplicasAnnotation]
+		if !ok {
+			continue
+		}
+		replicas, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation on StatefulSet %s: %w", resources.HibernatedReplicasAnnotation, sts.Name, err)
+		}
+		patch := client.MergeFrom(sts.DeepCopy())
+		delete(sts.Annotations, resources.HibernatedReplicasAnnotation)
+		sts.Spec.Replicas = &[]int32{int32(replicas)}[0]
+		if err := r.Patch(ctx, sts, patch); err != nil {
+			return fmt.Errorf("failed to wake StatefulSet %s: %w", sts.Name, err)
+		}
+		logger.Info("Woke StatefulSet", "Name", sts.Name, "Replicas", replicas)
+	}
+
+	cronJobs := &batchv1.CronJobList{}
+	if err := r.List(ctx, cronJobs, opts...); err != nil {
+		return fmt.Errorf("failed to list CronJobs: %w", err)
+	}
+	for i := range cronJobs.Items {
+		cronJob := &cronJobs.Items[i]
+		value, ok := cronJob.Annotations[resources.HibernatedSuspendAnnotation]
+		if !ok {
+			continue
+		}
+		suspended, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation on CronJob %s: %w", resources.HibernatedSuspendAnnotation, cronJob.Name, err)
+		}
+		patch := client.MergeFrom(cronJob.DeepCopy())
+		delete(cronJob.Annotations, resources.HibernatedSuspendAnnotation)
+		cronJob.Spec.Suspend = &suspended
+		if err := r.Patch(ctx, cronJob, patch); err != nil {
+			return fmt.Errorf("failed to resume CronJob %s: %w", cronJob.Name, err)
+		}
+		logger.Info("Resumed CronJob", "Name", cronJob.Name)
+	}
+
+	return nil
+}
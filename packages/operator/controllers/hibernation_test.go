@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestScheduleState(t *testing.T) {
+	officeHours := []sharekubev1alpha1.ActiveWindow{{Start: "0 9 * * 1-5", End: "0 18 * * 1-5"}}
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name     string
+		schedule sharekubev1alpha1.Schedule
+		now      string
+		active   bool
+		next     string
+		wantErr  bool
+	}{
+		{
+			name:     "during office hours",
+			schedule: sharekubev1alpha1.Schedule{ActiveWindows: officeHours},
+			now:      "2026-10-19T10:00:00Z",
+			active:   true,
+			next:     "2026-10-19T18:00:00Z",
+		},
+		{
+			name:     "at the start of the window",
+			schedule: sharekubev1alpha1.Schedule{ActiveWindows: officeHours},
+			now:      "2026-10-19T09:00:00Z",
+			active:   true,
+			next:     "2026-10-19T18:00:00Z",
+		},
+		{
+			name:     "in the evening",
+			schedule: sharekubev1alpha1.Schedule{ActiveWindows: officeHours},
+			now:      "2026-10-19T20:00:00Z",
+			next:     "2026-10-20T09:00:00Z",
+		},
+		{
+			name:     "over the weekend",
+			schedule: sharekubev1alpha1.Schedule{ActiveWindows: officeHours},
+			now:      "2026-10-24T12:00:00Z",
+			next:     "2026-10-26T09:00:00Z",
+		},
+		{
+			name:     "in another timezone",
+			schedule: sharekubev1alpha1.Schedule{Timezone: "Asia/Tokyo", ActiveWindows: officeHours},
+			now:      "2026-10-19T10:00:00Z",
+			next:     "2026-10-20T00:00:00Z",
+		},
+		{
+			name: "the earliest change of several windows",
+			schedule: sharekubev1alpha1.Schedule{ActiveWindows: []sharekubev1alpha1.ActiveWindow{
+				officeHours[0],
+				{Start: "0 12 * * *", End: "0 13 * * *"},
+			}},
+			now:    "2026-10-19T10:00:00Z",
+			active: true,
+			next:   "2026-10-19T12:00:00Z",
+		},
+		{
+			name:     "invalid timezone",
+			schedule: sharekubev1alpha1.Schedule{Timezone: "Mars/Olympus", ActiveWindows: officeHours},
+			now:      "2026-10-19T10:00:00Z",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid window",
+			schedule: sharekubev1alpha1.Schedule{ActiveWindows: []sharekubev1alpha1.ActiveWindow{{Start: "at nine", End: "0 18 * * *"}}},
+			now:      "2026-10-19T10:00:00Z",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, next, err := scheduleState(&tt.schedule, at(tt.now))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scheduleState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if active != tt.active {
+				t.Errorf("scheduleState() active = %v, want %v", active, tt.active)
+			}
+			if !next.Equal(at(tt.next)) {
+				t.Errorf("scheduleState() next = %s, want %s", next, tt.next)
+			}
+		})
+	}
+}
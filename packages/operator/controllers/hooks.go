@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+const (
+	// hookPollInterval is how often running hook Jobs are checked
+	hookPollInterval = 10 * time.Second
+
+	// defaultHookTimeout bounds hooks without a timeout
+	defaultHookTimeout = 10 * time.Minute
+
+	// hookLogTailLines and hookLogLimitBytes bound the log excerpt recorded for a finished hook
+	hookLogTailLines  = 20
+	hookLogLimitBytes = 2048
+
+	// hookStageLabel marks hook Jobs with the stage they run at
+	hookStageLabel = "sharekube.dev/hook-stage"
+)
+
+// hookJobName returns the name of a hook's Job, which must fit the 63 characters of the job-name pod label
+func hookJobName(sharekube *sharekubev1alpha1.ShareKube, stage, hook string) string {
+	name := strings.ToLower(fmt.Sprintf("sharekube-%s-%s-%s", sharekube.Name, stage, hook))
+	if len(name) <= 63 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return fmt.Sprintf("%s-%x", name[:52], sum[:5])
+}
+
+// hooksFor returns the hooks of a stage
+func hooksFor(sharekube *sharekubev1alpha1.ShareKube, stage string) []sharekubev1alpha1.Hook {
+	if sharekube.Spec.Hooks == nil {
+		return nil
+	}
+	switch stage {
+	case sharekubev1alpha1.HookStagePreCopy:
+		return sharekube.Spec.Hooks.PreCopy
+	case sharekubev1alpha1.HookStagePostCopy:
+		return sharekube.Spec.Hooks.PostCopy
+	case sharekubev1alpha1.HookStagePreDelete:
+		return sharekube.Spec.Hooks.PreDelete
+	}
+	return nil
+}
+
+// hookStatus returns the status entry of a hook, adding it if the hook has not run yet
+func hookStatus(sharekube *sharekubev1alpha1.ShareKube, stage, name string) *sharekubev1alpha1.HookStatus {
+	for i := range sharekube.Status.Hooks {
+		if sharekube.Status.Hooks[i].Stage == stage && sharekube.Status.Hooks[i].Name == name {
+			return &sharekube.Status.Hooks[i]
+		}
+	}
+	sharekube.Status.Hooks = append(sharekube.Status.Hooks, sharekubev1alpha1.HookStatus{
+		Name:  name,
+		Stage: stage,
+		Job:   hookJobName(sharekube, stage, name),
+	})
+	return &sharekube.Status.Hooks[len(sharekube.Status.Hooks)-1]
+}
+
+// runHooks runs the hooks of a stage one after another and returns the state of the stage.
+// The results are recorded in the ShareKube's status, which the caller persists.
+func (r *ShareKubeReconciler) runHooks(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube, stage string) (string, error) {
+	for _, hook := range hooksFor(sharekube, stage) {
+		status := hookStatus(sharekube, stage, hook.Name)
+		switch status.State {
+		case sharekubev1alpha1.HookSucceeded:
+			continue
+		case sharekubev1alpha1.HookFailed:
+			return sharekubev1alpha1.HookFailed, nil
+		}
+
+		if err := r.runHook(ctx, sharekube, hook, status); err != nil {
+			return "", err
+		}
+		if status.State != sharekubev1alpha1.HookSucceeded {
+			return status.State, nil
+		}
+	}
+	return sharekubev1alpha1.HookSucceeded, nil
+}
+
+// runHook starts the Job of a hook, or updates the hook's status from its Job
+func (r *ShareKubeReconciler) runHook(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube, hook sharekubev1alpha1.Hook, status *sharekubev1alpha1.HookStatus) error {
+	logger := log.FromContext(ctx)
+
+	timeout := defaultHookTimeout
+	if hook.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(hook.Timeout); err != nil {
+			r.finishHook(ctx, sharekube, status, nil, sharekubev1alpha1.HookFailed, fmt.Sprintf("invalid timeout %q: %v", hook.Timeout, err))
+			return nil
+		}
+	}
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: sharekube.Spec.TargetNamespace, Name: status.Job}, job)
+	if apierrors.IsNotFound(err) {
+		if status.StartTime != nil {
+			r.finishHook(ctx, sharekube, status, nil, sharekubev1alpha1.HookFailed, "Job was deleted before it finished")
+			return nil
+		}
+
+		job = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      status.Job,
+				Namespace: sharekube.Spec.TargetNamespace,
+				Labels:    mergeLabels(ownerLabels(sharekube), map[string]string{hookStageLabel: status.Stage}),
+			},
+			Spec: *hook.Template.DeepCopy(),
+		}
+		if job.Spec.Template.Spec.RestartPolicy == "" {
+			job.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+		}
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create hook Job", "Hook", hook.Name, "Stage", status.Stage)
+			return err
+		}
+
+		now := metav1.Now()
+		status.State = sharekubev1alpha1.HookRunning
+		status.StartTime = &now
+		logger.Info("Started hook", "Hook", hook.Name, "Stage", status.Stage, "Job", job.Name)
+		return nil
+	}
+	if err != nil {
+		logger.Error(err, "Failed to get hook Job", "Hook", hook.Name, "Stage", status.Stage)
+		return err
+	}
+
+	if status.StartTime == nil {
+		status.StartTime = job.CreationTimestamp.DeepCopy()
+	}
+	status.State = sharekubev1alpha1.HookRunning
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			r.finishHook(ctx, sharekube, status, job, sharekubev1alpha1.HookSucceeded, "")
+			return nil
+		case batchv1.JobFailed:
+			r.finishHook(ctx, sharekube, status, job, sharekubev1alpha1.HookFailed, fmt.Sprintf("%s: %s", condition.Reason, condition.Message))
+			return nil
+		}
+	}
+
+	if time.Since(status.StartTime.Time) > timeout {
+		message := fmt.Sprintf("timed out after %s", timeout)
+		r.finishHook(ctx, sharekube, status, job, sharekubev1alpha1.HookFailed, message)
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete timed out hook Job", "Job", job.Name)
+		}
+	}
+	return nil
+}
+
+// finishHook records the final state of a hook and the tail of its Job's log
+func (r *ShareKubeReconciler) finishHook(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube, status *sharekubev1alpha1.HookStatus, job *batchv1.Job, state, message string) {
+	now := metav1.Now()
+	status.State = state
+	status.CompletionTime = &now
+	status.Message = message
+	if job != nil {
+		status.Logs = r.hookLogs(ctx, job)
+	}
+	log.FromContext(ctx).Info("Hook finished", "Hook", status.Name, "Stage", status.Stage, "State", state, "Message", message)
+}
+
+// hookLogs returns the tail of the log of the Job's most recent pod, or an empty string if it is not available
+func (r *ShareKubeReconciler) hookLogs(ctx context.Context, job *batchv1.Job) string {
+	logger := log.FromContext(ctx)
+
+	clientset, err := kubernetes.NewForConfig(r.Config)
+	if err != nil {
+		logger.Error(err, "Failed to create Kubernetes clientset")
+		return ""
+	}
+	pods, err := clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + job.Name})
+	if err != nil || len(pods.Items) == 0 {
+		return ""
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[j].CreationTimestamp.Before(&pods.Items[i].CreationTimestamp)
+	})
+
+	tailLines, limitBytes := int64(hookLogTailLines), int64(hookLogLimitBytes)
+	logs, err := clientset.CoreV1().Pods(job.Namespace).GetLogs(pods.Items[0].Name, &corev1.PodLogOptions{
+		TailLines:  &tailLines,
+		LimitBytes: &limitBytes,
+	}).DoRaw(ctx)
+	if err != nil {
+		logger.Info("Could not read hook logs", "Job", job.Name, "Error", err.Error())
+		return ""
+	}
+	return string(logs)
+}
+
+// waitForHooks returns the result to requeue with while a stage is not done
+func waitForHooks(sharekube *sharekubev1alpha1.ShareKube, state string) ctrl.Result {
+	if state == sharekubev1alpha1.HookFailed {
+		return waitForExpiration(sharekube)
+	}
+	return ctrl.Result{RequeueAfter: hookPollInterval}
+}
+
+// runPreDeleteHooks runs the preDelete hooks while the copies still exist.
+// It returns false with the result to requeue with while a hook is running; failed hooks do not block the cleanup.
+func (r *ShareKubeReconciler) runPreDeleteHooks(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) (bool, ctrl.Result) {
+	logger := log.FromContext(ctx)
+
+	// Previews held back by a quota have nothing to clean up after
+	if len(hooksFor(sharekube, sharekubev1alpha1.HookStagePreDelete)) == 0 || sharekube.Status.Phase == "Pending" {
+		return true, ctrl.Result{}
+	}
+
+	state, err := r.runHooks(ctx, sharekube, sharekubev1alpha1.HookStagePreDelete)
+	if err != nil {
+		logger.Error(err, "Failed to run preDelete hooks, continuing with cleanup")
+		return true, ctrl.Result{}
+	}
+	if state != sharekubev1alpha1.HookRunning {
+		return true, ctrl.Result{}
+	}
+
+	if err := r.Status().Update(ctx, sharekube); err != nil {
+		logger.Error(err, "Failed to update ShareKube status")
+	}
+	return false, ctrl.Result{RequeueAfter: hookPollInterval}
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestHookJobName(t *testing.T) {
+	long := strings.Repeat("a", 60)
+
+	tests := []struct {
+		name    string
+		share   string
+		hook    string
+		want    string
+		differs string
+	}{
+		{name: "short name is lowercased", share: "PR-42", hook: "seed", want: "sharekube-pr-42-precopy-seed"},
+		{name: "long name is truncated", share: long, hook: "seed"},
+		{name: "long names stay distinct", share: long, hook: "seed", differs: "migrate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sharekube := &sharekubev1alpha1.ShareKube{ObjectMeta: metav1.ObjectMeta{Name: tt.share}}
+			got := hookJobName(sharekube, "preCopy", tt.hook)
+			if tt.want != "" && got != tt.want {
+				t.Errorf("hookJobName() = %q, want %q", got, tt.want)
+			}
+			if len(got) > 63 {
+				t.Errorf("hookJobName() = %q, want at most 63 characters", got)
+			}
+			if tt.differs != "" && hookJobName(sharekube, "preCopy", tt.differs) == got {
+				t.Error("hookJobName() returned the same name for different hooks")
+			}
+		})
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	hookJob := func(condition batchv1.JobConditionType, age time.Duration) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:              "sharekube-my-preview-precopy-seed",
+			Namespace:         "preview",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		}}
+		if condition != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue, Reason: "Done"}}
+		}
+		return job
+	}
+
+	tests := []struct {
+		name      string
+		timeout   string
+		existing  []client.Object
+		status    []sharekubev1alpha1.HookStatus
+		wantState string
+		wantJob   bool
+	}{
+		{
+			name:      "starts the Job",
+			wantState: sharekubev1alpha1.HookRunning,
+			wantJob:   true,
+		},
+		{
+			name:      "Job still running",
+			existing:  []client.Object{hookJob("", time.Minute)},
+			wantState: sharekubev1alpha1.HookRunning,
+			wantJob:   true,
+		},
+		{
+			name:      "Job completed",
+			existing:  []client.Object{hookJob(batchv1.JobComplete, time.Minute)},
+			wantState: sharekubev1alpha1.HookSucceeded,
+			wantJob:   true,
+		},
+		{
+			name:      "Job failed",
+			existing:  []client.Object{hookJob(batchv1.JobFailed, time.Minute)},
+			wantState: sharekubev1alpha1.HookFailed,
+			wantJob:   true,
+		},
+		{
+			name:      "Job timed out",
+			timeout:   "5m",
+			existing:  []client.Object{hookJob("", time.Hour)},
+			wantState: sharekubev1alpha1.HookFailed,
+		},
+		{
+			name:      "Job deleted before it finished",
+			status:    []sharekubev1alpha1.HookStatus{{Name: "seed", Stage: sharekubev1alpha1.HookStagePreCopy, Job: "sharekube-my-preview-precopy-seed", State: sharekubev1alpha1.HookRunning, StartTime: &metav1.Time{}}},
+			wantState: sharekubev1alpha1.HookFailed,
+		},
+		{
+			name:      "failed hook is not retried",
+			status:    []sharekubev1alpha1.HookStatus{{Name: "seed", Stage: sharekubev1alpha1.HookStagePreCopy, State: sharekubev1alpha1.HookFailed}},
+			wantState: sharekubev1alpha1.HookFailed,
+		},
+		{
+			name:      "succeeded hook is skipped",
+			status:    []sharekubev1alpha1.HookStatus{{Name: "seed", Stage: sharekubev1alpha1.HookStagePreCopy, State: sharekubev1alpha1.HookSucceeded}},
+			wantState: sharekubev1alpha1.HookSucceeded,
+		},
+		{
+			name:      "invalid timeout",
+			timeout:   "soon",
+			wantState: sharekubev1alpha1.HookFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := &sharekubev1alpha1.ShareKube{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-preview", Namespace: "dev"},
+				Spec: sharekubev1alpha1.ShareKubeSpec{
+					TargetNamespace: "preview",
+					Hooks: &sharekubev1alpha1.Hooks{PreCopy: []sharekubev1alpha1.Hook{{
+						Name:    "seed",
+						Timeout: tt.timeout,
+						Template: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "seed", Image: "busybox"}},
+						}}},
+					}}},
+				},
+				Status: sharekubev1alpha1.ShareKubeStatus{Hooks: tt.status},
+			}
+			c := newTestClient(t, tt.existing...)
+			// Log reads fail fast against an unreachable API server
+			r := &ShareKubeReconciler{Client: c, Config: &rest.Config{Host: "http://127.0.0.1:1"}}
+
+			state, err := r.runHooks(context.Background(), sk, sharekubev1alpha1.HookStagePreCopy)
+			if err != nil {
+				t.Fatalf("runHooks() error = %v", err)
+			}
+			if state != tt.wantState {
+				t.Errorf("runHooks() = %q, want %q", state, tt.wantState)
+			}
+			if len(sk.Status.Hooks) != 1 || sk.Status.Hooks[0].State != tt.wantState {
+				t.Errorf("hook status = %+v, want state %q", sk.Status.Hooks, tt.wantState)
+			}
+
+			job := &batchv1.Job{}
+			err = c.Get(context.Background(), types.NamespacedName{Namespace: "preview", Name: "sharekube-my-preview-precopy-seed"}, job)
+			if (err == nil) != tt.wantJob {
+				t.Fatalf("Get() hook Job error = %v, want Job %v", err, tt.wantJob)
+			}
+			if tt.wantJob && tt.existing == nil {
+				if job.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+					t.Errorf("restartPolicy = %q, want Never", job.Spec.Template.Spec.RestartPolicy)
+				}
+				if job.Labels[hookStageLabel] != sharekubev1alpha1.HookStagePreCopy {
+					t.Errorf("labels = %v, want the hook stage", job.Labels)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/activity"
+)
+
+// computeExpiration returns when the preview expires: at the end of its TTL or, when an idle timeout
+// is set, idleTimeout after the last recorded activity (or the creation without any), whichever is earlier.
+// Malformed values are logged and skipped so they cannot keep a preview from expiring.
+func computeExpiration(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) *metav1.Time {
+	logger := log.FromContext(ctx)
+	if sharekube.Status.CreationTime == nil {
+		return sharekube.Status.ExpirationTime
+	}
+
+	ttlDuration, err := time.ParseDuration(sharekube.Spec.TTL)
+	if err != nil {
+		logger.Error(err, "Invalid TTL format, keeping the current expiration time", "TTL", sharekube.Spec.TTL)
+		return sharekube.Status.ExpirationTime
+	}
+	expiration := sharekube.Status.CreationTime.Add(ttlDuration)
+
+	if sharekube.Spec.IdleTimeout != "" {
+		idleTimeout, err := time.ParseDuration(sharekube.Spec.IdleTimeout)
+		if err != nil {
+			logger.Error(err, "Invalid idleTimeout format, ignoring it", "IdleTimeout", sharekube.Spec.IdleTimeout)
+			idleTimeout = 0
+		}
+		lastActivity := sharekube.Status.CreationTime.Time
+		if value, ok := sharekube.Annotations[activity.LastActivityAnnotation]; ok {
+			recorded, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				logger.Error(err, "Invalid last activity annotation, falling back to the creation time",
+					"Annotation", activity.LastActivityAnnotation, "Value", value)
+			} else if recorded.After(lastActivity) {
+				lastActivity = recorded
+			}
+		}
+		if idleTimeout > 0 {
+			if idleExpiration := lastActivity.Add(idleTimeout); idleExpiration.Before(expiration) {
+				expiration = idleExpiration
+			}
+		}
+	}
+
+	expirationTime := metav1.NewTime(expiration)
+	return &expirationTime
+}
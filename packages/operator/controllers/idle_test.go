@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/activity"
+)
+
+func TestComputeExpiration(t *testing.T) {
+	created := metav1.NewTime(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	// current is the expiration recorded in the status, 3h after the creation
+	current := metav1.NewTime(created.Add(3 * time.Hour))
+
+	tests := []struct {
+		name          string
+		uninitialized bool
+		ttl           string
+		idleTimeout   string
+		lastActivity  string
+		want          time.Duration
+	}{
+		{name: "TTL only", ttl: "24h", want: 24 * time.Hour},
+		{name: "idle without activity", ttl: "24h", idleTimeout: "2h", want: 2 * time.Hour},
+		{name: "idle after activity", ttl: "24h", idleTimeout: "2h", lastActivity: "2026-10-19T15:00:00Z", want: 5 * time.Hour},
+		{name: "activity before creation", ttl: "24h", idleTimeout: "2h", lastActivity: "2026-10-19T10:00:00Z", want: 2 * time.Hour},
+		{name: "TTL is an upper bound", ttl: "4h", idleTimeout: "2h", lastActivity: "2026-10-19T15:00:00Z", want: 4 * time.Hour},
+		{name: "before initialization", uninitialized: true, ttl: "invalid", want: 3 * time.Hour},
+		{name: "invalid TTL keeps the current expiration", ttl: "forever", want: 3 * time.Hour},
+		{name: "invalid idle timeout is ignored", ttl: "24h", idleTimeout: "a while", want: 24 * time.Hour},
+		{name: "invalid activity falls back to the creation", ttl: "24h", idleTimeout: "2h", lastActivity: "2099-01-01", want: 2 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := &sharekubev1alpha1.ShareKube{
+				Spec:   sharekubev1alpha1.ShareKubeSpec{TTL: tt.ttl, IdleTimeout: tt.idleTimeout},
+				Status: sharekubev1alpha1.ShareKubeStatus{CreationTime: &created, ExpirationTime: current.DeepCopy()},
+			}
+			if tt.uninitialized {
+				sk.Status.CreationTime = nil
+			}
+			if tt.lastActivity != "" {
+				sk.Annotations = map[string]string{activity.LastActivityAnnotation: tt.lastActivity}
+			}
+
+			got := computeExpiration(context.Background(), sk)
+			if want := created.Add(tt.want); got == nil || !got.Time.Equal(want) {
+				t.Errorf("computeExpiration() = %v, want %s", got, want)
+			}
+		})
+	}
+}
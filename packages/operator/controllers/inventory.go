@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+// updateInventory records the objects written by this reconcile and prunes those of the previous inventory
+// that were not written again. Nothing is pruned while copies fail or wait, since their objects may still be desired.
+func updateInventory(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube, handler *resources.ResourceHandler, statuses []sharekubev1alpha1.ResourceStatus) {
+	logger := log.FromContext(ctx)
+
+	settled := true
+	for _, status := range statuses {
+		if status.Outcome == sharekubev1alpha1.OutcomePending || status.Outcome == sharekubev1alpha1.OutcomeFailed {
+			settled = false
+			break
+		}
+	}
+
+	// Entries are identified without their Adopted mark, which objects keep once they were adopted
+	seen := make(map[sharekubev1alpha1.InventoryEntry]int)
+	var inventory []sharekubev1alpha1.InventoryEntry
+	for _, entry := range handler.Applied() {
+		key := inventoryKey(entry)
+		if i, ok := seen[key]; ok {
+			inventory[i].Adopted = inventory[i].Adopted || entry.Adopted
+			continue
+		}
+		seen[key] = len(inventory)
+		inventory = append(inventory, entry)
+	}
+	for _, entry := range sharekube.Status.Inventory {
+		key := inventoryKey(entry)
+		if i, ok := seen[key]; ok {
+			inventory[i].Adopted = inventory[i].Adopted || entry.Adopted
+			continue
+		}
+		if settled && entry.Namespace == sharekube.Spec.TargetNamespace {
+			err := handler.Prune(ctx, entry)
+			if err == nil {
+				continue
+			}
+			logger.Error(err, "Failed to prune copy", "Kind", entry.Kind, "Name", entry.Name)
+		}
+		seen[key] = len(inventory)
+		inventory = append(inventory, entry)
+	}
+
+	sort.Slice(inventory, func(i, j int) bool {
+		if inventory[i].Kind != inventory[j].Kind {
+			return inventory[i].Kind < inventory[j].Kind
+		}
+		return inventory[i].Name < inventory[j].Name
+	})
+	sharekube.Status.Inventory = inventory
+}
+
+// inventoryKey identifies the object of an inventory entry
+func inventoryKey(entry sharekubev1alpha1.InventoryEntry) sharekubev1alpha1.InventoryEntry {
+	entry.Adopted = false
+	return entry
+}
+
+// pruneInventory deletes the objects of the inventory in the target namespace, including kinds the label-based cleanup
+// does not cover. With releaseAdopted, adopted and overwritten objects are released instead of deleted.
+// Only the objects that could not be deleted or released remain in the inventory.
+func (r *ShareKubeReconciler) pruneInventory(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube, releaseAdopted bool) {
+	logger := log.FromContext(ctx)
+	handler := resources.NewResourceHandler(r.Client, r.DynClient, r.Scheme, metav1.OwnerReference{}, sharekube.Name, sharekube.Namespace)
+	var remaining []sharekubev1alpha1.InventoryEntry
+	for _, entry := range sharekube.Status.Inventory {
+		if entry.Namespace != sharekube.Spec.TargetNamespace {
+			remaining = append(remaining, entry)
+			continue
+		}
+		var err error
+		if releaseAdopted && entry.Adopted {
+			err = handler.Release(ctx, entry)
+		} else {
+			err = handler.Prune(ctx, entry)
+		}
+		if err != nil {
+			logger.Error(err, "Failed to prune copy", "Kind", entry.Kind, "Name", entry.Name)
+			remaining = append(remaining, entry)
+		}
+	}
+	sharekube.Status.Inventory = remaining
+}
+
+// leaveTargetNamespace deletes what the ShareKube wrote to the namespace it targeted before spec.targetNamespace changed.
+// The copies are written to the new target namespace by the same reconcile, and the hooks run again there.
+func (r *ShareKubeReconciler) leaveTargetNamespace(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) error {
+	logger := log.FromContext(ctx)
+	logger.Info("Target namespace changed, cleaning up the previous one",
+		"From", sharekube.Status.TargetNamespace,
+		"To", sharekube.Spec.TargetNamespace)
+
+	previous := sharekube.DeepCopy()
+	previous.Spec.TargetNamespace = sharekube.Status.TargetNamespace
+	if err := r.cleanupResourcesWithLabels(ctx, previous); err != nil {
+		return err
+	}
+
+	// Drop the permissions granted in the previous namespace
+	var kept, stale []string
+	for _, ref := range sharekube.Status.DynamicPermissions {
+		if strings.HasPrefix(ref, previous.Spec.TargetNamespace+"/") && previous.Spec.TargetNamespace != sharekube.Namespace {
+			stale = append(stale, ref)
+		} else {
+			kept = append(kept, ref)
+		}
+	}
+	previous.Status.DynamicPermissions = stale
+	if err := r.PermissionsManager.CleanupPermissions(ctx, previous); err != nil {
+		return err
+	}
+	sharekube.Status.DynamicPermissions = kept
+
+	var inventory []sharekubev1alpha1.InventoryEntry
+	for _, entry := range sharekube.Status.Inventory {
+		if entry.Namespace != previous.Spec.TargetNamespace {
+			inventory = append(inventory, entry)
+		}
+	}
+	sharekube.Status.Inventory = inventory
+	sharekube.Status.Hooks = nil
+	sharekube.Status.TargetNamespace = sharekube.Spec.TargetNamespace
+	return nil
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+func TestUpdateInventory(t *testing.T) {
+	stale := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "old",
+			"namespace": "preview",
+			"labels":    map[string]interface{}{"sharekube.dev/owner-name": "my-preview", "sharekube.dev/owner-namespace": "dev"},
+		},
+	}}
+	inventory := []sharekubev1alpha1.InventoryEntry{
+		{APIVersion: "v1", Kind: "Service", Namespace: "preview", Name: "api", Adopted: true},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "preview", Name: "old"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "elsewhere", Name: "old"},
+	}
+
+	tests := []struct {
+		name     string
+		statuses []sharekubev1alpha1.ResourceStatus
+		want     []string
+		pruned   bool
+	}{
+		{
+			name:     "prunes entries of the target namespace once settled",
+			statuses: []sharekubev1alpha1.ResourceStatus{{Kind: "Deployment", Name: "api", Outcome: sharekubev1alpha1.OutcomeCopied}},
+			want:     []string{"elsewhere/ConfigMap/old"},
+			pruned:   true,
+		},
+		{
+			name:     "keeps entries while copies wait",
+			statuses: []sharekubev1alpha1.ResourceStatus{{Kind: "Deployment", Name: "api", Outcome: sharekubev1alpha1.OutcomePending}},
+			want:     []string{"preview/ConfigMap/old", "elsewhere/ConfigMap/old", "preview/Service/api"},
+		},
+		{
+			name:     "keeps entries while copies fail",
+			statuses: []sharekubev1alpha1.ResourceStatus{{Kind: "Deployment", Name: "api", Outcome: sharekubev1alpha1.OutcomeFailed}},
+			want:     []string{"preview/ConfigMap/old", "elsewhere/ConfigMap/old", "preview/Service/api"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), stale.DeepCopy())
+			handler := resources.NewResourceHandler(nil, dynClient, runtime.NewScheme(), metav1.OwnerReference{}, "my-preview", "dev")
+			sk := &sharekubev1alpha1.ShareKube{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-preview", Namespace: "dev"},
+				Spec:       sharekubev1alpha1.ShareKubeSpec{TargetNamespace: "preview"},
+				Status:     sharekubev1alpha1.ShareKubeStatus{Inventory: append([]sharekubev1alpha1.InventoryEntry(nil), inventory...)},
+			}
+
+			updateInventory(context.Background(), sk, handler, tt.statuses)
+
+			var got []string
+			for _, entry := range sk.Status.Inventory {
+				got = append(got, entry.Namespace+"/"+entry.Kind+"/"+entry.Name)
+				if entry.Kind == "Service" && !entry.Adopted {
+					t.Error("the Adopted mark of a kept entry was lost")
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inventory = %v, want %v", got, tt.want)
+			}
+
+			gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+			_, err := dynClient.Resource(gvr).Namespace("preview").Get(context.Background(), "old", metav1.GetOptions{})
+			if pruned := apierrors.IsNotFound(err); pruned != tt.pruned {
+				t.Errorf("Get() stale copy error = %v, want pruned %v", err, tt.pruned)
+			}
+		})
+	}
+}
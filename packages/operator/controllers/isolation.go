@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+const (
+	// namespaceNameLabel is set by Kubernetes on every namespace to its own name
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+
+	// componentLabel distinguishes objects generated by the controller from copied ones
+	componentLabel = "sharekube.dev/component"
+)
+
+// isolationPolicyNames returns the names of the NetworkPolicies generated for a ShareKube
+func isolationPolicyNames(sharekube *sharekubev1alpha1.ShareKube) (string, string) {
+	return fmt.Sprintf("sharekube-%s-default-deny", sharekube.Name),
+		fmt.Sprintf("sharekube-%s-allow", sharekube.Name)
+}
+
+// ensureIsolation creates or removes the isolation NetworkPolicies in the target namespace
+func (r *ShareKubeReconciler) ensureIsolation(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) error {
+	logger := log.FromContext(ctx)
+	denyName, allowName := isolationPolicyNames(sharekube)
+	namespace := sharekube.Spec.TargetNamespace
+
+	labels := mergeLabels(ownerLabels(sharekube), map[string]string{componentLabel: "isolation"})
+
+	if sharekube.Spec.Isolation == nil {
+		// Remove policies left over from a previous spec, leaving copied NetworkPolicies alone
+		if err := r.DeleteAllOf(ctx, &networkingv1.NetworkPolicy{},
+			client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete isolation NetworkPolicies: %w", err)
+		}
+		return nil
+	}
+
+	isolation := sharekube.Spec.Isolation
+	policyTypes := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}
+
+	deny := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: denyName, Namespace: namespace}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, deny, func() error {
+		deny.Labels = mergeLabels(deny.Labels, labels)
+		deny.Spec = networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			PolicyTypes: policyTypes,
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to create/update NetworkPolicy %s: %w", denyName, err)
+	}
+
+	// Pods inside the preview can always talk to each other
+	ingressPeers := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}
+	egressPeers := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}
+
+	if len(isolation.AllowedNamespaces) > 0 {
+		peer := networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      namespaceNameLabel,
+					Operator: metav1.LabelSelectorOpIn,
+					Values:   isolation.AllowedNamespaces,
+				}},
+			},
+		}
+		ingressPeers = append(ingressPeers, peer)
+		egressPeers = append(egressPeers, peer)
+	}
+	for _, cidr := range isolation.AllowedIngressCIDRs {
+		ingressPeers = append(ingressPeers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	for _, cidr := range isolation.AllowedEgressCIDRs {
+		egressPeers = append(egressPeers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+
+	egress := []networkingv1.NetworkPolicyEgressRule{{To: egressPeers}}
+	if isolation.AllowDNS == nil || *isolation.AllowDNS {
+		egress = append(egress, dnsEgressRule())
+	}
+
+	allow := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: allowName, Namespace: namespace}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, allow, func() error {
+		allow.Labels = mergeLabels(allow.Labels, labels)
+		allow.Spec = networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			PolicyTypes: policyTypes,
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: ingressPeers}},
+			Egress:      egress,
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to create/update NetworkPolicy %s: %w", allowName, err)
+	}
+
+	logger.Info("Ensured isolation NetworkPolicies", "Namespace", namespace)
+	return nil
+}
+
+// dnsEgressRule allows DNS lookups against the cluster DNS pods in kube-system
+func dnsEgressRule() networkingv1.NetworkPolicyEgressRule {
+	udp := corev1.ProtocolUDP
+	tcp := corev1.ProtocolTCP
+	port := intstr.FromInt(53)
+
+	return networkingv1.NetworkPolicyEgressRule{
+		To: []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{namespaceNameLabel: "kube-system"},
+			},
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"k8s-app": "kube-dns"},
+			},
+		}},
+		Ports: []networkingv1.NetworkPolicyPort{
+			{Protocol: &udp, Port: &port},
+			{Protocol: &tcp, Port: &port},
+		},
+	}
+}
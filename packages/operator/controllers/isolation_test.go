@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestEnsureIsolation(t *testing.T) {
+	allowDNS := false
+	tests := []struct {
+		name      string
+		isolation *sharekubev1alpha1.Isolation
+		policies  int
+		ingress   int
+		egress    int
+	}{
+		{
+			name:     "no isolation",
+			policies: 0,
+		},
+		{
+			name:      "defaults",
+			isolation: &sharekubev1alpha1.Isolation{},
+			policies:  2,
+			ingress:   1,
+			egress:    2,
+		},
+		{
+			name: "allowed namespaces and CIDRs",
+			isolation: &sharekubev1alpha1.Isolation{
+				AllowedNamespaces:   []string{"monitoring"},
+				AllowedIngressCIDRs: []string{"10.0.0.0/8"},
+				AllowedEgressCIDRs:  []string{"192.168.0.0/16", "172.16.0.0/12"},
+			},
+			policies: 2,
+			ingress:  3,
+			egress:   5,
+		},
+		{
+			name:      "without DNS",
+			isolation: &sharekubev1alpha1.Isolation{AllowDNS: &allowDNS},
+			policies:  2,
+			ingress:   1,
+			egress:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := &sharekubev1alpha1.ShareKube{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-preview", Namespace: "dev"},
+				Spec:       sharekubev1alpha1.ShareKubeSpec{TargetNamespace: "preview", Isolation: tt.isolation},
+			}
+			// A policy generated for an earlier spec, and a copied one that must be left alone
+			stale := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{
+				Name: "sharekube-my-preview-allow", Namespace: "preview",
+				Labels: mergeLabels(ownerLabels(sk), map[string]string{componentLabel: "isolation"}),
+			}}
+			copied := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{
+				Name: "copied", Namespace: "preview", Labels: ownerLabels(sk),
+			}}
+			c := newTestClient(t, stale, copied)
+			r := &ShareKubeReconciler{Client: c}
+
+			if err := r.ensureIsolation(context.Background(), sk); err != nil {
+				t.Fatalf("ensureIsolation() error = %v", err)
+			}
+
+			list := &networkingv1.NetworkPolicyList{}
+			if err := c.List(context.Background(), list, client.InNamespace("preview"),
+				client.MatchingLabels{componentLabel: "isolation"}); err != nil {
+				t.Fatal(err)
+			}
+			if len(list.Items) != tt.policies {
+				t.Fatalf("%d isolation NetworkPolicies, want %d", len(list.Items), tt.policies)
+			}
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(copied), &networkingv1.NetworkPolicy{}); err != nil {
+				t.Errorf("copied NetworkPolicy was removed: %v", err)
+			}
+			if tt.policies == 0 {
+				return
+			}
+
+			allow := &networkingv1.NetworkPolicy{}
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(stale), allow); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(allow.Spec.Ingress[0].From); got != tt.ingress {
+				t.Errorf("%d ingress peers, want %d", got, tt.ingress)
+			}
+			egress := 0
+			for _, rule := range allow.Spec.Egress {
+				egress += len(rule.To)
+			}
+			if egress != tt.egress {
+				t.Errorf("%d egress peers, want %d", egress, tt.egress)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+// QuotaViolationScaleDown copies workloads with as many replicas as fit the quota instead of rejecting them
+const QuotaViolationScaleDown = "ScaleDown"
+
+// ensureNamespaceLimits creates or removes the ResourceQuota and LimitRange in the target namespace
+func (r *ShareKubeReconciler) ensureNamespaceLimits(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) error {
+	logger := log.FromContext(ctx)
+	name := fmt.Sprintf("sharekube-%s", sharekube.Name)
+	namespace := sharekube.Spec.TargetNamespace
+	labels := mergeLabels(ownerLabels(sharekube), map[string]string{componentLabel: "limits"})
+
+	var limits sharekubev1alpha1.NamespaceLimits
+	if sharekube.Spec.Limits != nil {
+		limits = *sharekube.Spec.Limits
+	}
+
+	if limits.ResourceQuota != nil {
+		quota := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, quota, func() error {
+			quota.Labels = mergeLabels(quota.Labels, labels)
+			quota.Spec = *limits.ResourceQuota.DeepCopy()
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to create/update ResourceQuota %s: %w", name, err)
+		}
+		logger.Info("Ensured ResourceQuota", "Namespace", namespace, "Name", name)
+	} else if err := r.DeleteAllOf(ctx, &corev1.ResourceQuota{},
+		client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete ResourceQuotas: %w", err)
+	}
+
+	if limits.LimitRange != nil {
+		limitRange := &corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, limitRange, func() error {
+			limitRange.Labels = mergeLabels(limitRange.Labels, labels)
+			limitRange.Spec = *limits.LimitRange.DeepCopy()
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to create/update LimitRange %s: %w", name, err)
+		}
+		logger.Info("Ensured LimitRange", "Namespace", namespace, "Name", name)
+	} else if err := r.DeleteAllOf(ctx, &corev1.LimitRange{},
+		client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete LimitRanges: %w", err)
+	}
+
+	return nil
+}
+
+// quotaBudget tracks how much of the provisioned ResourceQuota is left while workloads are copied
+type quotaBudget struct {
+	remaining  map[corev1.ResourceName]resource.Quantity
+	limitRange *corev1.LimitRangeSpec
+	scaleDown  bool
+}
+
+// newQuotaBudget returns a budget for the ShareKube's ResourceQuota, or nil when no quota is provisioned
+func newQuotaBudget(limits *sharekubev1alpha1.NamespaceLimits) *quotaBudget {
+	if limits == nil || limits.ResourceQuota == nil {
+		return nil
+	}
+
+	// Only the pod-level resources the controller can account for are tracked
+	remaining := map[corev1.ResourceName]resource.Quantity{}
+	for _, name := range []corev1.ResourceName{
+		corev1.ResourceRequestsCPU, corev1.ResourceRequestsMemory,
+		corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourcePods,
+	} {
+		if q, ok := limits.ResourceQuota.Hard[name]; ok {
+			remaining[name] = q.DeepCopy()
+		}
+	}
+
+	return &quotaBudget{
+		remaining:  remaining,
+		limitRange: limits.LimitRange,
+		scaleDown:  limits.QuotaViolationPolicy == QuotaViolationScaleDown,
+	}
+}
+
+// admit decides how many replicas of the workload fit the remaining quota and returns the outcome.
+// The budget is only charged once the copy succeeds, see commit.
+func (b *quotaBudget) admit(footprint *resources.WorkloadFootprint) (int32, string, string) {
+	perPod := b.podUsage(footprint.PodSpec)
+
+	fit := footprint.Replicas
+	for name, remaining := range b.remaining {
+		usage, ok := perPod[name]
+		if !ok || usage.IsZero() {
+			continue
+		}
+		// Milli-bytes of memory quotas overflow int32, so only the count that fits is converted
+		n := remaining.MilliValue() / usage.MilliValue()
+		if n < 0 {
+			n = 0
+		}
+		if n < int64(fit) {
+			fit = int32(n)
+		}
+	}
+
+	switch {
+	case fit >= footprint.Replicas:
+		return footprint.Replicas, sharekubev1alpha1.OutcomeCopied, ""
+	case b.scaleDown && footprint.Scalable && fit > 0:
+		return fit, sharekubev1alpha1.OutcomeScaledDown,
+			fmt.Sprintf("scaled down from %d to %d replicas to fit the ResourceQuota", footprint.Replicas, fit)
+	default:
+		return 0, sharekubev1alpha1.OutcomeRejected,
+			fmt.Sprintf("%d replicas would exceed the ResourceQuota (%d fit)", footprint.Replicas, fit)
+	}
+}
+
+// commit deducts the usage of the given number of the workload's pods from the budget
+func (b *quotaBudget) commit(footprint *resources.WorkloadFootprint, replicas int32) {
+	perPod := b.podUsage(footprint.PodSpec)
+	for name, remaining := range b.remaining {
+		usage, ok := perPod[name]
+		if !ok {
+			continue
+		}
+		remaining.Sub(*resource.NewMilliQuantity(usage.MilliValue()*int64(replicas), usage.Format))
+		b.remaining[name] = remaining
+	}
+}
+
+// podUsage returns the quota usage of a single pod, filling missing requests from the LimitRange defaults
+func (b *quotaBudget) podUsage(spec *corev1.PodSpec) corev1.ResourceList {
+	var defaultRequests corev1.ResourceList
+	if b.limitRange != nil {
+		for _, item := range b.limitRange.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			// The API server falls back to the default limit when no default request is set
+			defaultRequests = corev1.ResourceList{}
+			for name, q := range item.Default {
+				defaultRequests[name] = q.DeepCopy()
+			}
+			for name, q := range item.DefaultRequest {
+				defaultRequests[name] = q.DeepCopy()
+			}
+		}
+	}
+
+	requests := corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		containerRequests := container.Resources.Requests.DeepCopy()
+		if containerRequests == nil {
+			containerRequests = corev1.ResourceList{}
+		}
+		for name, q := range defaultRequests {
+			if _, ok := containerRequests[name]; !ok {
+				containerRequests[name] = q
+			}
+		}
+		resources.AddResourceList(requests, containerRequests)
+	}
+
+	usage := corev1.ResourceList{
+		corev1.ResourcePods: *resource.NewQuantity(1, resource.DecimalSI),
+	}
+	if cpu, ok := requests[corev1.ResourceCPU]; ok {
+		usage[corev1.ResourceCPU] = cpu
+		usage[corev1.ResourceRequestsCPU] = cpu
+	}
+	if memory, ok := requests[corev1.ResourceMemory]; ok {
+		usage[corev1.ResourceMemory] = memory
+		usage[corev1.ResourceRequestsMemory] = memory
+	}
+	return usage
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+func TestQuotaBudgetAdmit(t *testing.T) {
+	pod := func(cpu string) *corev1.PodSpec {
+		container := corev1.Container{Name: "app"}
+		if cpu != "" {
+			container.Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}
+		}
+		return &corev1.PodSpec{Containers: []corev1.Container{container}}
+	}
+	memoryPod := func(memory string) *corev1.PodSpec {
+		return &corev1.PodSpec{Containers: []corev1.Container{{
+			Name:      "app",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(memory)}},
+		}}}
+	}
+	quota := func(hard corev1.ResourceList) *corev1.ResourceQuotaSpec {
+		return &corev1.ResourceQuotaSpec{Hard: hard}
+	}
+	defaults := &corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+		Type:           corev1.LimitTypeContainer,
+		DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+	}}}
+
+	tests := []struct {
+		name      string
+		limits    sharekubev1alpha1.NamespaceLimits
+		footprint resources.WorkloadFootprint
+		committed int32
+		replicas  int32
+		outcome   string
+	}{
+		{
+			name:      "fits",
+			limits:    sharekubev1alpha1.NamespaceLimits{ResourceQuota: quota(corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("2")})},
+			footprint: resources.WorkloadFootprint{PodSpec: pod("500m"), Replicas: 3, Scalable: true},
+			replicas:  3,
+			outcome:   sharekubev1alpha1.OutcomeCopied,
+		},
+		{
+			name:      "rejected",
+			limits:    sharekubev1alpha1.NamespaceLimits{ResourceQuota: quota(corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")})},
+			footprint: resources.WorkloadFootprint{PodSpec: pod("500m"), Replicas: 3, Scalable: true},
+			outcome:   sharekubev1alpha1.OutcomeRejected,
+		},
+		{
+			name: "scaled down",
+			limits: sharekubev1alpha1.NamespaceLimits{
+				ResourceQuota:        quota(corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")}),
+				QuotaViolationPolicy: QuotaViolationScaleDown,
+			},
+			footprint: resources.WorkloadFootprint{PodSpec: pod("500m"), Replicas: 3, Scalable: true},
+			replicas:  2,
+			outcome:   sharekubev1alpha1.OutcomeScaledDown,
+		},
+		{
+			name: "workloads without a replica count are not scaled down",
+			limits: sharekubev1alpha1.NamespaceLimits{
+				ResourceQuota:        quota(corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")}),
+				QuotaViolationPolicy: QuotaViolationScaleDown,
+			},
+			footprint: resources.WorkloadFootprint{PodSpec: pod("500m"), Replicas: 3},
+			outcome:   sharekubev1alpha1.OutcomeRejected,
+		},
+		{
+			name:      "pod count",
+			limits:    sharekubev1alpha1.NamespaceLimits{ResourceQuota: quota(corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")})},
+			footprint: resources.WorkloadFootprint{PodSpec: pod(""), Replicas: 3, Scalable: true},
+			outcome:   sharekubev1alpha1.OutcomeRejected,
+		},
+		{
+			name: "missing requests are filled from the LimitRange",
+			limits: sharekubev1alpha1.NamespaceLimits{
+				ResourceQuota: quota(corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}),
+				LimitRange:    defaults,
+			},
+			footprint: resources.WorkloadFootprint{PodSpec: pod(""), Replicas: 3},
+			outcome:   sharekubev1alpha1.OutcomeRejected,
+		},
+		{
+			name:      "Gi-sized memory quota",
+			limits:    sharekubev1alpha1.NamespaceLimits{ResourceQuota: quota(corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("8Gi")})},
+			footprint: resources.WorkloadFootprint{PodSpec: memoryPod("512Mi"), Replicas: 3, Scalable: true},
+			replicas:  3,
+			outcome:   sharekubev1alpha1.OutcomeCopied,
+		},
+		{
+			name:      "more pods fit a memory quota than an int32 holds",
+			limits:    sharekubev1alpha1.NamespaceLimits{ResourceQuota: quota(corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("8Gi")})},
+			footprint: resources.WorkloadFootprint{PodSpec: memoryPod("2"), Replicas: 3, Scalable: true},
+			replicas:  3,
+			outcome:   sharekubev1alpha1.OutcomeCopied,
+		},
+		{
+			name:      "earlier copies are charged",
+			limits:    sharekubev1alpha1.NamespaceLimits{ResourceQuota: quota(corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("2")})},
+			footprint: resources.WorkloadFootprint{PodSpec: pod("500m"), Replicas: 2, Scalable: true},
+			committed: 3,
+			outcome:   sharekubev1alpha1.OutcomeRejected,
+		},
+		{
+			name:      "untracked resources are ignored",
+			limits:    sharekubev1alpha1.NamespaceLimits{ResourceQuota: quota(corev1.ResourceList{corev1.ResourceServices: resource.MustParse("0")})},
+			footprint: resources.WorkloadFootprint{PodSpec: pod("500m"), Replicas: 3, Scalable: true},
+			replicas:  3,
+			outcome:   sharekubev1alpha1.OutcomeCopied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := newQuotaBudget(&tt.limits)
+			budget.commit(&tt.footprint, tt.committed)
+			replicas, outcome, _ := budget.admit(&tt.footprint)
+			if replicas != tt.replicas || outcome != tt.outcome {
+				t.Errorf("admit() = %d, %s, want %d, %s", replicas, outcome, tt.replicas, tt.outcome)
+			}
+		})
+	}
+}
+
+func TestNewQuotaBudgetWithoutQuota(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits *sharekubev1alpha1.NamespaceLimits
+	}{
+		{name: "no limits"},
+		{name: "no ResourceQuota", limits: &sharekubev1alpha1.NamespaceLimits{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if budget := newQuotaBudget(tt.limits); budget != nil {
+				t.Errorf("newQuotaBudget() = %v, want nil", budget)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -37,9 +38,10 @@ type ResourcePermission struct {
 	Resources []string
 }
 
-// getResourceMapping returns the mapping of resource kinds to their API groups
+// getResourceMapping returns the mapping of resource kinds to their API groups,
+// including the kinds registered with resources.RegisterKind
 func getResourceMapping() map[string]ResourcePermission {
-	return map[string]ResourcePermission{
+	mapping := map[string]ResourcePermission{
 		"Deployment": {
 			APIGroup:  "apps",
 			Resources: []string{"deployments"},
@@ -76,6 +78,14 @@ func getResourceMapping() map[string]ResourcePermission {
 			APIGroup:  "",
 			Resources: []string{"persistentvolumeclaims"},
 		},
+		"ServiceAccount": {
+			APIGroup:  "",
+			Resources: []string{"serviceaccounts"},
+		},
+		"PodDisruptionBudget": {
+			APIGroup:  "policy",
+			Resources: []string{"poddisruptionbudgets"},
+		},
 		"Job": {
 			APIGroup:  "batch",
 			Resources: []string{"jobs"},
@@ -88,11 +98,42 @@ func getResourceMapping() map[string]ResourcePermission {
 			APIGroup:  "networking.k8s.io",
 			Resources: []string{"ingresses"},
 		},
+		"HTTPRoute": {
+			APIGroup:  "gateway.networking.k8s.io",
+			Resources: []string{"httproutes"},
+		},
 		"NetworkPolicy": {
 			APIGroup:  "networking.k8s.io",
 			Resources: []string{"networkpolicies"},
 		},
+		"Role": {
+			APIGroup:  "rbac.authorization.k8s.io",
+			Resources: []string{"roles"},
+		},
+		"RoleBinding": {
+			APIGroup:  "rbac.authorization.k8s.io",
+			Resources: []string{"rolebindings"},
+		},
+		"HorizontalPodAutoscaler": {
+			APIGroup:  "autoscaling",
+			Resources: []string{"horizontalpodautoscalers"},
+		},
+		"ResourceQuota": {
+			APIGroup:  "",
+			Resources: []string{"resourcequotas"},
+		},
+		"LimitRange": {
+			APIGroup:  "",
+			Resources: []string{"limitranges"},
+		},
 	}
+
+	for kind, gvr := range resources.RegisteredKinds() {
+		if _, ok := mapping[kind]; !ok {
+			mapping[kind] = ResourcePermission{APIGroup: gvr.Group, Resources: []string{gvr.Resource}}
+		}
+	}
+	return mapping
 }
 
 // EnsurePermissions ensures that the necessary permissions are created for a ShareKube resource
@@ -110,11 +151,24 @@ func (pm *PermissionsManager) EnsurePermissions(ctx context.Context, sharekube *
 	requiredPermissions := make(map[string][]string)
 
 	// Collect resource types from ShareKube resources list
+	kinds := make([]string, 0, len(sharekube.Spec.Resources))
 	for _, resource := range sharekube.Spec.Resources {
-		resourceMap := getResourceMapping()
-		resourceInfo, exists := resourceMap[resource.Kind]
+		kinds = append(kinds, resource.Kind)
+	}
+
+	// Include the kinds the controller generates in the target namespace
+	if sharekube.Spec.Isolation != nil {
+		kinds = append(kinds, "NetworkPolicy")
+	}
+	if sharekube.Spec.Limits != nil {
+		kinds = append(kinds, "ResourceQuota", "LimitRange")
+	}
+
+	resourceMap := getResourceMapping()
+	for _, kind := range kinds {
+		resourceInfo, exists := resourceMap[kind]
 		if !exists {
-			logger.Info("Unknown resource kind", "kind", resource.Kind)
+			logger.Info("Unknown resource kind", "kind", kind)
 			continue
 		}
 
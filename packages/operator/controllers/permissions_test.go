@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+func TestEnsurePermissions(t *testing.T) {
+	resources.RegisterKind("PermissionsTestWidget", schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"})
+
+	tests := []struct {
+		name  string
+		kinds []string
+		want  map[string][]string
+	}{
+		{name: "built-in kind", kinds: []string{"Deployment"}, want: map[string][]string{"apps": {"deployments"}}},
+		{name: "registered kind", kinds: []string{"PermissionsTestWidget"}, want: map[string][]string{"example.com": {"widgets"}}},
+		{name: "unknown kind", kinds: []string{"Gadget"}, want: map[string][]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := &sharekubev1alpha1.ShareKube{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-preview", Namespace: "dev", UID: "uid"},
+				Spec: sharekubev1alpha1.ShareKubeSpec{
+					TargetNamespace: "preview",
+					AccessControl:   &sharekubev1alpha1.AccessControl{Restrict: true},
+				},
+			}
+			for _, kind := range tt.kinds {
+				sk.Spec.Resources = append(sk.Spec.Resources, sharekubev1alpha1.Resource{Kind: kind, Name: "app"})
+			}
+			c := newTestClient(t, sk)
+
+			if err := NewPermissionsManager(c, c.Scheme()).EnsurePermissions(context.Background(), sk); err != nil {
+				t.Fatalf("EnsurePermissions() error = %v", err)
+			}
+
+			role := &rbacv1.Role{}
+			if err := c.Get(context.Background(), client.ObjectKey{Namespace: "preview", Name: "sharekube-my-preview-target"}, role); err != nil {
+				t.Fatalf("target Role not found: %v", err)
+			}
+			got := map[string][]string{}
+			for _, rule := range role.Rules {
+				for _, group := range rule.APIGroups {
+					got[group] = append(got[group], rule.Resources...)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("target Role grants %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
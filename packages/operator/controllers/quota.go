@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+// QuotaConfig limits how many previews may exist and how much capacity their workloads may request.
+// Zero values mean unlimited.
+type QuotaConfig struct {
+	// MaxPerSourceNamespace is the maximum number of concurrent ShareKubes per source namespace
+	MaxPerSourceNamespace int
+	// MaxPerCreator is the maximum number of concurrent ShareKubes per creator, as recorded by the admission webhook
+	MaxPerCreator int
+	// MaxTotal is the maximum number of concurrent ShareKubes in the cluster
+	MaxTotal int
+	// MaxCPU is the maximum aggregate CPU requests of copied workloads across all previews
+	MaxCPU resource.Quantity
+	// MaxMemory is the maximum aggregate memory requests of copied workloads across all previews
+	MaxMemory resource.Quantity
+	// EvictOldest deletes the oldest previews in the exceeded scope instead of holding back the new one
+	EvictOldest bool
+}
+
+// enabled reports whether any quota is configured
+func (q QuotaConfig) enabled() bool {
+	return q.MaxPerSourceNamespace > 0 || q.MaxPerCreator > 0 || q.MaxTotal > 0 ||
+		!q.MaxCPU.IsZero() || !q.MaxMemory.IsZero()
+}
+
+// isActivePreview reports whether a ShareKube counts against quotas. A preview counts once it was admitted,
+// which is recorded before anything is copied, and keeps counting in Error because it may still hold copies.
+func isActivePreview(sk *sharekubev1alpha1.ShareKube) bool {
+	if !sk.DeletionTimestamp.IsZero() {
+		return false
+	}
+	if meta.IsStatusConditionFalse(sk.Status.Conditions, sharekubev1alpha1.ConditionQuotaExceeded) {
+		return true
+	}
+	switch sk.Status.Phase {
+	case "", "Initializing", "Pending":
+		return false
+	}
+	return true
+}
+
+// quotaScope is a set of previews that share a count limit
+type quotaScope struct {
+	name    string
+	max     int
+	members func(sk *sharekubev1alpha1.ShareKube) bool
+}
+
+// enforceQuotas checks whether admitting the ShareKube would exceed a quota, evicting the oldest
+// previews when configured to. It returns a non-empty message when the ShareKube must wait.
+func (r *ShareKubeReconciler) enforceQuotas(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) (string, error) {
+	logger := log.FromContext(ctx)
+
+	if !r.Quotas.enabled() {
+		return "", nil
+	}
+
+	// Record what this preview would request so other previews can account for it.
+	// Source workloads are read from the API server, since the manager's cache does not watch them.
+	requests := corev1.ResourceList{}
+	for _, item := range sharekube.Spec.Resources {
+		resourceNamespace := item.Namespace
+		if resourceNamespace == "" {
+			resourceNamespace = sharekube.Namespace
+		}
+		workloadRequests, err := resources.WorkloadRequests(ctx, r.APIReader, item.Kind, item.Name, resourceNamespace, sharekube.Spec.Scaling)
+		if err != nil {
+			logger.Error(err, "Failed to compute resource requests", "Kind", item.Kind, "Name", item.Name)
+			continue
+		}
+		resources.AddResourceList(requests, workloadRequests)
+	}
+	sharekube.Status.ResourceRequests = requests
+
+	// The cache may not hold the admission of a preview reconciled moments ago yet
+	list := &sharekubev1alpha1.ShareKubeList{}
+	if err := r.APIReader.List(ctx, list); err != nil {
+		return "", fmt.Errorf("failed to list ShareKubes: %w", err)
+	}
+
+	var active []*sharekubev1alpha1.ShareKube
+	for i := range list.Items {
+		sk := &list.Items[i]
+		if sk.UID == sharekube.UID || !isActivePreview(sk) {
+			continue
+		}
+		active = append(active, sk)
+	}
+
+	// Oldest first, so eviction always picks the longest-lived preview
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreationTimestamp.Before(&active[j].CreationTimestamp)
+	})
+
+	evicted := map[types.UID]bool{}
+	evict := func(sk *sharekubev1alpha1.ShareKube) error {
+		logger.Info("Evicting oldest preview to make room", "Namespace", sk.Namespace, "Name", sk.Name)
+		if err := r.Delete(ctx, sk); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to evict ShareKube %s/%s: %w", sk.Namespace, sk.Name, err)
+		}
+		evicted[sk.UID] = true
+		return nil
+	}
+
+	creator := sharekube.Annotations[sharekubev1alpha1.CreatorAnnotation]
+	scopes := []quotaScope{
+		{
+			name:    "cluster",
+			max:     r.Quotas.MaxTotal,
+			members: func(*sharekubev1alpha1.ShareKube) bool { return true },
+		},
+		{
+			name:    fmt.Sprintf("source namespace %q", sharekube.Namespace),
+			max:     r.Quotas.MaxPerSourceNamespace,
+			members: func(sk *sharekubev1alpha1.ShareKube) bool { return sk.Namespace == sharekube.Namespace },
+		},
+	}
+	if creator != "" {
+		scopes = append(scopes, quotaScope{
+			name: fmt.Sprintf("creator %q", creator),
+			max:  r.Quotas.MaxPerCreator,
+			members: func(sk *sharekubev1alpha1.ShareKube) bool {
+				return sk.Annotations[sharekubev1alpha1.CreatorAnnotation] == creator
+			},
+		})
+	}
+
+	for _, scope := range scopes {
+		if scope.max <= 0 {
+			continue
+		}
+
+		var members []*sharekubev1alpha1.ShareKube
+		for _, sk := range active {
+			if !evicted[sk.UID] && scope.members(sk) {
+				members = append(members, sk)
+			}
+		}
+
+		for len(members)+1 > scope.max {
+			if !r.Quotas.EvictOldest {
+				return fmt.Sprintf("maximum of %d concurrent previews reached for %s", scope.max, scope.name), nil
+			}
+			if err := evict(members[0]); err != nil {
+				return "", err
+			}
+			members = members[1:]
+		}
+	}
+
+	// Aggregate CPU and memory requests across all remaining previews
+	limits := map[corev1.ResourceName]resource.Quantity{
+		corev1.ResourceCPU:    r.Quotas.MaxCPU,
+		corev1.ResourceMemory: r.Quotas.MaxMemory,
+	}
+	for name, limit := range limits {
+		if limit.IsZero() {
+			continue
+		}
+
+		total := requests[name].DeepCopy()
+		for _, sk := range active {
+			if !evicted[sk.UID] {
+				q := sk.Status.ResourceRequests[name]
+				total.Add(q)
+			}
+		}
+
+		for i := 0; total.Cmp(limit) > 0; i++ {
+			if !r.Quotas.EvictOldest || i >= len(active) {
+				return fmt.Sprintf("aggregate %s requests %s would exceed the limit of %s",
+					name, total.String(), limit.String()), nil
+			}
+			sk := active[i]
+			if evicted[sk.UID] {
+				continue
+			}
+			if err := evict(sk); err != nil {
+				return "", err
+			}
+			q := sk.Status.ResourceRequests[name]
+			total.Sub(q)
+		}
+	}
+
+	return "", nil
+}
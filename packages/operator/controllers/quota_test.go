@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// admitted returns the QuotaExceeded condition recorded when a preview is admitted
+func admitted() []metav1.Condition {
+	return []metav1.Condition{{
+		Type:   sharekubev1alpha1.ConditionQuotaExceeded,
+		Status: metav1.ConditionFalse,
+		Reason: "WithinQuota",
+	}}
+}
+
+func TestIsActivePreview(t *testing.T) {
+	now := metav1.Now()
+	tests := []struct {
+		name   string
+		status sharekubev1alpha1.ShareKubeStatus
+		delete bool
+		active bool
+	}{
+		{name: "new", status: sharekubev1alpha1.ShareKubeStatus{}},
+		{name: "initializing", status: sharekubev1alpha1.ShareKubeStatus{Phase: "Initializing"}},
+		{name: "held back by a quota", status: sharekubev1alpha1.ShareKubeStatus{Phase: "Pending"}},
+		{name: "admitted while initializing", status: sharekubev1alpha1.ShareKubeStatus{Phase: "Initializing", Conditions: admitted()}, active: true},
+		{name: "admitted and pending", status: sharekubev1alpha1.ShareKubeStatus{Phase: "Pending", Conditions: admitted()}, active: true},
+		{name: "processing", status: sharekubev1alpha1.ShareKubeStatus{Phase: "Processing"}, active: true},
+		{name: "ready", status: sharekubev1alpha1.ShareKubeStatus{Phase: "Ready"}, active: true},
+		{name: "error", status: sharekubev1alpha1.ShareKubeStatus{Phase: "Error"}, active: true},
+		{name: "being deleted", status: sharekubev1alpha1.ShareKubeStatus{Phase: "Ready", Conditions: admitted()}, delete: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := &sharekubev1alpha1.ShareKube{Status: tt.status}
+			if tt.delete {
+				sk.DeletionTimestamp = &now
+			}
+			if got := isActivePreview(sk); got != tt.active {
+				t.Errorf("isActivePreview() = %v, want %v", got, tt.active)
+			}
+		})
+	}
+}
+
+func TestEnforceQuotas(t *testing.T) {
+	preview := func(name string, age int, status sharekubev1alpha1.ShareKubeStatus) *sharekubev1alpha1.ShareKube {
+		return &sharekubev1alpha1.ShareKube{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "dev",
+				UID:               types.UID(name),
+				CreationTimestamp: metav1.Unix(int64(1000-age), 0),
+			},
+			Status: status,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		quotas   QuotaConfig
+		existing []client.Object
+		blocked  bool
+		evicted  []string
+	}{
+		{
+			name:     "unlimited",
+			existing: []client.Object{preview("a", 1, sharekubev1alpha1.ShareKubeStatus{Phase: "Ready"})},
+		},
+		{
+			name:     "room left",
+			quotas:   QuotaConfig{MaxTotal: 2},
+			existing: []client.Object{preview("a", 1, sharekubev1alpha1.ShareKubeStatus{Phase: "Ready"})},
+		},
+		{
+			name:     "admitted preview still initializing counts",
+			quotas:   QuotaConfig{MaxTotal: 1},
+			existing: []client.Object{preview("a", 1, sharekubev1alpha1.ShareKubeStatus{Phase: "Initializing", Conditions: admitted()})},
+			blocked:  true,
+		},
+		{
+			name:     "failed preview counts",
+			quotas:   QuotaConfig{MaxPerSourceNamespace: 1},
+			existing: []client.Object{preview("a", 1, sharekubev1alpha1.ShareKubeStatus{Phase: "Error"})},
+			blocked:  true,
+		},
+		{
+			name:     "previews held back do not count",
+			quotas:   QuotaConfig{MaxTotal: 1},
+			existing: []client.Object{preview("a", 1, sharekubev1alpha1.ShareKubeStatus{Phase: "Pending"})},
+		},
+		{
+			name:   "oldest preview is evicted",
+			quotas: QuotaConfig{MaxTotal: 2, EvictOldest: true},
+			existing: []client.Object{
+				preview("young", 1, sharekubev1alpha1.ShareKubeStatus{Phase: "Ready"}),
+				preview("old", 5, sharekubev1alpha1.ShareKubeStatus{Phase: "Ready"}),
+			},
+			evicted: []string{"old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, tt.existing...)
+			r := &ShareKubeReconciler{Client: c, APIReader: c, Quotas: tt.quotas}
+
+			message, err := r.enforceQuotas(context.Background(), preview("new", 0, sharekubev1alpha1.ShareKubeStatus{Phase: "Initializing"}))
+			if err != nil {
+				t.Fatalf("enforceQuotas() error = %v", err)
+			}
+			if blocked := message != ""; blocked != tt.blocked {
+				t.Errorf("enforceQuotas() message = %q, want blocked %v", message, tt.blocked)
+			}
+
+			list := &sharekubev1alpha1.ShareKubeList{}
+			if err := c.List(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+			if remaining := len(tt.existing) - len(tt.evicted); len(list.Items) != remaining {
+				t.Errorf("%d previews left, want %d", len(list.Items), remaining)
+			}
+			for _, name := range tt.evicted {
+				for _, sk := range list.Items {
+					if sk.Name == name {
+						t.Errorf("preview %s was not evicted", name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEnforceQuotasRecordsRequests(t *testing.T) {
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "dev"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:      "api",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")}},
+			}}}},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		quotas       QuotaConfig
+		blocked      bool
+		wantRequests string
+	}{
+		{name: "quotas disabled"},
+		{name: "within the CPU quota", quotas: QuotaConfig{MaxCPU: resource.MustParse("1")}, wantRequests: "500m"},
+		{name: "above the CPU quota", quotas: QuotaConfig{MaxCPU: resource.MustParse("400m")}, blocked: true, wantRequests: "500m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Source workloads are only visible to the API reader, like with the manager's label-scoped cache
+			r := &ShareKubeReconciler{Client: newTestClient(t), APIReader: newTestClient(t, deployment.DeepCopy()), Quotas: tt.quotas}
+			sk := &sharekubev1alpha1.ShareKube{
+				ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "dev"},
+				Spec:       sharekubev1alpha1.ShareKubeSpec{Resources: []sharekubev1alpha1.Resource{{Kind: "Deployment", Name: "api"}}},
+			}
+
+			message, err := r.enforceQuotas(context.Background(), sk)
+			if err != nil {
+				t.Fatalf("enforceQuotas() error = %v", err)
+			}
+			if blocked := message != ""; blocked != tt.blocked {
+				t.Errorf("enforceQuotas() message = %q, want blocked %v", message, tt.blocked)
+			}
+
+			cpu, found := sk.Status.ResourceRequests[corev1.ResourceCPU]
+			if tt.wantRequests == "" {
+				if found {
+					t.Errorf("resourceRequests = %v, want none with quotas disabled", sk.Status.ResourceRequests)
+				}
+				return
+			}
+			if want := resource.MustParse(tt.wantRequests); cpu.Cmp(want) != 0 {
+				t.Errorf("CPU requests = %s, want %s", cpu.String(), tt.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+// checkReadiness records which of the copies are ready and returns why the first one is not, or "" once all of them are.
+// Copies found ready before are not checked again.
+func checkReadiness(ctx context.Context, handler *resources.ResourceHandler, targetNamespace string, statuses []sharekubev1alpha1.ResourceStatus) string {
+	notReady := ""
+	for i := range statuses {
+		status := &statuses[i]
+		name := status.Name
+		if status.TargetName != "" {
+			name = status.TargetName
+		}
+
+		switch status.Outcome {
+		case sharekubev1alpha1.OutcomePending:
+			if notReady == "" {
+				notReady = fmt.Sprintf("%s %s is pending", status.Kind, name)
+			}
+			continue
+		case sharekubev1alpha1.OutcomeCopied, sharekubev1alpha1.OutcomeScaledDown:
+		default:
+			continue
+		}
+		if status.Ready {
+			continue
+		}
+
+		ready, message, err := handler.CheckReady(ctx, status.Kind, name, targetNamespace)
+		if err != nil {
+			message = err.Error()
+		}
+		status.Ready = err == nil && ready
+		if status.Ready {
+			continue
+		}
+		if status.Message == "" {
+			status.Message = message
+		}
+		if notReady == "" {
+			notReady = fmt.Sprintf("%s %s: %s", status.Kind, name, message)
+		}
+	}
+	return notReady
+}
+
+// summarizeReadiness returns the number of ready copies and why the first copy is not ready, or "" once all of them are
+func summarizeReadiness(statuses []sharekubev1alpha1.ResourceStatus) (int32, string) {
+	count, notReady := int32(0), ""
+	for _, status := range statuses {
+		switch {
+		case status.Ready:
+			count++
+		case notReady != "":
+		case status.Outcome == sharekubev1alpha1.OutcomePending:
+			notReady = fmt.Sprintf("%s %s is pending", status.Kind, status.Name)
+		case status.Outcome == sharekubev1alpha1.OutcomeCopied, status.Outcome == sharekubev1alpha1.OutcomeScaledDown:
+			notReady = fmt.Sprintf("%s %s: %s", status.Kind, status.Name, status.Message)
+		}
+	}
+	return count, notReady
+}
+
+// readinessTimedOut reports whether the preview exceeded its readiness timeout. The timeout only applies until
+// the preview first becomes Ready; later unreadiness, e.g. after waking up or a rolling restart, is not a failure.
+func readinessTimedOut(sharekube *sharekubev1alpha1.ShareKube) (bool, error) {
+	if sharekube.Spec.ReadinessTimeout == "" || sharekube.Status.CreationTime == nil || sharekube.Status.ReadyTime != nil {
+		return false, nil
+	}
+	timeout, err := time.ParseDuration(sharekube.Spec.ReadinessTimeout)
+	if err != nil {
+		return false, fmt.Errorf("invalid readiness timeout %q: %w", sharekube.Spec.ReadinessTimeout, err)
+	}
+	return time.Since(sharekube.Status.CreationTime.Time) > timeout, nil
+}
+
+// setReadyCondition sets the Ready condition kubectl wait and CI pipelines watch
+func setReadyCondition(sharekube *sharekubev1alpha1.ShareKube, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&sharekube.Status.Conditions, metav1.Condition{
+		Type:               sharekubev1alpha1.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: sharekube.Generation,
+	})
+}
+
+// waitForExpiration returns the result to requeue a Failed preview with, which is not retried but still expires
+func waitForExpiration(sharekube *sharekubev1alpha1.ShareKube) ctrl.Result {
+	if sharekube.Status.ExpirationTime == nil {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: time.Until(sharekube.Status.ExpirationTime.Time) + time.Second}
+}
+
+// ownerRequests maps a copy to the ShareKube named by its ownership labels, so changes of the copy trigger a reconcile
+func ownerRequests(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	name, namespace := labels["sharekube.dev/owner-name"], labels["sharekube.dev/owner-namespace"]
+	if name == "" || namespace == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}}
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestReadinessTimedOut(t *testing.T) {
+	created := metav1.NewTime(time.Now().Add(-time.Hour))
+	ready := metav1.Now()
+
+	tests := []struct {
+		name     string
+		timeout  string
+		created  *metav1.Time
+		ready    *metav1.Time
+		timedOut bool
+		wantErr  bool
+	}{
+		{name: "no timeout", created: &created},
+		{name: "not initialized yet", timeout: "5m"},
+		{name: "within the timeout", timeout: "2h", created: &created},
+		{name: "past the timeout", timeout: "30m", created: &created, timedOut: true},
+		{name: "ready once", timeout: "30m", created: &created, ready: &ready},
+		{name: "invalid timeout", timeout: "soon", created: &created, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := &sharekubev1alpha1.ShareKube{
+				Spec:   sharekubev1alpha1.ShareKubeSpec{ReadinessTimeout: tt.timeout},
+				Status: sharekubev1alpha1.ShareKubeStatus{CreationTime: tt.created, ReadyTime: tt.ready},
+			}
+			timedOut, err := readinessTimedOut(sk)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readinessTimedOut() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if timedOut != tt.timedOut {
+				t.Errorf("readinessTimedOut() = %v, want %v", timedOut, tt.timedOut)
+			}
+		})
+	}
+}
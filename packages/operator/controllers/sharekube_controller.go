@@ -2,40 +2,73 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/krm"
 	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
 )
 
 // ShareKubeReconciler reconciles a ShareKube object
 type ShareKubeReconciler struct {
 	client.Client
+	// APIReader reads from the API server, for source objects the label-scoped cache does not hold
+	APIReader          client.Reader
 	Scheme             *runtime.Scheme
 	Config             *rest.Config
 	DynClient          dynamic.Interface
 	PermissionsManager *PermissionsManager
+	// RequireShareOptIn only copies source objects annotated with sharekube.dev/share=allowed or sharekube.dev/share-with
+	RequireShareOptIn bool
+	// Quotas limits the number and size of concurrent previews
+	Quotas QuotaConfig
+	// FunctionAllowlist lists path globs of the executables KRM function pipelines may run
+	FunctionAllowlist []string
 }
 
 //+kubebuilder:rbac:groups=sharekube.dev,resources=sharekubes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=sharekube.dev,resources=sharekubes/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=sharekube.dev,resources=sharekubes/finalizers,verbs=update
-//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;create;update
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=resourcequotas;limitranges,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete;deletecollection
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=configmaps;services,verbs=list;watch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=list;watch
+//+kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots;volumesnapshotcontents,verbs=get;list;watch;create;delete;deletecollection
 
 // The ShareKubeFinalizer is used to clean up resources when a ShareKube resource is deleted
 const ShareKubeFinalizer = "sharekube.dev/finalizer"
@@ -101,10 +134,26 @@ func (r *ShareKubeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return r.handleDeletion(ctx, sharekube)
 	}
 
+	// Recompute expiration so recorded activity can extend an idle preview
+	expirationTime := computeExpiration(ctx, sharekube)
+	if !expirationTime.Equal(sharekube.Status.ExpirationTime) {
+		sharekube.Status.ExpirationTime = expirationTime
+		if err := r.Status().Update(ctx, sharekube); err != nil {
+			logger.Error(err, "Failed to update ShareKube status")
+			return ctrl.Result{}, err
+		}
+		logger.Info("Updated expiration time", "ExpirationTime", expirationTime.Time)
+	}
+
 	// Check if TTL has expired
 	if sharekube.Status.ExpirationTime != nil && sharekube.Status.ExpirationTime.Before(&metav1.Time{Time: time.Now()}) {
 		logger.Info("TTL expired, deleting ShareKube resource")
 
+		// Give the preDelete hooks a chance to run while the copies still exist
+		if done, result := r.runPreDeleteHooks(ctx, sharekube); !done {
+			return result, nil
+		}
+
 		// Clean up resources using our label selector
 		err := r.cleanupResourcesWithLabels(ctx, sharekube)
 		if err != nil {
@@ -123,6 +172,70 @@ func (r *ShareKubeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, nil
 	}
 
+	// Failed previews are not retried, they wait for their expiration, unless an atomic copy was rolled back
+	if sharekube.Status.Phase == "Failed" {
+		if sharekube.Status.NextAttemptTime == nil {
+			return waitForExpiration(sharekube), nil
+		}
+		if wait := time.Until(sharekube.Status.NextAttemptTime.Time); wait > 0 {
+			return waitForAttempt(sharekube, wait), nil
+		}
+		logger.Info("Retrying atomic copy", "Attempt", sharekube.Status.Attempts+1)
+		sharekube.Status.Phase = "Processing"
+		sharekube.Status.NextAttemptTime = nil
+	}
+
+	// Hold back new previews that would exceed a quota
+	if sharekube.Status.Phase == "Initializing" || sharekube.Status.Phase == "Pending" {
+		message, err := r.enforceQuotas(ctx, sharekube)
+		if err != nil {
+			logger.Error(err, "Failed to enforce quotas")
+			return ctrl.Result{}, err
+		}
+
+		if message != "" {
+			logger.Info("Quota exceeded, waiting for capacity", "Reason", message)
+			sharekube.Status.Phase = "Pending"
+			meta.SetStatusCondition(&sharekube.Status.Conditions, metav1.Condition{
+				Type:               sharekubev1alpha1.ConditionQuotaExceeded,
+				Status:             metav1.ConditionTrue,
+				Reason:             "QuotaExceeded",
+				Message:            message,
+				ObservedGeneration: sharekube.Generation,
+			})
+			if err := r.Status().Update(ctx, sharekube); err != nil {
+				logger.Error(err, "Failed to update ShareKube status")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+
+		sharekube.Status.Phase = "Initializing"
+		if r.Quotas.enabled() {
+			meta.SetStatusCondition(&sharekube.Status.Conditions, metav1.Condition{
+				Type:               sharekubev1alpha1.ConditionQuotaExceeded,
+				Status:             metav1.ConditionFalse,
+				Reason:             "WithinQuota",
+				Message:            "Preview fits within configured quotas",
+				ObservedGeneration: sharekube.Generation,
+			})
+			// Persist the admission before copying, so the next preview counts this one
+			if err := r.Status().Update(ctx, sharekube); err != nil {
+				logger.Error(err, "Failed to update ShareKube status")
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// Clean up the previous target namespace when the preview moves to another one
+	if sharekube.Status.TargetNamespace != "" && sharekube.Status.TargetNamespace != sharekube.Spec.TargetNamespace {
+		if err := r.leaveTargetNamespace(ctx, sharekube); err != nil {
+			logger.Error(err, "Failed to clean up the previous target namespace")
+			return ctrl.Result{}, err
+		}
+	}
+	sharekube.Status.TargetNamespace = sharekube.Spec.TargetNamespace
+
 	// Ensure dynamic permissions
 	if err := r.PermissionsManager.EnsurePermissions(ctx, sharekube); err != nil {
 		logger.Error(err, "Failed to ensure dynamic permissions")
@@ -154,6 +267,39 @@ func (r *ShareKubeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		}
 	}
 
+	// Claim the target namespace so other ShareKubes do not write to it, unless they all share it
+	holders, err := r.claimTargetNamespace(ctx, sharekube, targetNamespace)
+	if err != nil {
+		logger.Error(err, "Failed to claim target namespace")
+		return ctrl.Result{}, err
+	}
+	claimed := claimedCondition(sharekube, holders)
+	meta.SetStatusCondition(&sharekube.Status.Conditions, claimed)
+	if len(holders) > 0 {
+		logger.Info("Target namespace is claimed by another ShareKube, waiting for it to be released",
+			"Namespace", sharekube.Spec.TargetNamespace,
+			"Holders", holders)
+		sharekube.Status.Phase = "Pending"
+		setReadyCondition(sharekube, metav1.ConditionFalse, "TargetNamespaceClaimed", claimed.Message)
+		if err := r.Status().Update(ctx, sharekube); err != nil {
+			logger.Error(err, "Failed to update ShareKube status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+
+	// Isolate the target namespace before any workload is copied into it
+	if err := r.ensureIsolation(ctx, sharekube); err != nil {
+		logger.Error(err, "Failed to ensure isolation NetworkPolicies")
+		return ctrl.Result{}, err
+	}
+
+	// Provision the ResourceQuota and LimitRange before workloads are copied
+	if err := r.ensureNamespaceLimits(ctx, sharekube); err != nil {
+		logger.Error(err, "Failed to ensure namespace limits")
+		return ctrl.Result{}, err
+	}
+
 	// Update status to Processing if still Initializing
 	if sharekube.Status.Phase == "Initializing" {
 		sharekube.Status.Phase = "Processing"
@@ -163,8 +309,26 @@ func (r *ShareKubeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		}
 	}
 
+	// Run the preCopy hooks before anything is copied
+	if state, err := r.runHooks(ctx, sharekube, sharekubev1alpha1.HookStagePreCopy); err != nil {
+		logger.Error(err, "Failed to run preCopy hooks")
+		return ctrl.Result{}, err
+	} else if state != sharekubev1alpha1.HookSucceeded {
+		if state == sharekubev1alpha1.HookFailed {
+			sharekube.Status.Phase = "Failed"
+			setReadyCondition(sharekube, metav1.ConditionFalse, "HookFailed", "A preCopy hook failed, see status.hooks")
+		} else {
+			setReadyCondition(sharekube, metav1.ConditionFalse, "HooksRunning", "Waiting for the preCopy hooks")
+		}
+		if err := r.Status().Update(ctx, sharekube); err != nil {
+			logger.Error(err, "Failed to update ShareKube status")
+			return ctrl.Result{}, err
+		}
+		return waitForHooks(sharekube, state), nil
+	}
+
 	// Process resources to copy
-	copiedResources, err := r.processResources(ctx, sharekube)
+	copiedResources, resourceStatuses, err := r.processResources(ctx, sharekube)
 	if err != nil {
 		logger.Error(err, "Failed to process resources")
 		sharekube.Status.Phase = "Error"
@@ -175,22 +339,124 @@ func (r *ShareKubeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	// Roll back an atomic preview that could not copy every resource, until it becomes Ready
+	if failed := failedResource(resourceStatuses); failed != nil && sharekube.Spec.Atomic && sharekube.Status.ReadyTime == nil {
+		return r.rollback(ctx, sharekube, resourceStatuses, *failed)
+	}
+
+	// Requeue to check TTL expiration, or sooner while copies wait for volume snapshots or earlier waves
+	requeueAfter := 5 * time.Minute
+	if hasPendingResources(resourceStatuses) {
+		requeueAfter = pendingRequeueInterval
+	}
+	phase := "Ready"
+
+	// Hibernate outside the schedule's active windows and wake up inside them
+	if sharekube.Spec.Schedule != nil || sharekube.Status.Phase == "Hibernating" {
+		active := true
+		if sharekube.Spec.Schedule != nil {
+			var next time.Time
+			active, next, err = scheduleState(sharekube.Spec.Schedule, time.Now())
+			if err != nil {
+				logger.Error(err, "Invalid schedule")
+				sharekube.Status.Phase = "Error"
+				if err := r.Status().Update(ctx, sharekube); err != nil {
+					logger.Error(err, "Failed to update ShareKube status")
+				}
+				return ctrl.Result{}, err
+			}
+			// Requeue right after the next window boundary
+			if !next.IsZero() && time.Until(next)+time.Second < requeueAfter {
+				requeueAfter = time.Until(next) + time.Second
+			}
+		}
+
+		if active {
+			if err := r.wake(ctx, sharekube); err != nil {
+				logger.Error(err, "Failed to wake preview")
+				return ctrl.Result{}, err
+			}
+		} else {
+			if err := r.hibernate(ctx, sharekube); err != nil {
+				logger.Error(err, "Failed to hibernate preview")
+				return ctrl.Result{}, err
+			}
+			phase = "Hibernating"
+		}
+	}
+
+	// The preview is Ready once every copy is ready and the postCopy hooks, which start then, succeeded
+	readyResources, notReady := summarizeReadiness(resourceStatuses)
+	reason := "ResourcesNotReady"
+	state := sharekubev1alpha1.HookSucceeded
+	if notReady == "" {
+		if state, err = r.runHooks(ctx, sharekube, sharekubev1alpha1.HookStagePostCopy); err != nil {
+			logger.Error(err, "Failed to run postCopy hooks")
+			return ctrl.Result{}, err
+		}
+	} else if len(hooksFor(sharekube, sharekubev1alpha1.HookStagePostCopy)) > 0 {
+		state = sharekubev1alpha1.HookRunning
+	}
+	switch {
+	case state == sharekubev1alpha1.HookFailed:
+		phase = "Failed"
+		reason, notReady = "HookFailed", "A postCopy hook failed, see status.hooks"
+	case state == sharekubev1alpha1.HookRunning && notReady == "":
+		reason, notReady = "HooksRunning", "Waiting for the postCopy hooks"
+	}
+
+	if notReady != "" && phase == "Ready" {
+		phase = "Processing"
+		if requeueAfter > pendingRequeueInterval {
+			requeueAfter = pendingRequeueInterval
+		}
+
+		timedOut, err := readinessTimedOut(sharekube)
+		if err != nil {
+			logger.Error(err, "Invalid readiness timeout")
+			sharekube.Status.Phase = "Error"
+			if err := r.Status().Update(ctx, sharekube); err != nil {
+				logger.Error(err, "Failed to update ShareKube status")
+			}
+			return ctrl.Result{}, err
+		}
+		if timedOut {
+			logger.Info("Preview did not become ready in time", "Timeout", sharekube.Spec.ReadinessTimeout, "Reason", notReady)
+			phase = "Failed"
+			reason, notReady = "ReadinessTimeout", fmt.Sprintf("Not ready after %s: %s", sharekube.Spec.ReadinessTimeout, notReady)
+		}
+	}
+
+	switch phase {
+	case "Ready":
+		setReadyCondition(sharekube, metav1.ConditionTrue, "ResourcesReady", fmt.Sprintf("%d copies are ready", readyResources))
+		if sharekube.Status.ReadyTime == nil {
+			now := metav1.Now()
+			sharekube.Status.ReadyTime = &now
+		}
+	case "Hibernating":
+		setReadyCondition(sharekube, metav1.ConditionFalse, "Hibernating", "The preview is hibernating outside its active windows")
+	default:
+		setReadyCondition(sharekube, metav1.ConditionFalse, reason, notReady)
+	}
+
 	// Update status with copied resources
 	sharekube.Status.CopiedResources = copiedResources
-	sharekube.Status.Phase = "Ready"
+	sharekube.Status.Resources = resourceStatuses
+	sharekube.Status.ReadyResources = readyResources
+	sharekube.Status.Phase = phase
 	if err := r.Status().Update(ctx, sharekube); err != nil {
 		logger.Error(err, "Failed to update ShareKube status")
 		return ctrl.Result{}, err
 	}
 
-	// Requeue to check TTL expiration
-	return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
 // processResources copies the specified resources from source to target namespace
-func (r *ShareKubeReconciler) processResources(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) ([]string, error) {
+func (r *ShareKubeReconciler) processResources(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) ([]string, []sharekubev1alpha1.ResourceStatus, error) {
 	logger := log.FromContext(ctx)
-	var copiedResources []string
+	var statuses []sharekubev1alpha1.ResourceStatus
 
 	// Create owner reference for all copied resources
 	ownerRef := metav1.OwnerReference{
@@ -211,34 +477,234 @@ func (r *ShareKubeReconciler) processResources(ctx context.Context, sharekube *s
 		sharekube.Name,
 		sharekube.Namespace,
 	)
+	resourceHandler.SetRequireShareOptIn(r.RequireShareOptIn)
+	resourceHandler.SetScalingRules(sharekube.Spec.Scaling)
+	resourceHandler.SetReferenceRewrite(sharekube.Spec.ReferenceRewrite)
+	resourceHandler.SetNameTemplate(sharekube.Spec.NameTemplate, sharekube.Spec.Resources)
+	resourceHandler.SetHostRewrite(sharekube.Spec.Hosts)
+	resourceHandler.SetServiceTypePolicy(sharekube.Spec.ServiceTypePolicy)
+	resourceHandler.SetSecretPolicy(sharekube.Spec.SecretPolicy)
+	resourceHandler.SetVolumeCopy(sharekube.Spec.VolumeCopy)
+	resourceHandler.SetDriftPolicy(sharekube.Spec.DriftPolicy)
+	resourceHandler.SetConflictPolicy(sharekube.Spec.ConflictPolicy)
+	if err := resourceHandler.SetConfigMapPolicy(sharekube.Spec.ConfigMapPolicy); err != nil {
+		logger.Error(err, "Invalid ConfigMap policy")
+		return nil, nil, err
+	}
+	if err := resourceHandler.SetTransformationRules(sharekube.Spec.TransformationRules); err != nil {
+		logger.Error(err, "Invalid transformation rules")
+		return nil, nil, err
+	}
+
+	// Stage the copies for the KRM function pipeline, which writes them once all resources are prepared
+	var functionResults []krm.FunctionResult
+	if len(sharekube.Spec.Functions) > 0 {
+		runner := krm.NewRunner(r.FunctionAllowlist)
+		resourceHandler.SetTransformer(func(ctx context.Context, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+			transformed, results, err := runner.Run(ctx, sharekube.Spec.Functions, objects)
+			functionResults = results
+			return transformed, err
+		})
+	}
+
+	// writeStaged transforms and writes the copies staged since its last call, and reports whether that succeeded
+	written := 0
+	writeStaged := func() bool {
+		if len(sharekube.Spec.Functions) == 0 {
+			return true
+		}
+		err := resourceHandler.Flush(ctx)
+		meta.SetStatusCondition(&sharekube.Status.Conditions, transformedCondition(sharekube, functionResults, err))
+		if err != nil {
+			logger.Error(err, "Failed to run transformation pipeline")
+			for i := written; i < len(statuses); i++ {
+				if statuses[i].Outcome == sharekubev1alpha1.OutcomeCopied || statuses[i].Outcome == sharekubev1alpha1.OutcomeScaledDown {
+					statuses[i].Outcome = sharekubev1alpha1.OutcomeFailed
+					statuses[i].Message = fmt.Sprintf("transformation pipeline failed: %v", err)
+				}
+			}
+		}
+		written = len(statuses)
+		return err == nil
+	}
+
+	// Track the provisioned ResourceQuota so workloads that do not fit are rejected or scaled down
+	budget := newQuotaBudget(sharekube.Spec.Limits)
+
+	ordered := orderedResources(sharekube.Spec.Resources)
+	heldBack := false
+	for i, resource := range ordered {
+		// Copy a wave only once the copies of the previous waves are ready
+		if i > 0 && resource.Wave != ordered[i-1].Wave {
+			if !writeStaged() {
+				statuses = append(statuses, heldBackStatuses(sharekube, ordered[i:], sharekubev1alpha1.OutcomeFailed,
+					"not copied because the transformation pipeline of an earlier wave failed")...)
+				heldBack = true
+				break
+			}
+			if message := checkReadiness(ctx, resourceHandler, sharekube.Spec.TargetNamespace, statuses); message != "" {
+				logger.Info("Waiting for the previous waves to become ready", "Wave", resource.Wave, "Reason", message)
+				statuses = append(statuses, heldBackStatuses(sharekube, ordered[i:], sharekubev1alpha1.OutcomePending,
+					fmt.Sprintf("waiting for the previous waves to become ready: %s", message))...)
+				heldBack = true
+				break
+			}
+		}
 
-	for _, resource := range sharekube.Spec.Resources {
 		resourceNamespace := resource.Namespace
 		if resourceNamespace == "" {
 			resourceNamespace = sharekube.Namespace
 		}
 
+		status := sharekubev1alpha1.ResourceStatus{
+			Kind:      resource.Kind,
+			Name:      resource.Name,
+			Namespace: resourceNamespace,
+			Outcome:   sharekubev1alpha1.OutcomeCopied,
+		}
+		if sharekube.Spec.NameTemplate != "" {
+			targetName, err := resources.RenderName(sharekube.Spec.NameTemplate, resource.Name)
+			if err != nil {
+				logger.Error(err, "Failed to render name template",
+					"Kind", resource.Kind,
+					"Name", resource.Name,
+					"SourceNamespace", resourceNamespace)
+				status.Outcome = sharekubev1alpha1.OutcomeFailed
+				status.Message = err.Error()
+				statuses = append(statuses, status)
+				continue
+			}
+			status.TargetName = targetName
+		}
+
 		logger.Info("Copying resource",
 			"Kind", resource.Kind,
 			"Name", resource.Name,
 			"SourceNamespace", resourceNamespace,
 			"TargetNamespace", sharekube.Spec.TargetNamespace)
 
+		var opts []resources.CopyOption
+		if resource.SkipReferenceRewrite {
+			opts = append(opts, resources.WithoutReferenceRewrite())
+		}
+		if resource.VolumeCopyMode != "" {
+			opts = append(opts, resources.WithVolumeCopyMode(resource.VolumeCopyMode))
+		}
+		if resource.ConflictPolicy != "" {
+			opts = append(opts, resources.WithConflictPolicy(resource.ConflictPolicy))
+		}
+		status.Snapshot = snapshotNameFor(sharekube, resource, resourceNamespace)
+
+		var footprint *resources.WorkloadFootprint
+		replicas := int32(0)
+		if budget != nil {
+			var err error
+			footprint, err = resources.GetWorkloadFootprint(ctx, r.APIReader, resource.Kind, resource.Name, resourceNamespace)
+			if err != nil {
+				logger.Error(err, "Failed to get workload footprint",
+					"Kind", resource.Kind,
+					"Name", resource.Name,
+					"SourceNamespace", resourceNamespace)
+				status.Outcome = sharekubev1alpha1.OutcomeFailed
+				status.Message = err.Error()
+				statuses = append(statuses, status)
+				continue
+			}
+
+			if footprint != nil {
+				// Check the quota against the size the copy will have after scaling
+				if err := footprint.ApplyScaling(sharekube.Spec.Scaling); err != nil {
+					logger.Error(err, "Failed to apply scaling rules",
+						"Kind", resource.Kind,
+						"Name", resource.Name,
+						"SourceNamespace", resourceNamespace)
+					status.Outcome = sharekubev1alpha1.OutcomeFailed
+					status.Message = err.Error()
+					statuses = append(statuses, status)
+					continue
+				}
+
+				replicas, status.Outcome, status.Message = budget.admit(footprint)
+				if status.Outcome == sharekubev1alpha1.OutcomeRejected {
+					logger.Info("Rejecting resource that does not fit the ResourceQuota",
+						"Kind", resource.Kind,
+						"Name", resource.Name,
+						"SourceNamespace", resourceNamespace,
+						"Reason", status.Message)
+					statuses = append(statuses, status)
+					continue
+				}
+				if status.Outcome == sharekubev1alpha1.OutcomeScaledDown {
+					opts = append(opts, resources.WithReplicas(replicas))
+				}
+			}
+		}
+
 		// Use the resource handler to copy the resource
-		err := resourceHandler.CopyResource(ctx, resource.Kind, resource.Name, resourceNamespace, sharekube.Spec.TargetNamespace)
+		err := resourceHandler.CopyResource(ctx, resource.Kind, resource.Name, resourceNamespace, sharekube.Spec.TargetNamespace, opts...)
+		if errors.Is(err, resources.ErrNotShareable) || errors.Is(err, resources.ErrDropped) || errors.Is(err, resources.ErrConflictSkipped) {
+			logger.Info("Skipping resource",
+				"Kind", resource.Kind,
+				"Name", resource.Name,
+				"SourceNamespace", resourceNamespace,
+				"Reason", err.Error())
+			status.Outcome = sharekubev1alpha1.OutcomeSkipped
+			status.Message = err.Error()
+			statuses = append(statuses, status)
+			continue
+		}
+		if errors.Is(err, resources.ErrSnapshotPending) {
+			logger.Info("Waiting for volume snapshot",
+				"Kind", resource.Kind,
+				"Name", resource.Name,
+				"SourceNamespace", resourceNamespace,
+				"Reason", err.Error())
+			status.Outcome = sharekubev1alpha1.OutcomePending
+			status.Message = err.Error()
+			statuses = append(statuses, status)
+			continue
+		}
 		if err != nil {
 			logger.Error(err, "Failed to copy resource",
 				"Kind", resource.Kind,
 				"Name", resource.Name,
 				"SourceNamespace", resourceNamespace)
+			status.Outcome = sharekubev1alpha1.OutcomeFailed
+			status.Message = err.Error()
+			statuses = append(statuses, status)
 			continue
 		}
 
-		resourceRef := fmt.Sprintf("%s/%s/%s", resource.Kind, resourceNamespace, resource.Name)
-		copiedResources = append(copiedResources, resourceRef)
+		if footprint != nil {
+			budget.commit(footprint, replicas)
+		}
+		status.SnapshotReady = status.Snapshot != ""
+		statuses = append(statuses, status)
+	}
+
+	// Transform and write the copies staged by the last wave, and check which copies are ready
+	if !heldBack {
+		writeStaged()
+		checkReadiness(ctx, resourceHandler, sharekube.Spec.TargetNamespace, statuses)
+	}
+
+	var copiedResources []string
+	for _, status := range statuses {
+		if status.Outcome == sharekubev1alpha1.OutcomeCopied || status.Outcome == sharekubev1alpha1.OutcomeScaledDown {
+			copiedResources = append(copiedResources, fmt.Sprintf("%s/%s/%s", status.Kind, status.Namespace, status.Name))
+		}
 	}
 
-	return copiedResources, nil
+	// Publish the preview URLs of the copied Ingresses and HTTPRoutes
+	sharekube.Status.Endpoints = resourceHandler.Endpoints()
+
+	// Report the copies that were edited in the preview or whose sources changed
+	recordDrift(sharekube, resourceHandler.Drift())
+
+	// Prune the copies of resources that were removed from the spec
+	updateInventory(ctx, sharekube, resourceHandler, statuses)
+
+	return copiedResources, statuses, nil
 }
 
 // handleDeletion performs cleanup when a ShareKube resource is being deleted
@@ -248,6 +714,11 @@ func (r *ShareKubeReconciler) handleDeletion(ctx context.Context, sharekube *sha
 
 	// Check if finalizer is present
 	if controllerutil.ContainsFinalizer(sharekube, ShareKubeFinalizer) {
+		// Give the preDelete hooks a chance to run while the copies still exist
+		if done, result := r.runPreDeleteHooks(ctx, sharekube); !done {
+			return result, nil
+		}
+
 		// Clean up dynamic permissions
 		if err := r.PermissionsManager.CleanupPermissions(ctx, sharekube); err != nil {
 			logger.Error(err, "Failed to clean up dynamic permissions")
@@ -409,6 +880,55 @@ func (r *ShareKubeReconciler) cleanupResourcesWithLabels(ctx context.Context, sh
 		logger.Info("Successfully deleted Secrets", "Namespace", sharekube.Spec.TargetNamespace)
 	}
 
+	// Delete generated resource quotas and limit ranges
+	err = clientset.CoreV1().ResourceQuotas(sharekube.Spec.TargetNamespace).DeleteCollection(
+		ctx, metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		logger.Error(err, "Failed to delete ResourceQuotas")
+	} else {
+		logger.Info("Successfully deleted ResourceQuotas", "Namespace", sharekube.Spec.TargetNamespace)
+	}
+
+	err = clientset.CoreV1().LimitRanges(sharekube.Spec.TargetNamespace).DeleteCollection(
+		ctx, metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		logger.Error(err, "Failed to delete LimitRanges")
+	} else {
+		logger.Info("Successfully deleted LimitRanges", "Namespace", sharekube.Spec.TargetNamespace)
+	}
+
+	// Delete generated network policies
+	err = clientset.NetworkingV1().NetworkPolicies(sharekube.Spec.TargetNamespace).DeleteCollection(
+		ctx, metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		logger.Error(err, "Failed to delete NetworkPolicies")
+	} else {
+		logger.Info("Successfully deleted NetworkPolicies", "Namespace", sharekube.Spec.TargetNamespace)
+	}
+
+	// Delete copied and hook Jobs along with their pods
+	err = clientset.BatchV1().Jobs(sharekube.Spec.TargetNamespace).DeleteCollection(
+		ctx, metav1.DeleteOptions{PropagationPolicy: &[]metav1.DeletionPropagation{metav1.DeletePropagationBackground}[0]},
+		metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		logger.Error(err, "Failed to delete Jobs")
+	} else {
+		logger.Info("Successfully deleted Jobs", "Namespace", sharekube.Spec.TargetNamespace)
+	}
+
+	// Delete the volume snapshots taken for copied claims
+	if err := r.cleanupVolumeSnapshots(ctx, sharekube); err != nil {
+		logger.Error(err, "Failed to delete VolumeSnapshots")
+	}
+
+	// Delete the remaining copies of the inventory, e.g. StatefulSets and Ingresses
+	r.pruneInventory(ctx, sharekube, false)
+
+	// Let other ShareKubes claim the namespace
+	if err := r.releaseTargetNamespace(ctx, sharekube); err != nil {
+		logger.Error(err, "Failed to release target namespace")
+	}
+
 	// Use dynamic client to delete any other resources that we might have created
 	// For brevity, we're omitting this, but in a real implementation you would use
 	// discovery to find all installed types and then delete those with our labels
@@ -417,14 +937,67 @@ func (r *ShareKubeReconciler) cleanupResourcesWithLabels(ctx context.Context, sh
 	return nil
 }
 
+// ownerLabels returns the labels that mark an object as owned by the ShareKube
+func ownerLabels(sharekube *sharekubev1alpha1.ShareKube) map[string]string {
+	return map[string]string{
+		"sharekube.dev/owner-name":      sharekube.Name,
+		"sharekube.dev/owner-namespace": sharekube.Namespace,
+	}
+}
+
+// mergeLabels adds the extra labels to the existing ones, allocating the map if needed
+func mergeLabels(labels, extra map[string]string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string, len(extra))
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
 // SetupWithManager sets up the controller with the Manager
 func (r *ShareKubeReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// Initialize PermissionsManager if not already set
 	if r.PermissionsManager == nil {
 		r.PermissionsManager = NewPermissionsManager(r.Client, r.Scheme)
 	}
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
 
+	// Copies carry ownership labels instead of owner references, which do not work across namespaces
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&sharekubev1alpha1.ShareKube{}).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(ownerRequests)).
+		Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(ownerRequests)).
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(ownerRequests)).
+		Watches(&corev1.PersistentVolumeClaim{}, handler.EnqueueRequestsFromMapFunc(ownerRequests)).
+		// Only metadata is cached for these, which is enough to notice edited and deleted copies.
+		// Secrets are not watched, so the operator cannot list them; copied Secrets are compared on the periodic requeue.
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(ownerRequests), builder.OnlyMetadata).
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(ownerRequests), builder.OnlyMetadata).
+		Watches(&networkingv1.Ingress{}, handler.EnqueueRequestsFromMapFunc(ownerRequests), builder.OnlyMetadata).
 		Complete(r)
 }
+
+// CacheOptions restricts the informers behind the watches to copies, which carry the ownership labels,
+// so the operator does not cache every object of the watched kinds in the cluster
+func CacheOptions() cache.Options {
+	owned, err := labels.NewRequirement("sharekube.dev/owner-name", selection.Exists, nil)
+	if err != nil {
+		panic(err)
+	}
+	copies := cache.ByObject{Label: labels.NewSelector().Add(*owned)}
+	return cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			&appsv1.Deployment{}:            copies,
+			&appsv1.StatefulSet{}:           copies,
+			&batchv1.Job{}:                  copies,
+			&corev1.PersistentVolumeClaim{}: copies,
+			&corev1.ConfigMap{}:             copies,
+			&corev1.Service{}:               copies,
+			&networkingv1.Ingress{}:         copies,
+		},
+	}
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/krm"
+)
+
+// maxConditionMessage is the maximum length of a condition message accepted by the API server
+const maxConditionMessage = 32768
+
+// transformedCondition summarizes the outcome and results of the KRM function pipeline
+func transformedCondition(sharekube *sharekubev1alpha1.ShareKube, results []krm.FunctionResult, err error) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               sharekubev1alpha1.ConditionTransformed,
+		Status:             metav1.ConditionTrue,
+		Reason:             "PipelineSucceeded",
+		ObservedGeneration: sharekube.Generation,
+	}
+
+	var lines []string
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "PipelineFailed"
+		lines = append(lines, err.Error())
+	}
+	for _, result := range results {
+		severity := result.Severity
+		if severity == "" {
+			severity = krm.SeverityInfo
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s: %s", result.Function, severity, result.Message))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, fmt.Sprintf("%d functions ran without results", len(sharekube.Spec.Functions)))
+	}
+
+	condition.Message = strings.Join(lines, "\n")
+	if len(condition.Message) > maxConditionMessage {
+		condition.Message = condition.Message[:maxConditionMessage]
+	}
+	return condition
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+// pendingRequeueInterval is how often copies waiting for a volume snapshot or an earlier wave are retried
+const pendingRequeueInterval = 10 * time.Second
+
+// snapshotNameFor returns the VolumeSnapshot a copied claim is restored from, or "" if it is not restored from one
+func snapshotNameFor(sharekube *sharekubev1alpha1.ShareKube, resource sharekubev1alpha1.Resource, sourceNamespace string) string {
+	if resource.Kind != "PersistentVolumeClaim" {
+		return ""
+	}
+	mode := resource.VolumeCopyMode
+	if mode == "" && sharekube.Spec.VolumeCopy != nil {
+		mode = sharekube.Spec.VolumeCopy.Mode
+	}
+	switch {
+	case mode == resources.VolumeCopySnapshot,
+		mode == resources.VolumeCopyClone && sourceNamespace != sharekube.Spec.TargetNamespace:
+		return resources.SnapshotName(sharekube.Name, resource.Name)
+	}
+	return ""
+}
+
+// hasPendingResources reports whether a copy waits for something to become ready
+func hasPendingResources(statuses []sharekubev1alpha1.ResourceStatus) bool {
+	for _, status := range statuses {
+		if status.Outcome == sharekubev1alpha1.OutcomePending {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupVolumeSnapshots deletes the snapshots taken for the ShareKube in the target and source namespaces,
+// and the VolumeSnapshotContents that imported them into the target namespace
+func (r *ShareKubeReconciler) cleanupVolumeSnapshots(ctx context.Context, sharekube *sharekubev1alpha1.ShareKube) error {
+	logger := log.FromContext(ctx)
+	listOptions := metav1.ListOptions{LabelSelector: fmt.Sprintf(
+		"sharekube.dev/owner-name=%s,sharekube.dev/owner-namespace=%s",
+		sharekube.Name,
+		sharekube.Namespace,
+	)}
+
+	// The target namespace goes first so imported snapshots release their contents
+	namespaces := []string{sharekube.Spec.TargetNamespace}
+	seen := map[string]bool{sharekube.Spec.TargetNamespace: true}
+	for _, resource := range sharekube.Spec.Resources {
+		namespace := resource.Namespace
+		if namespace == "" {
+			namespace = sharekube.Namespace
+		}
+		if !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	for i, namespace := range namespaces {
+		err := r.DynClient.Resource(resources.VolumeSnapshotGVR).Namespace(namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, listOptions)
+		if isMissingAPI(err) {
+			// Snapshot CRDs are not installed, so there is nothing to clean up
+			return nil
+		}
+		if err != nil {
+			logger.Error(err, "Failed to delete VolumeSnapshots", "Namespace", namespace)
+			return err
+		}
+		logger.Info("Successfully deleted VolumeSnapshots", "Namespace", namespace)
+
+		// Imported contents are retained when their snapshot is deleted
+		if i == 0 {
+			err := r.DynClient.Resource(resources.VolumeSnapshotContentGVR).DeleteCollection(ctx, metav1.DeleteOptions{}, listOptions)
+			if err != nil && !isMissingAPI(err) {
+				logger.Error(err, "Failed to delete VolumeSnapshotContents")
+				return err
+			}
+			logger.Info("Successfully deleted VolumeSnapshotContents")
+		}
+	}
+	return nil
+}
+
+// isMissingAPI reports whether an error means the resource is not served by the cluster
+func isMissingAPI(err error) bool {
+	return err != nil && (apierrors.IsNotFound(err) || meta.IsNoMatchError(err))
+}
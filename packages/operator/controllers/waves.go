@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"sort"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+// orderedResources sorts the resources by wave, and within a wave by kind so the objects workloads depend on
+// are copied first. Resources of the same wave and kind keep their order.
+func orderedResources(list []sharekubev1alpha1.Resource) []sharekubev1alpha1.Resource {
+	ordered := append([]sharekubev1alpha1.Resource(nil), list...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Wave != ordered[j].Wave {
+			return ordered[i].Wave < ordered[j].Wave
+		}
+		return resources.KindPriority(ordered[i].Kind) < resources.KindPriority(ordered[j].Kind)
+	})
+	return ordered
+}
+
+// heldBackStatuses reports resources that were not copied because an earlier wave is not done
+func heldBackStatuses(sharekube *sharekubev1alpha1.ShareKube, list []sharekubev1alpha1.Resource, outcome, message string) []sharekubev1alpha1.ResourceStatus {
+	statuses := make([]sharekubev1alpha1.ResourceStatus, 0, len(list))
+	for _, resource := range list {
+		namespace := resource.Namespace
+		if namespace == "" {
+			namespace = sharekube.Namespace
+		}
+		status := sharekubev1alpha1.ResourceStatus{
+			Kind:      resource.Kind,
+			Name:      resource.Name,
+			Namespace: namespace,
+			Outcome:   outcome,
+			Message:   message,
+		}
+		if sharekube.Spec.NameTemplate != "" {
+			status.TargetName, _ = resources.RenderName(sharekube.Spec.NameTemplate, resource.Name)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
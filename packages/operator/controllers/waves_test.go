@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestOrderedResources(t *testing.T) {
+	tests := []struct {
+		name string
+		list []sharekubev1alpha1.Resource
+		want []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "dependencies before workloads",
+			list: []sharekubev1alpha1.Resource{
+				{Kind: "Deployment", Name: "api"},
+				{Kind: "Service", Name: "api"},
+				{Kind: "Secret", Name: "creds"},
+				{Kind: "ConfigMap", Name: "settings"},
+				{Kind: "ServiceAccount", Name: "api"},
+				{Kind: "Namespace", Name: "shared"},
+			},
+			want: []string{"Namespace/shared", "ServiceAccount/api", "ConfigMap/settings", "Secret/creds", "Service/api", "Deployment/api"},
+		},
+		{
+			name: "waves before kinds",
+			list: []sharekubev1alpha1.Resource{
+				{Kind: "ConfigMap", Name: "late", Wave: 1},
+				{Kind: "Deployment", Name: "db", Wave: -1},
+				{Kind: "Deployment", Name: "api"},
+				{Kind: "Secret", Name: "creds"},
+			},
+			want: []string{"Deployment/db", "Secret/creds", "Deployment/api", "ConfigMap/late"},
+		},
+		{
+			name: "unknown kinds go with the workloads and keep their order",
+			list: []sharekubev1alpha1.Resource{
+				{Kind: "HorizontalPodAutoscaler", Name: "api"},
+				{Kind: "Deployment", Name: "b"},
+				{Kind: "Widget", Name: "w"},
+				{Kind: "Deployment", Name: "a"},
+				{Kind: "ConfigMap", Name: "settings"},
+			},
+			want: []string{"ConfigMap/settings", "Deployment/b", "Widget/w", "Deployment/a", "HorizontalPodAutoscaler/api"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := append([]sharekubev1alpha1.Resource(nil), tt.list...)
+			var got []string
+			for _, resource := range orderedResources(tt.list) {
+				got = append(got, resource.Kind+"/"+resource.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderedResources() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.list, input) {
+				t.Errorf("orderedResources() reordered its input to %v", tt.list)
+			}
+		})
+	}
+}
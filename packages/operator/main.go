@@ -3,10 +3,14 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -15,6 +19,8 @@ import (
 
 	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
 	"github.com/miloszsobczak/sharekube/packages/operator/controllers"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/activity"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/webhook"
 )
 
 var (
@@ -30,12 +36,47 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var enableWebhooks bool
 	var probeAddr string
+	var activityAddr string
+	var activityCertDir string
+	var activityInsecure bool
+	var requireShareOptIn bool
+	var quotas controllers.QuotaConfig
+	var maxCPU, maxMemory string
+	var functionAllowlist string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8888", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&activityAddr, "activity-bind-address", "",
+		"The address the activity endpoint binds to (e.g. :8082). Leave empty to disable idle tracking pings.")
+	flag.StringVar(&activityCertDir, "activity-cert-dir", filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs"),
+		"Directory holding the tls.crt and tls.key the activity endpoint is served with. Defaults to the webhook server's certificate directory.")
+	flag.BoolVar(&activityInsecure, "activity-insecure", false,
+		"Serve the activity endpoint over plain HTTP. Bearer tokens are then sent in the clear; only use this for local testing.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the mutating and validating admission webhooks for ShareKubes on port 9443. "+
+			"Requires a serving certificate in the webhook server's certificate directory.")
+	flag.BoolVar(&requireShareOptIn, "require-share-opt-in", false,
+		"Only copy source objects that opt in with the sharekube.dev/share=allowed "+
+			"or sharekube.dev/share-with annotation.")
+	flag.IntVar(&quotas.MaxPerSourceNamespace, "max-previews-per-namespace", 0,
+		"Maximum number of concurrent ShareKubes per source namespace (0 means unlimited).")
+	flag.IntVar(&quotas.MaxPerCreator, "max-previews-per-creator", 0,
+		"Maximum number of concurrent ShareKubes per creator (0 means unlimited). Requires --enable-webhooks.")
+	flag.IntVar(&quotas.MaxTotal, "max-previews", 0,
+		"Maximum number of concurrent ShareKubes in the cluster (0 means unlimited).")
+	flag.StringVar(&maxCPU, "max-preview-cpu", "",
+		"Maximum aggregate CPU requests of copied workloads across all previews (e.g. 20).")
+	flag.StringVar(&maxMemory, "max-preview-memory", "",
+		"Maximum aggregate memory requests of copied workloads across all previews (e.g. 64Gi).")
+	flag.BoolVar(&quotas.EvictOldest, "evict-oldest-preview", false,
+		"Delete the oldest previews when a quota is exceeded instead of holding back new ones.")
+	flag.StringVar(&functionAllowlist, "krm-function-allowlist", "",
+		"Comma-separated path globs of the executables KRM function pipelines may run (e.g. /usr/local/bin/krm-*). "+
+			"Leave empty to only allow builtin functions.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -44,6 +85,29 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if maxCPU != "" {
+		q, err := resource.ParseQuantity(maxCPU)
+		if err != nil {
+			setupLog.Error(err, "invalid --max-preview-cpu")
+			os.Exit(1)
+		}
+		quotas.MaxCPU = q
+	}
+	if maxMemory != "" {
+		q, err := resource.ParseQuantity(maxMemory)
+		if err != nil {
+			setupLog.Error(err, "invalid --max-preview-memory")
+			os.Exit(1)
+		}
+		quotas.MaxMemory = q
+	}
+
+	// Only the webhook can vouch for the sharekube.dev/creator annotation, which users could otherwise set freely
+	if quotas.MaxPerCreator > 0 && !enableWebhooks {
+		setupLog.Error(nil, "--max-previews-per-creator requires --enable-webhooks")
+		os.Exit(1)
+	}
+
 	// Get a config to talk to the apiserver
 	config := ctrl.GetConfigOrDie()
 
@@ -61,6 +125,7 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "sharekube-leader.sharekube.dev",
+		Cache:                  controllers.CacheOptions(),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -72,15 +137,47 @@ func main() {
 
 	if err = (&controllers.ShareKubeReconciler{
 		Client:             mgr.GetClient(),
+		APIReader:          mgr.GetAPIReader(),
 		Scheme:             mgr.GetScheme(),
 		Config:             mgr.GetConfig(),
 		DynClient:          dynClient,
 		PermissionsManager: permissionsManager,
+		RequireShareOptIn:  requireShareOptIn,
+		Quotas:             quotas,
+		FunctionAllowlist:  splitList(functionAllowlist),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ShareKube")
 		os.Exit(1)
 	}
 
+	// Record the creators of ShareKubes and reject invalid ones on admission
+	if enableWebhooks {
+		if err = (&webhook.ShareKubeWebhook{}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ShareKube")
+			os.Exit(1)
+		}
+	}
+
+	// Serve activity pings that extend idle previews
+	if activityAddr != "" {
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			setupLog.Error(err, "unable to create clientset")
+			os.Exit(1)
+		}
+		certDir := activityCertDir
+		if activityInsecure {
+			certDir = ""
+		} else if _, err := os.Stat(filepath.Join(certDir, "tls.crt")); err != nil {
+			setupLog.Error(err, "the activity endpoint requires a serving certificate, set --activity-cert-dir or --activity-insecure")
+			os.Exit(1)
+		}
+		if err := mgr.Add(activity.NewServer(activityAddr, certDir, mgr.GetClient(), clientset)); err != nil {
+			setupLog.Error(err, "unable to set up activity endpoint")
+			os.Exit(1)
+		}
+	}
+
 	// Add health check handlers
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
@@ -97,3 +194,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
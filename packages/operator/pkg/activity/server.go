@@ -0,0 +1,222 @@
+package activity
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// LastActivityAnnotation records when a preview was last used, as an RFC 3339 timestamp
+const LastActivityAnnotation = "sharekube.dev/last-activity"
+
+// pathPrefix is the URL prefix of the activity endpoint, followed by <namespace>/<name>
+const pathPrefix = "/activity/"
+
+// Server is an HTTPS endpoint that records activity on ShareKube resources.
+// Callers authenticate with a Kubernetes bearer token and must be allowed to update the ShareKube.
+type Server struct {
+	addr      string
+	client    client.Client
+	clientset kubernetes.Interface
+	// Directory holding the tls.crt and tls.key serving certificate; empty serves plain HTTP
+	certDir string
+}
+
+// NewServer creates a new activity Server listening on addr, serving the certificate in certDir.
+// Bearer tokens are sent in the clear when certDir is empty, so that is only meant for local testing.
+func NewServer(addr, certDir string, client client.Client, clientset kubernetes.Interface) *Server {
+	return &Server{
+		addr:      addr,
+		client:    client,
+		clientset: clientset,
+		certDir:   certDir,
+	}
+}
+
+// NeedLeaderElection lets every manager replica serve activity pings
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start runs the HTTP server until the context is cancelled
+func (s *Server) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("activity")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(pathPrefix, s.handleActivity)
+
+	server := &http.Server{
+		Addr:              s.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(_ net.Listener) context.Context { return ctx },
+	}
+
+	// Reload the certificate when it is rotated, like the webhook server does
+	if s.certDir != "" {
+		watcher, err := certwatcher.New(filepath.Join(s.certDir, "tls.crt"), filepath.Join(s.certDir, "tls.key"))
+		if err != nil {
+			return fmt.Errorf("failed to load activity endpoint certificate: %w", err)
+		}
+		go func() {
+			if err := watcher.Start(ctx); err != nil {
+				logger.Error(err, "Failed to watch activity endpoint certificate")
+			}
+		}()
+		server.TLSConfig = &tls.Config{
+			GetCertificate: watcher.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if s.certDir == "" {
+			logger.Info("Starting activity endpoint without TLS", "Address", s.addr)
+			errCh <- server.ListenAndServe()
+			return
+		}
+		logger.Info("Starting activity endpoint", "Address", s.addr, "CertDir", s.certDir)
+		errCh <- server.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
+
+// handleActivity records activity for POST /activity/<namespace>/<name>
+func (s *Server) handleActivity(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	logger := log.FromContext(ctx).WithName("activity")
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, pathPrefix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "expected /activity/<namespace>/<name>", http.StatusNotFound)
+		return
+	}
+	namespace, name := parts[0], parts[1]
+
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == req.Header.Get("Authorization") {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.authenticate(ctx, token)
+	if err != nil {
+		logger.Info("Rejected activity ping", "Reason", err.Error())
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.authorize(ctx, user, namespace, name); err != nil {
+		logger.Info("Rejected activity ping", "User", user.Username, "Reason", err.Error())
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now().UTC()
+	sharekube := &sharekubev1alpha1.ShareKube{}
+	sharekube.Namespace = namespace
+	sharekube.Name = name
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{LastActivityAnnotation: now.Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.client.Patch(ctx, sharekube, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Error(w, "sharekube not found", http.StatusNotFound)
+			return
+		}
+		logger.Error(err, "Failed to record activity", "Namespace", namespace, "Name", name)
+		http.Error(w, "failed to record activity", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Recorded activity", "Namespace", namespace, "Name", name, "User", user.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate validates the bearer token with a TokenReview
+func (s *Server) authenticate(ctx context.Context, token string) (authenticationv1.UserInfo, error) {
+	review, err := s.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return authenticationv1.UserInfo{}, fmt.Errorf("token review failed: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return authenticationv1.UserInfo{}, fmt.Errorf("token not authenticated: %s", review.Status.Error)
+	}
+	return review.Status.User, nil
+}
+
+// authorize checks with a SubjectAccessReview that the user may update the ShareKube
+func (s *Server) authorize(ctx context.Context, user authenticationv1.UserInfo, namespace, name string) error {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	review, err := s.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "update",
+				Group:     sharekubev1alpha1.GroupVersion.Group,
+				Resource:  "sharekubes",
+				Name:      name,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("subject access review failed: %w", err)
+	}
+	if !review.Status.Allowed {
+		return fmt.Errorf("not allowed to update sharekube %s/%s: %s", namespace, name, review.Status.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package krm
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func init() {
+	Register("set-labels", FunctionFunc(setLabels))
+	Register("set-annotations", FunctionFunc(setAnnotations))
+}
+
+// setLabels adds the functionConfig's data as labels to every item
+func setLabels(_ context.Context, list *ResourceList) error {
+	data, err := configData(list)
+	if err != nil {
+		return err
+	}
+	for _, item := range list.Items {
+		obj := &unstructured.Unstructured{Object: item}
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		for key, value := range data {
+			labels[key] = value
+		}
+		obj.SetLabels(labels)
+	}
+	return nil
+}
+
+// setAnnotations adds the functionConfig's data as annotations to every item
+func setAnnotations(_ context.Context, list *ResourceList) error {
+	data, err := configData(list)
+	if err != nil {
+		return err
+	}
+	for _, item := range list.Items {
+		obj := &unstructured.Unstructured{Object: item}
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		for key, value := range data {
+			annotations[key] = value
+		}
+		obj.SetAnnotations(annotations)
+	}
+	return nil
+}
+
+// configData reads the data map of a ConfigMap-style functionConfig
+func configData(list *ResourceList) (map[string]string, error) {
+	data, _, err := unstructured.NestedStringMap(list.FunctionConfig, "data")
+	if err != nil {
+		return nil, fmt.Errorf("invalid functionConfig: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,80 @@
+package krm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	// ResourceListAPIVersion is the apiVersion of the ResourceList exchanged with functions
+	ResourceListAPIVersion = "config.kubernetes.io/v1"
+
+	// ResourceListKind is the kind of the ResourceList exchanged with functions
+	ResourceListKind = "ResourceList"
+)
+
+// Result severities defined by the KRM functions specification
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// ResourceList is the input and output of a KRM function
+type ResourceList struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Items are the objects the function transforms
+	Items []map[string]interface{} `json:"items"`
+	// FunctionConfig configures the function
+	FunctionConfig map[string]interface{} `json:"functionConfig,omitempty"`
+	// Results are reported by the function
+	Results []Result `json:"results,omitempty"`
+}
+
+// Result is a message reported by a function
+type Result struct {
+	Message     string                 `json:"message"`
+	Severity    string                 `json:"severity,omitempty"`
+	ResourceRef map[string]interface{} `json:"resourceRef,omitempty"`
+	Field       map[string]interface{} `json:"field,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+}
+
+// Function is a KRM function that runs in-process
+type Function interface {
+	Run(ctx context.Context, list *ResourceList) error
+}
+
+// FunctionFunc adapts a function to the Function interface
+type FunctionFunc func(ctx context.Context, list *ResourceList) error
+
+// Run calls f(ctx, list)
+func (f FunctionFunc) Run(ctx context.Context, list *ResourceList) error {
+	return f(ctx, list)
+}
+
+var (
+	functionsMu sync.RWMutex
+	// functions holds the in-process functions by name
+	functions = map[string]Function{}
+)
+
+// Register makes an in-process function available to pipelines under the given name
+func Register(name string, fn Function) {
+	functionsMu.Lock()
+	defer functionsMu.Unlock()
+	functions[name] = fn
+}
+
+// lookup returns the in-process function registered under the name
+func lookup(name string) (Function, error) {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+	fn, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown builtin function %q", name)
+	}
+	return fn, nil
+}
@@ -0,0 +1,158 @@
+package krm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// execTimeout bounds the run time of a single exec function
+const execTimeout = 30 * time.Second
+
+// FunctionResult is a result reported by one function of a pipeline
+type FunctionResult struct {
+	// Function is the name of the function that reported the result
+	Function string
+	Result
+}
+
+// Runner executes pipelines of KRM functions
+type Runner struct {
+	allowlist []string
+}
+
+// NewRunner creates a Runner that only executes binaries matching one of the allowlisted path globs
+func NewRunner(allowlist []string) *Runner {
+	return &Runner{allowlist: allowlist}
+}
+
+// Run passes the objects through each function of the pipeline in order and returns the transformed objects.
+// Results reported by the functions are returned even when the pipeline fails; a result with error severity fails it.
+func (r *Runner) Run(ctx context.Context, pipeline []sharekubev1alpha1.KRMFunction, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, []FunctionResult, error) {
+	items := make([]map[string]interface{}, 0, len(objects))
+	for _, obj := range objects {
+		items = append(items, obj.DeepCopy().Object)
+	}
+
+	var results []FunctionResult
+	for _, fn := range pipeline {
+		list := &ResourceList{
+			APIVersion: ResourceListAPIVersion,
+			Kind:       ResourceListKind,
+			Items:      items,
+		}
+		if fn.Config != nil && len(fn.Config.Raw) > 0 {
+			if err := json.Unmarshal(fn.Config.Raw, &list.FunctionConfig); err != nil {
+				return nil, results, fmt.Errorf("invalid config of function %s: %w", fn.Name, err)
+			}
+		}
+
+		var err error
+		switch {
+		case fn.Builtin != "" && fn.Exec != "":
+			err = fmt.Errorf("function %s sets both builtin and exec", fn.Name)
+		case fn.Builtin != "":
+			err = r.runBuiltin(ctx, fn, list)
+		case fn.Exec != "":
+			list, err = r.runExec(ctx, fn, list)
+		default:
+			err = fmt.Errorf("function %s sets neither builtin nor exec", fn.Name)
+		}
+
+		if list != nil {
+			for _, result := range list.Results {
+				results = append(results, FunctionResult{Function: fn.Name, Result: result})
+			}
+		}
+		if err != nil {
+			return nil, results, err
+		}
+		for _, result := range list.Results {
+			if result.Severity == SeverityError {
+				return nil, results, fmt.Errorf("function %s failed: %s", fn.Name, result.Message)
+			}
+		}
+
+		items = list.Items
+	}
+
+	transformed := make([]*unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		transformed = append(transformed, &unstructured.Unstructured{Object: item})
+	}
+	return transformed, results, nil
+}
+
+// runBuiltin runs an in-process function
+func (r *Runner) runBuiltin(ctx context.Context, fn sharekubev1alpha1.KRMFunction, list *ResourceList) error {
+	impl, err := lookup(fn.Builtin)
+	if err != nil {
+		return err
+	}
+	if err := impl.Run(ctx, list); err != nil {
+		return fmt.Errorf("function %s failed: %w", fn.Name, err)
+	}
+	return nil
+}
+
+// runExec runs an allowlisted binary with the ResourceList on stdin and reads the transformed list from stdout
+func (r *Runner) runExec(ctx context.Context, fn sharekubev1alpha1.KRMFunction, list *ResourceList) (*ResourceList, error) {
+	if !r.allowed(fn.Exec) {
+		return nil, fmt.Errorf("function %s: executable %q is not in the allowlist", fn.Name, fn.Exec)
+	}
+
+	input, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, fn.Exec, fn.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	// Functions write their results to stdout even when they fail
+	output := &ResourceList{}
+	if err := yaml.Unmarshal(stdout.Bytes(), output); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("function %s failed: %w: %s", fn.Name, runErr, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("function %s returned an invalid ResourceList: %w", fn.Name, err)
+	}
+	if runErr != nil {
+		return output, fmt.Errorf("function %s failed: %w: %s", fn.Name, runErr, strings.TrimSpace(stderr.String()))
+	}
+	if output.Kind != ResourceListKind {
+		return output, fmt.Errorf("function %s returned kind %q instead of %s", fn.Name, output.Kind, ResourceListKind)
+	}
+	return output, nil
+}
+
+// allowed reports whether the executable matches one of the allowlisted path globs
+func (r *Runner) allowed(path string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	path = filepath.Clean(path)
+	for _, pattern := range r.allowlist {
+		if ok, err := filepath.Match(strings.TrimSpace(pattern), path); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
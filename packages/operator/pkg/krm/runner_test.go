@@ -0,0 +1,134 @@
+package krm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// writeFunction writes an exec function running the shell script to dir
+func writeFunction(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunnerRun(t *testing.T) {
+	dir := t.TempDir()
+	identity := writeFunction(t, dir, "identity", "cat")
+	failing := writeFunction(t, dir, "failing", `echo '{"apiVersion":"config.kubernetes.io/v1","kind":"ResourceList","items":[],"results":[{"message":"not allowed","severity":"error"}]}'`)
+	crashing := writeFunction(t, dir, "crashing", "echo boom >&2; exit 1")
+	config := &runtime.RawExtension{Raw: []byte(`{"data":{"team":"web"}}`)}
+
+	tests := []struct {
+		name     string
+		pipeline []sharekubev1alpha1.KRMFunction
+		label    string
+		results  int
+		wantErr  bool
+	}{
+		{
+			name:     "builtin",
+			pipeline: []sharekubev1alpha1.KRMFunction{{Name: "labels", Builtin: "set-labels", Config: config}},
+			label:    "web",
+		},
+		{
+			name: "builtin then exec",
+			pipeline: []sharekubev1alpha1.KRMFunction{
+				{Name: "labels", Builtin: "set-labels", Config: config},
+				{Name: "identity", Exec: identity},
+			},
+			label: "web",
+		},
+		{
+			name:     "exec reporting an error result",
+			pipeline: []sharekubev1alpha1.KRMFunction{{Name: "failing", Exec: failing}},
+			results:  1,
+			wantErr:  true,
+		},
+		{
+			name:     "exec exiting with an error",
+			pipeline: []sharekubev1alpha1.KRMFunction{{Name: "crashing", Exec: crashing}},
+			wantErr:  true,
+		},
+		{
+			name:     "executable outside the allowlist",
+			pipeline: []sharekubev1alpha1.KRMFunction{{Name: "shell", Exec: "/bin/sh"}},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown builtin",
+			pipeline: []sharekubev1alpha1.KRMFunction{{Name: "unknown", Builtin: "set-everything"}},
+			wantErr:  true,
+		},
+		{
+			name:     "builtin and exec",
+			pipeline: []sharekubev1alpha1.KRMFunction{{Name: "both", Builtin: "set-labels", Exec: identity}},
+			wantErr:  true,
+		},
+		{
+			name:     "neither builtin nor exec",
+			pipeline: []sharekubev1alpha1.KRMFunction{{Name: "empty"}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "config"},
+			}}
+
+			runner := NewRunner([]string{filepath.Join(dir, "*")})
+			objects, results, err := runner.Run(context.Background(), tt.pipeline, []*unstructured.Unstructured{source})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(results) != tt.results {
+				t.Errorf("Run() returned %d results, want %d", len(results), tt.results)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(objects) != 1 || objects[0].GetLabels()["team"] != tt.label {
+				t.Errorf("Run() = %v, want one object labeled team=%s", objects, tt.label)
+			}
+			if len(source.GetLabels()) != 0 {
+				t.Error("Run() modified its input")
+			}
+		})
+	}
+}
+
+func TestRunnerAllowed(t *testing.T) {
+	runner := NewRunner([]string{"/usr/local/bin/krm-*", " /opt/functions/mask "})
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{path: "/usr/local/bin/krm-mask", allowed: true},
+		{path: "/opt/functions/mask", allowed: true},
+		{path: "/usr/local/bin/../bin/krm-mask", allowed: true},
+		{path: "/usr/local/bin/krm-tools/mask"},
+		{path: "/usr/local/bin/../../../bin/sh"},
+		{path: "krm-mask"},
+	}
+
+	for _, tt := range tests {
+		if got := runner.allowed(tt.path); got != tt.allowed {
+			t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.allowed)
+		}
+	}
+}
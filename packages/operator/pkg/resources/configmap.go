@@ -0,0 +1,309 @@
+package resources
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// compiledConfigMapRule is a ConfigMap rule with its patterns compiled and edit values decoded
+type compiledConfigMapRule struct {
+	name         string
+	keys         []string
+	removeKeys   bool
+	replacements []compiledReplacement
+	edits        []compiledEdit
+}
+
+// compiledReplacement replaces the matches of pattern
+type compiledReplacement struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// compiledEdit sets or removes the field at path of an embedded document
+type compiledEdit struct {
+	path   []string
+	value  interface{}
+	remove bool
+}
+
+// ValidateConfigMapPolicy compiles the patterns and edits of the policy and reports the invalid ones
+func ValidateConfigMapPolicy(policy *sharekubev1alpha1.ConfigMapPolicy, path *field.Path) field.ErrorList {
+	_, errs := compileConfigMapPolicy(policy, path)
+	return errs
+}
+
+// SetConfigMapPolicy compiles the rules anonymizing the data of copied ConfigMaps
+func (h *ResourceHandler) SetConfigMapPolicy(policy *sharekubev1alpha1.ConfigMapPolicy) error {
+	compiled, errs := compileConfigMapPolicy(policy, field.NewPath("spec", "configMapPolicy"))
+	if len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	h.configMapRules = compiled
+	return nil
+}
+
+// compileConfigMapPolicy compiles the regular expressions and decodes the edit values of the rules
+func compileConfigMapPolicy(policy *sharekubev1alpha1.ConfigMapPolicy, path *field.Path) ([]compiledConfigMapRule, field.ErrorList) {
+	if policy == nil {
+		return nil, nil
+	}
+
+	var errs field.ErrorList
+	compiled := make([]compiledConfigMapRule, 0, len(policy.Rules))
+	for i, rule := range policy.Rules {
+		rulePath := path.Child("rules").Index(i)
+		c := compiledConfigMapRule{name: rule.Name, keys: rule.Keys, removeKeys: rule.RemoveKeys}
+
+		for j, replacement := range rule.Replacements {
+			pattern, err := regexp.Compile(replacement.Pattern)
+			if err != nil {
+				errs = append(errs, field.Invalid(rulePath.Child("replacements").Index(j).Child("pattern"), replacement.Pattern, err.Error()))
+				continue
+			}
+			c.replacements = append(c.replacements, compiledReplacement{pattern: pattern, replacement: replacement.Replacement})
+		}
+
+		for j, edit := range rule.DocumentEdits {
+			editPath := rulePath.Child("documentEdits").Index(j)
+			fields, err := splitFieldPath(edit.Path)
+			if err != nil {
+				errs = append(errs, field.Invalid(editPath.Child("path"), edit.Path, err.Error()))
+				continue
+			}
+			e := compiledEdit{path: fields, remove: edit.Remove}
+			switch {
+			case edit.Remove && edit.Value != nil:
+				errs = append(errs, field.Forbidden(editPath.Child("value"), "must not be set when remove is true"))
+				continue
+			case !edit.Remove && (edit.Value == nil || len(edit.Value.Raw) == 0):
+				errs = append(errs, field.Required(editPath.Child("value"), "either value or remove must be set"))
+				continue
+			case !edit.Remove:
+				if err := json.Unmarshal(edit.Value.Raw, &e.value); err != nil {
+					errs = append(errs, field.Invalid(editPath.Child("value"), string(edit.Value.Raw), err.Error()))
+					continue
+				}
+			}
+			c.edits = append(c.edits, e)
+		}
+
+		compiled = append(compiled, c)
+	}
+	return compiled, errs
+}
+
+// applyConfigMapPolicy anonymizes the data of a ConfigMap copy with every rule matching it, in order
+func (h *ResourceHandler) applyConfigMapPolicy(obj *unstructured.Unstructured) error {
+	if len(h.configMapRules) == 0 {
+		return nil
+	}
+
+	data, found, err := unstructured.NestedStringMap(obj.Object, "data")
+	if err != nil || !found {
+		return err
+	}
+
+	for _, rule := range h.configMapRules {
+		if rule.name != "" && rule.name != obj.GetName() {
+			continue
+		}
+		for key, value := range data {
+			if len(rule.keys) > 0 && !containsString(rule.keys, key) {
+				continue
+			}
+			if rule.removeKeys {
+				delete(data, key)
+				continue
+			}
+			for _, replacement := range rule.replacements {
+				value = replacement.pattern.ReplaceAllString(value, replacement.replacement)
+			}
+			if len(rule.edits) > 0 {
+				if value, err = editDocument(value, rule.edits); err != nil {
+					return fmt.Errorf("failed to edit the document in key %s: %w", key, err)
+				}
+			}
+			data[key] = value
+		}
+	}
+
+	if len(data) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "data")
+		return nil
+	}
+	return unstructured.SetNestedStringMap(obj.Object, data, "data")
+}
+
+// editDocument applies the edits to a JSON or YAML document and serializes it in its original format.
+// The edits are applied to each document of a multi-document YAML value. YAML documents lose their comments and key order.
+func editDocument(document string, edits []compiledEdit) (string, error) {
+	trimmed := strings.TrimSpace(document)
+	isJSON := strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")
+
+	raw := []byte(document)
+	if !isJSON {
+		if documents := splitYAMLDocuments(document); len(documents) > 1 {
+			for i := range documents {
+				edited, err := editDocument(documents[i], edits)
+				if err != nil {
+					return "", fmt.Errorf("document %d: %w", i+1, err)
+				}
+				documents[i] = edited
+			}
+			return strings.Join(documents, "---\n"), nil
+		}
+
+		var err error
+		if raw, err = yaml.YAMLToJSON(raw); err != nil {
+			return "", fmt.Errorf("not a JSON or YAML document: %w", err)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	// Keep large integers intact
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return "", fmt.Errorf("not a JSON or YAML document: %w", err)
+	}
+	switch doc.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return "", fmt.Errorf("not a JSON or YAML document")
+	}
+
+	for _, edit := range edits {
+		var err error
+		if edit.remove {
+			doc, err = removeDocumentField(doc, edit.path)
+		} else {
+			doc, err = setDocumentField(doc, edit.path, edit.value)
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", strings.Join(edit.path, "."), err)
+		}
+	}
+
+	var out []byte
+	var err error
+	switch {
+	case !isJSON:
+		if out, err = json.Marshal(doc); err == nil {
+			out, err = yaml.JSONToYAML(out)
+		}
+	case strings.Contains(trimmed, "\n"):
+		out, err = json.MarshalIndent(doc, "", "  ")
+	default:
+		out, err = json.Marshal(doc)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// splitYAMLDocuments splits a YAML value on its "---" separators, dropping empty documents
+func splitYAMLDocuments(value string) []string {
+	var documents []string
+	var current strings.Builder
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			documents = append(documents, current.String())
+		}
+		current.Reset()
+	}
+	for _, line := range strings.SplitAfter(value, "\n") {
+		if strings.TrimRight(line, " \t\r\n") == "---" {
+			flush()
+			continue
+		}
+		current.WriteString(line)
+	}
+	flush()
+	return documents
+}
+
+// setDocumentField sets the field at path, creating missing objects on the way
+func setDocumentField(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch n := node.(type) {
+	case nil:
+		child, err := setDocumentField(nil, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{path[0]: child}, nil
+	case map[string]interface{}:
+		child, err := setDocumentField(n[path[0]], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = child
+		return n, nil
+	case []interface{}:
+		i, err := listIndex(n, path[0])
+		if err != nil {
+			return nil, err
+		}
+		if n[i], err = setDocumentField(n[i], path[1:], value); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("%s is not an object or list", path[0])
+}
+
+// removeDocumentField deletes the field at path, ignoring missing fields
+func removeDocumentField(node interface{}, path []string) (interface{}, error) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(n, path[0])
+			return n, nil
+		}
+		if child, ok := n[path[0]]; ok {
+			var err error
+			if n[path[0]], err = removeDocumentField(child, path[1:]); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	case []interface{}:
+		i, err := listIndex(n, path[0])
+		if err != nil {
+			return n, nil
+		}
+		if len(path) == 1 {
+			return append(n[:i], n[i+1:]...), nil
+		}
+		if n[i], err = removeDocumentField(n[i], path[1:]); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return node, nil
+}
+
+// listIndex parses a path segment as an index into the list
+func listIndex(list []interface{}, segment string) (int, error) {
+	i, err := strconv.Atoi(segment)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a list index", segment)
+	}
+	if i < 0 || i >= len(list) {
+		return 0, fmt.Errorf("list index %d out of range", i)
+	}
+	return i, nil
+}
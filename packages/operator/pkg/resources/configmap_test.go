@@ -0,0 +1,85 @@
+package resources
+
+import (
+	"testing"
+)
+
+func TestEditDocument(t *testing.T) {
+	setLevel := []compiledEdit{{path: []string{"log", "level"}, value: "debug"}}
+	removeToken := []compiledEdit{{path: []string{"token"}, remove: true}}
+
+	tests := []struct {
+		name     string
+		document string
+		edits    []compiledEdit
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "compact JSON",
+			document: `{"log":{"level":"info"},"port":8080}`,
+			edits:    setLevel,
+			want:     `{"log":{"level":"debug"},"port":8080}`,
+		},
+		{
+			name:     "indented JSON",
+			document: "{\n  \"token\": \"secret\",\n  \"port\": 8080\n}",
+			edits:    removeToken,
+			want:     "{\n  \"port\": 8080\n}",
+		},
+		{
+			name:     "YAML creates missing fields",
+			document: "port: 8080\n",
+			edits:    setLevel,
+			want:     "log:\n  level: debug\nport: 8080\n",
+		},
+		{
+			name:     "every YAML document is edited",
+			document: "token: a\nport: 1\n---\ntoken: b\nport: 2\n",
+			edits:    removeToken,
+			want:     "port: 1\n---\nport: 2\n",
+		},
+		{
+			name:     "empty YAML documents are dropped",
+			document: "---\ntoken: a\n---\n\n---\ntoken: b\n",
+			edits:    removeToken,
+			want:     "{}\n---\n{}\n",
+		},
+		{
+			name:     "large integers are kept",
+			document: `{"id":12345678901234567890}`,
+			edits:    removeToken,
+			want:     `{"id":12345678901234567890}`,
+		},
+		{
+			name:     "plain text is rejected",
+			document: "just some text",
+			edits:    removeToken,
+			wantErr:  true,
+		},
+		{
+			name:     "YAML document holding plain text is rejected",
+			document: "token: a\n---\njust some text\n",
+			edits:    removeToken,
+			wantErr:  true,
+		},
+		{
+			name:     "setting a field below a scalar is rejected",
+			document: `{"log":"info"}`,
+			edits:    setLevel,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := editDocument(tt.document, tt.edits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("editDocument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("editDocument() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Conflict policies deciding what happens when the name of a copy is taken by an object the ShareKube does not own
+const (
+	ConflictFail      = "Fail"
+	ConflictSkip      = "Skip"
+	ConflictOverwrite = "Overwrite"
+	ConflictAdopt     = "Adopt"
+)
+
+var (
+	// ErrConflict is returned when the name of a copy is taken in the target namespace
+	ErrConflict = errors.New("object already exists in the target namespace")
+	// ErrConflictSkipped is returned when a copy is left out because its name is taken in the target namespace
+	ErrConflictSkipped = errors.New("object already exists in the target namespace, skipped")
+)
+
+// SetConflictPolicy sets the conflict policy of copies without a policy of their own
+func (h *ResourceHandler) SetConflictPolicy(policy string) {
+	h.conflictPolicy = policy
+}
+
+// WithConflictPolicy overrides the conflict policy for a single copy
+func WithConflictPolicy(policy string) CopyOption {
+	return func(o *copyOptions) {
+		o.conflictPolicy = policy
+	}
+}
+
+// setCopyConflictPolicy remembers the conflict policy of a prepared copy until it is written
+func (h *ResourceHandler) setCopyConflictPolicy(obj *unstructured.Unstructured, policy string) {
+	if policy == "" {
+		return
+	}
+	if h.conflictPolicies == nil {
+		h.conflictPolicies = make(map[string]string)
+	}
+	h.conflictPolicies[obj.GetKind()+"/"+obj.GetName()] = policy
+}
+
+// conflictPolicyFor returns the conflict policy of a copy, defaulting to Fail
+func (h *ResourceHandler) conflictPolicyFor(obj *unstructured.Unstructured) string {
+	if policy, ok := h.conflictPolicies[obj.GetKind()+"/"+obj.GetName()]; ok {
+		return policy
+	}
+	if h.conflictPolicy != "" {
+		return h.conflictPolicy
+	}
+	return ConflictFail
+}
+
+// resolveConflict handles a copy whose name is taken by an object the ShareKube does not own.
+// Copies of other ShareKubes are never overwritten or adopted.
+func (h *ResourceHandler) resolveConflict(ctx context.Context, gvr schema.GroupVersionResource, obj, existing *unstructured.Unstructured) error {
+	logger := log.FromContext(ctx)
+	policy := h.conflictPolicyFor(obj)
+
+	labels := existing.GetLabels()
+	if owner := labels["sharekube.dev/owner-name"]; owner != "" && (policy == ConflictOverwrite || policy == ConflictAdopt) {
+		return fmt.Errorf("%w: %s %s is a copy of ShareKube %s/%s", ErrConflict,
+			obj.GetKind(), obj.GetName(), labels["sharekube.dev/owner-namespace"], owner)
+	}
+
+	switch policy {
+	case ConflictSkip:
+		return fmt.Errorf("%w: %s %s", ErrConflictSkipped, obj.GetKind(), obj.GetName())
+	case ConflictOverwrite:
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		if _, err := h.dynClient.Resource(gvr).Namespace(obj.GetNamespace()).Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to overwrite existing %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		logger.Info("Overwrote existing object", "Kind", obj.GetKind(), "Name", obj.GetName())
+		return nil
+	case ConflictAdopt:
+		h.addOwnershipLabels(existing)
+		if _, err := h.dynClient.Resource(gvr).Namespace(existing.GetNamespace()).Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to adopt existing %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		logger.Info("Adopted existing object", "Kind", obj.GetKind(), "Name", obj.GetName())
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s", ErrConflict, obj.GetKind(), obj.GetName())
+}
@@ -0,0 +1,84 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestResolveConflict(t *testing.T) {
+	existingYAML := `
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: settings, namespace: preview, labels: {team: web}}
+data: {level: debug}`
+	otherCopyYAML := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: preview
+  labels: {sharekube.dev/owner-name: other, sharekube.dev/owner-namespace: dev}
+data: {level: debug}`
+
+	tests := []struct {
+		name       string
+		policy     string
+		copyPolicy string
+		existing   string
+		wantErr    error
+		wantLevel  string
+		wantOwner  string
+	}{
+		{name: "fails by default", existing: existingYAML, wantErr: ErrConflict, wantLevel: "debug"},
+		{name: "skip", policy: ConflictSkip, existing: existingYAML, wantErr: ErrConflictSkipped, wantLevel: "debug"},
+		{name: "overwrite", policy: ConflictOverwrite, existing: existingYAML, wantLevel: "info", wantOwner: "my-preview"},
+		{name: "adopt keeps the data", policy: ConflictAdopt, existing: existingYAML, wantLevel: "debug", wantOwner: "my-preview"},
+		{name: "copy policy wins", policy: ConflictOverwrite, copyPolicy: ConflictSkip, existing: existingYAML, wantErr: ErrConflictSkipped, wantLevel: "debug"},
+		{name: "never overwrites another ShareKube's copy", policy: ConflictOverwrite, existing: otherCopyYAML, wantErr: ErrConflict, wantLevel: "debug", wantOwner: "other"},
+		{name: "never adopts another ShareKube's copy", policy: ConflictAdopt, existing: otherCopyYAML, wantErr: ErrConflict, wantLevel: "debug", wantOwner: "other"},
+	}
+
+	gvr, err := getGVRForKind("ConfigMap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := unstructuredFromYAML(t, tt.existing)
+			dynClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing.DeepCopy())
+			h := NewResourceHandler(nil, dynClient, runtime.NewScheme(), metav1.OwnerReference{}, "my-preview", "dev")
+			h.SetConflictPolicy(tt.policy)
+
+			obj := unstructuredFromYAML(t, `
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: settings, namespace: preview}
+data: {level: info}`)
+			h.addOwnershipLabels(obj)
+			h.setCopyConflictPolicy(obj, tt.copyPolicy)
+
+			err := h.resolveConflict(context.Background(), gvr, obj, existing)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveConflict() error = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, err := dynClient.Resource(gvr).Namespace("preview").Get(context.Background(), "settings", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if level, _, _ := unstructured.NestedString(stored.Object, "data", "level"); level != tt.wantLevel {
+				t.Errorf("data.level = %q, want %q", level, tt.wantLevel)
+			}
+			if owner := stored.GetLabels()["sharekube.dev/owner-name"]; owner != tt.wantOwner {
+				t.Errorf("owner-name label = %q, want %q", owner, tt.wantOwner)
+			}
+		})
+	}
+}
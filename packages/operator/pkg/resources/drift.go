@@ -0,0 +1,264 @@
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Drift policies deciding what happens to copies that no longer match their sources
+const (
+	DriftIgnore  = "Ignore"
+	DriftReport  = "Report"
+	DriftCorrect = "Correct"
+)
+
+// ContentHashAnnotation records the hash of the content a copy was written with
+const ContentHashAnnotation = "sharekube.dev/content-hash"
+
+const (
+	// HibernatedReplicasAnnotation remembers the replica count of a workload scaled to zero
+	HibernatedReplicasAnnotation = "sharekube.dev/hibernated-replicas"
+
+	// HibernatedSuspendAnnotation remembers the suspend flag of a CronJob suspended during hibernation
+	HibernatedSuspendAnnotation = "sharekube.dev/hibernated-suspend"
+)
+
+// hibernatedFields are the fields the controller changes on copies while the preview hibernates,
+// by the annotation it remembers their value in
+var hibernatedFields = map[string][]string{
+	HibernatedReplicasAnnotation: {"spec", "replicas"},
+	HibernatedSuspendAnnotation:  {"spec", "suspend"},
+}
+
+// Drift describes a copy that no longer matches the copy ShareKube would write
+type Drift struct {
+	// Kind and Name identify the copy
+	Kind string
+	Name string
+	// Fields are the paths of the fields that differ
+	Fields []string
+	// SourceChanged is set when the source or the ShareKube changed since the copy was written
+	SourceChanged bool
+	// Corrected is set when the copy was restored
+	Corrected bool
+}
+
+// SetDriftPolicy decides whether existing copies are compared with their sources, and whether drifted ones are restored
+func (h *ResourceHandler) SetDriftPolicy(policy string) {
+	h.driftPolicy = policy
+}
+
+// Drift returns the drifted copies found while copying
+func (h *ResourceHandler) Drift() []Drift {
+	return h.drift
+}
+
+// setContentHash records the hash of a copy's content before it is written
+func setContentHash(obj *unstructured.Unstructured) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[ContentHashAnnotation] = contentHash(contentOf(obj, nil))
+	obj.SetAnnotations(annotations)
+}
+
+// checkDrift compares an existing copy with the copy that would be written now, and reports or restores the fields that differ.
+// Fields the copy has on top, like defaults and fields set by controllers, are not compared.
+func (h *ResourceHandler) checkDrift(ctx context.Context, gvr schema.GroupVersionResource, desired, existing *unstructured.Unstructured) error {
+	if h.driftPolicy == "" || h.driftPolicy == DriftIgnore {
+		return nil
+	}
+
+	content := contentOf(desired, existing)
+	var fields []string
+	diffContent(content, existing.Object, "", &fields)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	drift := Drift{Kind: desired.GetKind(), Name: desired.GetName(), Fields: fields}
+	if hash, ok := existing.GetAnnotations()[ContentHashAnnotation]; ok {
+		drift.SourceChanged = hash != desired.GetAnnotations()[ContentHashAnnotation]
+	}
+
+	if h.driftPolicy == DriftCorrect {
+		mergeContent(existing.Object, content)
+		annotations := existing.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[ContentHashAnnotation] = desired.GetAnnotations()[ContentHashAnnotation]
+		existing.SetAnnotations(annotations)
+		if _, err := h.dynClient.Resource(gvr).Namespace(existing.GetNamespace()).Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to correct drift of %s: %w", strings.Join(fields, ", "), err)
+		}
+		drift.Corrected = true
+		log.FromContext(ctx).Info("Corrected drifted copy", "Kind", drift.Kind, "Name", drift.Name, "Fields", fields)
+	}
+
+	h.drift = append(h.drift, drift)
+	return nil
+}
+
+// contentOf returns the part of a copy drift is detected on: its labels, annotations, and fields outside metadata and status.
+// Values ShareKube regenerates on every copy are left out, and so are the fields hibernation changes on the existing copy.
+func contentOf(obj *unstructured.Unstructured, existing *unstructured.Unstructured) map[string]interface{} {
+	content := make(map[string]interface{})
+	for key, value := range obj.Object {
+		switch key {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		content[key] = runtime.DeepCopyJSONValue(value)
+	}
+
+	metadata := make(map[string]interface{})
+	if labels, found, _ := unstructured.NestedMap(obj.Object, "metadata", "labels"); found && len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if annotations, found, _ := unstructured.NestedMap(obj.Object, "metadata", "annotations"); found {
+		delete(annotations, ContentHashAnnotation)
+		if len(annotations) > 0 {
+			metadata["annotations"] = annotations
+		}
+	}
+	if len(metadata) > 0 {
+		content["metadata"] = metadata
+	}
+
+	// Random and templated Secret values differ on every copy
+	if obj.GetKind() == "Secret" {
+		var actions map[string]string
+		if err := json.Unmarshal([]byte(obj.GetAnnotations()[SecretPolicyAnnotation]), &actions); err == nil {
+			for key, action := range actions {
+				if action == SecretActionRandom || action == SecretActionTemplate {
+					unstructured.RemoveNestedField(content, "data", key)
+				}
+			}
+		}
+	}
+
+	if existing != nil {
+		for annotation, field := range hibernatedFields {
+			if _, ok := existing.GetAnnotations()[annotation]; ok {
+				unstructured.RemoveNestedField(content, field...)
+			}
+		}
+	}
+	return content
+}
+
+// contentHash returns the hex SHA-256 of the content, whose map keys are serialized in order
+func contentHash(content map[string]interface{}) string {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// diffContent appends the paths of the fields of desired that existing does not match
+func diffContent(desired, existing interface{}, path string, fields *[]string) {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		e, ok := existing.(map[string]interface{})
+		if !ok {
+			*fields = append(*fields, path)
+			return
+		}
+		keys := make([]string, 0, len(d))
+		for key := range d {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := joinFieldPath(path, key)
+			value, found := e[key]
+			if !found {
+				// A null field is the same as a missing one
+				if d[key] != nil {
+					*fields = append(*fields, child)
+				}
+				continue
+			}
+			diffContent(d[key], value, child, fields)
+		}
+	case []interface{}:
+		e, ok := existing.([]interface{})
+		if !ok || len(e) != len(d) {
+			*fields = append(*fields, path)
+			return
+		}
+		for i := range d {
+			diffContent(d[i], e[i], joinFieldPath(path, strconv.Itoa(i)), fields)
+		}
+	default:
+		if !equalValues(desired, existing) {
+			*fields = append(*fields, path)
+		}
+	}
+}
+
+// equalValues compares scalar values, treating quantities the API server canonicalized (e.g., 0.5 and 500m) as equal
+func equalValues(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			aq, aerr := resource.ParseQuantity(as)
+			bq, berr := resource.ParseQuantity(bs)
+			return aerr == nil && berr == nil && aq.Cmp(bq) == 0
+		}
+	}
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	return aok && bok && af == bf
+}
+
+// toFloat converts a JSON number to a float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// mergeContent sets the fields of content on the existing object, keeping the fields only the existing object has
+func mergeContent(existing, content map[string]interface{}) {
+	for key, value := range content {
+		if valueMap, ok := value.(map[string]interface{}); ok {
+			if existingMap, ok := existing[key].(map[string]interface{}); ok {
+				mergeContent(existingMap, valueMap)
+				continue
+			}
+		}
+		existing[key] = runtime.DeepCopyJSONValue(value)
+	}
+}
+
+// joinFieldPath appends a key to a dot-separated field path, escaping dots in the key
+func joinFieldPath(path, key string) string {
+	key = strings.ReplaceAll(key, ".", `\.`)
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
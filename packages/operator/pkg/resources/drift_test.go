@@ -0,0 +1,246 @@
+package resources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/yaml"
+)
+
+// unstructuredFromYAML parses an object the way the API server's responses are decoded, with integers as int64
+func unstructuredFromYAML(t *testing.T, object string) *unstructured.Unstructured {
+	t.Helper()
+	data, err := yaml.YAMLToJSON([]byte(object))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := map[string]interface{}{}
+	if err := utiljson.Unmarshal(data, &content); err != nil {
+		t.Fatal(err)
+	}
+	return &unstructured.Unstructured{Object: content}
+}
+
+func TestDiffContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		desired  string
+		existing string
+		want     []string
+	}{
+		{
+			name:     "equal",
+			desired:  `{spec: {replicas: 2, selector: {app: api}}}`,
+			existing: `{spec: {replicas: 2, selector: {app: api}}}`,
+		},
+		{
+			name:     "fields only the copy has are ignored",
+			desired:  `{spec: {replicas: 2}}`,
+			existing: `{spec: {replicas: 2, progressDeadlineSeconds: 600}, status: {ready: true}}`,
+		},
+		{
+			name:     "changed and missing fields",
+			desired:  `{data: {a: "1", b: "2", c: "3"}}`,
+			existing: `{data: {a: "1", b: "two"}}`,
+			want:     []string{"data.b", "data.c"},
+		},
+		{
+			name:     "null is the same as missing",
+			desired:  `{spec: {replicas: 1, strategy: null}}`,
+			existing: `{spec: {replicas: 1}}`,
+		},
+		{
+			name:     "list length changed",
+			desired:  `{spec: {ports: [{port: 80}, {port: 443}]}}`,
+			existing: `{spec: {ports: [{port: 80}]}}`,
+			want:     []string{"spec.ports"},
+		},
+		{
+			name:     "list item changed",
+			desired:  `{spec: {ports: [{port: 80}, {port: 443}]}}`,
+			existing: `{spec: {ports: [{port: 80}, {port: 8443}]}}`,
+			want:     []string{"spec.ports.1.port"},
+		},
+		{
+			name:     "canonicalized quantities are equal",
+			desired:  `{spec: {cpu: "0.5", memory: 1Gi}}`,
+			existing: `{spec: {cpu: 500m, memory: "1073741824"}}`,
+		},
+		{
+			name:     "map replaced by a scalar",
+			desired:  `{spec: {template: {app: api}}}`,
+			existing: `{spec: {template: api}}`,
+			want:     []string{"spec.template"},
+		},
+		{
+			name:     "dots in keys are escaped",
+			desired:  `{metadata: {labels: {app.kubernetes.io/name: api}}}`,
+			existing: `{metadata: {labels: {app.kubernetes.io/name: web}}}`,
+			want:     []string{`metadata.labels.app\.kubernetes\.io/name`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := unstructuredFromYAML(t, tt.desired)
+			existing := unstructuredFromYAML(t, tt.existing)
+
+			var fields []string
+			diffContent(desired.Object, existing.Object, "", &fields)
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("diffContent() = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		desired  string
+		existing string
+		want     map[string]interface{}
+	}{
+		{
+			name: "bookkeeping and status are ignored",
+			desired: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: preview
+  labels: {app: api}
+  annotations: {sharekube.dev/content-hash: abc}
+spec: {replicas: 2, paused: false}
+status: {readyReplicas: 2}`,
+			existing: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  annotations: {sharekube.dev/hibernated-replicas: "2"}`,
+			want: map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "api"}},
+				"spec":     map[string]interface{}{"paused": false},
+			},
+		},
+		{
+			name: "random Secret values are ignored",
+			desired: `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+  annotations: {sharekube.dev/secret-policy: '{"password":"Random","token":"Copy"}'}
+data: {password: cGFzcw==, token: dG9rZW4=}`,
+			want: map[string]interface{}{
+				"metadata": map[string]interface{}{"annotations": map[string]interface{}{
+					"sharekube.dev/secret-policy": `{"password":"Random","token":"Copy"}`,
+				}},
+				"data": map[string]interface{}{"token": "dG9rZW4="},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var existing *unstructured.Unstructured
+			if tt.existing != "" {
+				existing = unstructuredFromYAML(t, tt.existing)
+			}
+			if got := contentOf(unstructuredFromYAML(t, tt.desired), existing); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("contentOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	existingYAML := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: preview
+  annotations: {sharekube.dev/content-hash: old}
+data: {level: debug, extra: kept}`
+
+	tests := []struct {
+		name      string
+		policy    string
+		desired   string
+		wantDrift bool
+		corrected bool
+	}{
+		{
+			name:    "ignored",
+			policy:  DriftIgnore,
+			desired: `{apiVersion: v1, kind: ConfigMap, metadata: {name: settings}, data: {level: info}}`,
+		},
+		{
+			name:    "no drift",
+			policy:  DriftReport,
+			desired: `{apiVersion: v1, kind: ConfigMap, metadata: {name: settings}, data: {level: debug}}`,
+		},
+		{
+			name:      "reported",
+			policy:    DriftReport,
+			desired:   `{apiVersion: v1, kind: ConfigMap, metadata: {name: settings}, data: {level: info}}`,
+			wantDrift: true,
+		},
+		{
+			name:      "corrected",
+			policy:    DriftCorrect,
+			desired:   `{apiVersion: v1, kind: ConfigMap, metadata: {name: settings}, data: {level: info}}`,
+			wantDrift: true,
+			corrected: true,
+		},
+	}
+
+	gvr, err := getGVRForKind("ConfigMap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := unstructuredFromYAML(t, existingYAML)
+			dynClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing.DeepCopy())
+			h := &ResourceHandler{dynClient: dynClient}
+			h.SetDriftPolicy(tt.policy)
+
+			desired := unstructuredFromYAML(t, tt.desired)
+			setContentHash(desired)
+			if err := h.checkDrift(context.Background(), gvr, desired, existing); err != nil {
+				t.Fatalf("checkDrift() error = %v", err)
+			}
+
+			drift := h.Drift()
+			if (len(drift) == 1) != tt.wantDrift {
+				t.Fatalf("Drift() = %+v, want drift %v", drift, tt.wantDrift)
+			}
+			if !tt.wantDrift {
+				return
+			}
+			if !reflect.DeepEqual(drift[0].Fields, []string{"data.level"}) || !drift[0].SourceChanged || drift[0].Corrected != tt.corrected {
+				t.Errorf("Drift() = %+v, want data.level changed at the source, corrected %v", drift[0], tt.corrected)
+			}
+
+			stored, err := dynClient.Resource(gvr).Namespace("preview").Get(context.Background(), "settings", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			level, _, _ := unstructured.NestedString(stored.Object, "data", "level")
+			extra, _, _ := unstructured.NestedString(stored.Object, "data", "extra")
+			if wantLevel := map[bool]string{true: "info", false: "debug"}[tt.corrected]; level != wantLevel || extra != "kept" {
+				t.Errorf("stored data = %v, want level %q and the extra field kept", stored.Object["data"], wantLevel)
+			}
+		})
+	}
+}
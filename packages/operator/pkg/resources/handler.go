@@ -2,10 +2,10 @@ package resources
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
-	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -13,6 +13,8 @@ import (
 	"k8s.io/client-go/dynamic"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
 )
 
 // ResourceHandler handles copying resources between namespaces
@@ -24,6 +26,39 @@ type ResourceHandler struct {
 	// Track ShareKube info for labeling
 	sharekubeName      string
 	sharekubeNamespace string
+	// Require source objects to opt in via share annotations before copying
+	requireShareOptIn bool
+	// Scaling rules applied to copied workloads
+	scaling *sharekubev1alpha1.ScalingRules
+	// Rules for rewriting references to the source namespace
+	referenceRewrite *sharekubev1alpha1.ReferenceRewrite
+	// Template for the names of copies, and the copied names by kind whose references are renamed
+	nameTemplate string
+	copiedNames  map[string]map[string]bool
+	// Host rules for copied Ingresses and HTTPRoutes, and the preview URLs they serve
+	hosts     *sharekubev1alpha1.HostRewrite
+	endpoints []sharekubev1alpha1.Endpoint
+	// Whether NodePort and LoadBalancer Services keep their type
+	serviceTypePolicy string
+	// How the data of copied Secrets is masked or regenerated
+	secretPolicy *sharekubev1alpha1.SecretPolicy
+	// Compiled rules anonymizing the data of copied ConfigMaps
+	configMapRules []compiledConfigMapRule
+	// How copied PersistentVolumeClaims get their data
+	volumeCopy *sharekubev1alpha1.VolumeCopy
+	// Compiled transformation rules applied to each copy
+	rules []compiledRule
+	// Objects written to the target namespace
+	applied []sharekubev1alpha1.InventoryEntry
+	// What happens to copies whose name is taken by an object the ShareKube does not own, by default and by copy
+	conflictPolicy   string
+	conflictPolicies map[string]string
+	// Whether existing copies are compared with their sources, and the drifted copies found
+	driftPolicy string
+	drift       []Drift
+	// Transformer run on the staged copies before they are written
+	transformer Transformer
+	staged      []*unstructured.Unstructured
 }
 
 // NewResourceHandler creates a new ResourceHandler
@@ -38,269 +73,210 @@ func NewResourceHandler(client client.Client, dynClient dynamic.Interface, schem
 	}
 }
 
-// CopyResource copies a resource from source to target namespace
-func (h *ResourceHandler) CopyResource(ctx context.Context, kind, name, sourceNamespace, targetNamespace string) error {
-	logger := log.FromContext(ctx)
-	logger.Info("Copying resource", "Kind", kind, "Name", name, "From", sourceNamespace, "To", targetNamespace)
+// CopyOption customizes a single CopyResource call
+type CopyOption func(*copyOptions)
+
+// copyOptions holds the per-copy overrides collected from CopyOptions
+type copyOptions struct {
+	replicas             *int32
+	skipReferenceRewrite bool
+	volumeCopyMode       string
+	conflictPolicy       string
+}
 
-	// Handle different resource types
-	switch kind {
-	case "Deployment":
-		return h.copyDeployment(ctx, name, sourceNamespace, targetNamespace)
-	case "Service":
-		return h.copyService(ctx, name, sourceNamespace, targetNamespace)
-	case "ConfigMap":
-		return h.copyConfigMap(ctx, name, sourceNamespace, targetNamespace)
-	case "Secret":
-		return h.copySecret(ctx, name, sourceNamespace, targetNamespace)
-	default:
-		return h.copyGenericResource(ctx, kind, name, sourceNamespace, targetNamespace)
+// WithReplicas overrides the replica count of the copied workload
+func WithReplicas(replicas int32) CopyOption {
+	return func(o *copyOptions) {
+		o.replicas = &replicas
 	}
 }
 
-// copyDeployment copies a Deployment resource
-func (h *ResourceHandler) copyDeployment(ctx context.Context, name, sourceNamespace, targetNamespace string) error {
+// CopyResource copies a resource from source to target namespace.
+// The copy is cleaned up by the Sanitizer registered for its kind before it is created.
+func (h *ResourceHandler) CopyResource(ctx context.Context, kind, name, sourceNamespace, targetNamespace string, opts ...CopyOption) error {
 	logger := log.FromContext(ctx)
 
-	// Get the source deployment
-	srcDeploy := &appsv1.Deployment{}
-	if err := h.client.Get(ctx, client.ObjectKey{Namespace: sourceNamespace, Name: name}, srcDeploy); err != nil {
-		logger.Error(err, "Failed to get source Deployment")
-		return err
+	options := copyOptions{}
+	for _, opt := range opts {
+		opt(&options)
 	}
 
-	// Create a new deployment for the target
-	newDeploy := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        srcDeploy.Name,
-			Namespace:   targetNamespace,
-			Labels:      srcDeploy.Labels,
-			Annotations: srcDeploy.Annotations,
-			// Don't set owner references across namespaces - it won't work
-			// OwnerReferences: []metav1.OwnerReference{h.ownerRef},
-		},
-		Spec: srcDeploy.Spec,
-	}
+	logger.Info("Copying resource", "Kind", kind, "Name", name, "From", sourceNamespace, "To", targetNamespace)
 
-	// Add labels to track resources created by ShareKube
-	if newDeploy.Labels == nil {
-		newDeploy.Labels = make(map[string]string)
+	// Determine the GVR for the kind
+	gvr, err := getGVRForKind(kind)
+	if err != nil {
+		logger.Error(err, "Failed to determine GVR for kind", "Kind", kind)
+		return err
 	}
-	// Only keep ownership labels - simplify tracking to the minimum needed for cleanup
-	newDeploy.Labels["sharekube.dev/owner-name"] = h.sharekubeName
-	newDeploy.Labels["sharekube.dev/owner-namespace"] = h.sharekubeNamespace
-
-	// Remove resource version from metadata
-	newDeploy.ResourceVersion = ""
 
-	// Create the deployment in the target namespace
-	if err := h.client.Create(ctx, newDeploy); err != nil {
-		logger.Error(err, "Failed to create Deployment in target namespace")
+	// Get the source resource
+	srcResource, err := h.dynClient.Resource(gvr).Namespace(sourceNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logger.Error(err, "Failed to get source resource")
 		return err
 	}
 
-	logger.Info("Successfully copied Deployment", "Name", name)
-	return nil
-}
-
-// copyService copies a Service resource
-func (h *ResourceHandler) copyService(ctx context.Context, name, sourceNamespace, targetNamespace string) error {
-	logger := log.FromContext(ctx)
-
-	// Get the source service
-	srcSvc := &corev1.Service{}
-	if err := h.client.Get(ctx, client.ObjectKey{Namespace: sourceNamespace, Name: name}, srcSvc); err != nil {
-		logger.Error(err, "Failed to get source Service")
+	// Honor per-object share annotations before anything is copied
+	if err := isShareable(srcResource.GetAnnotations(), targetNamespace, h.requireShareOptIn); err != nil {
 		return err
 	}
 
-	// Create a new service for the target
-	newSvc := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        srcSvc.Name,
-			Namespace:   targetNamespace,
-			Labels:      srcSvc.Labels,
-			Annotations: srcSvc.Annotations,
-			// Don't set owner references across namespaces - it won't work
-			// OwnerReferences: []metav1.OwnerReference{h.ownerRef},
-		},
-		Spec: srcSvc.Spec,
+	// Prepare the resource for copying
+	newResource := srcResource.DeepCopy()
+	newResource.SetNamespace(targetNamespace)
+	if err := sanitizeObject(newResource); err != nil {
+		logger.Error(err, "Failed to sanitize resource")
+		return err
 	}
 
-	// Add labels to track resources created by ShareKube
-	if newSvc.Labels == nil {
-		newSvc.Labels = make(map[string]string)
+	// Keep or convert the type of NodePort and LoadBalancer Services
+	if kind == "Service" {
+		if err := h.applyServiceTypePolicy(newResource); err != nil {
+			logger.Error(err, "Failed to apply service type policy")
+			return err
+		}
 	}
-	// Only keep ownership labels - simplify tracking to the minimum needed for cleanup
-	newSvc.Labels["sharekube.dev/owner-name"] = h.sharekubeName
-	newSvc.Labels["sharekube.dev/owner-namespace"] = h.sharekubeNamespace
-
-	// Remove resource version from metadata
-	newSvc.ResourceVersion = ""
 
-	// Remove cluster IP and other cluster-specific fields that should be generated by the cluster
-	newSvc.Spec.ClusterIP = ""
-	newSvc.Spec.ClusterIPs = nil
-
-	// Create the service in the target namespace
-	if err := h.client.Create(ctx, newSvc); err != nil {
-		logger.Error(err, "Failed to create Service in target namespace")
-		return err
+	// Keep production credentials out of the preview
+	if kind == "Secret" {
+		if err := h.applySecretPolicy(newResource, targetNamespace); err != nil {
+			logger.Error(err, "Failed to apply secret policy")
+			return err
+		}
 	}
 
-	logger.Info("Successfully copied Service", "Name", name)
-	return nil
-}
-
-// copyConfigMap copies a ConfigMap resource
-func (h *ResourceHandler) copyConfigMap(ctx context.Context, name, sourceNamespace, targetNamespace string) error {
-	logger := log.FromContext(ctx)
-
-	// Get the source configmap
-	srcCm := &corev1.ConfigMap{}
-	if err := h.client.Get(ctx, client.ObjectKey{Namespace: sourceNamespace, Name: name}, srcCm); err != nil {
-		logger.Error(err, "Failed to get source ConfigMap")
-		return err
+	// Anonymize ConfigMaps before the preview is shared
+	if kind == "ConfigMap" {
+		if err := h.applyConfigMapPolicy(newResource); err != nil {
+			logger.Error(err, "Failed to apply ConfigMap policy")
+			return err
+		}
 	}
 
-	// Create a new configmap for the target
-	newCm := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        srcCm.Name,
-			Namespace:   targetNamespace,
-			Labels:      srcCm.Labels,
-			Annotations: srcCm.Annotations,
-			// Don't set owner references across namespaces - it won't work
-			// OwnerReferences: []metav1.OwnerReference{h.ownerRef},
-		},
-		Data:       srcCm.Data,
-		BinaryData: srcCm.BinaryData,
+	// Restore claim copies from the data of their source
+	if kind == "PersistentVolumeClaim" {
+		if err := h.prepareVolumeData(ctx, newResource, name, sourceNamespace, targetNamespace, options); err != nil {
+			if !errors.Is(err, ErrSnapshotPending) {
+				logger.Error(err, "Failed to prepare volume data")
+			}
+			return err
+		}
 	}
 
-	// Add labels to track resources created by ShareKube
-	if newCm.Labels == nil {
-		newCm.Labels = make(map[string]string)
+	// Resize workloads and their autoscalers for the preview
+	if h.scaling != nil {
+		switch {
+		case isScalableKind(kind):
+			if err := scaleUnstructuredWorkload(h.scaling, newResource); err != nil {
+				logger.Error(err, "Failed to apply scaling rules")
+				return err
+			}
+		case kind == "HorizontalPodAutoscaler" && h.scaling.HorizontalPodAutoscalers == HPAPolicyDrop:
+			return fmt.Errorf("%w: HorizontalPodAutoscalers are dropped by the scaling rules", ErrDropped)
+		case kind == "HorizontalPodAutoscaler":
+			if err := clampHorizontalPodAutoscaler(h.scaling, newResource); err != nil {
+				logger.Error(err, "Failed to clamp HorizontalPodAutoscaler")
+				return err
+			}
+		}
 	}
-	// Only keep ownership labels - simplify tracking to the minimum needed for cleanup
-	newCm.Labels["sharekube.dev/owner-name"] = h.sharekubeName
-	newCm.Labels["sharekube.dev/owner-namespace"] = h.sharekubeNamespace
 
-	// Remove resource version from metadata
-	newCm.ResourceVersion = ""
+	// Apply replica override if requested
+	if options.replicas != nil {
+		if err := unstructured.SetNestedField(newResource.Object, int64(*options.replicas), "spec", "replicas"); err != nil {
+			logger.Error(err, "Failed to override replicas")
+			return err
+		}
+	}
 
-	// Create the configmap in the target namespace
-	if err := h.client.Create(ctx, newCm); err != nil {
-		logger.Error(err, "Failed to create ConfigMap in target namespace")
+	// Point references at the target namespace and the renamed copies
+	if err := h.rewriteObject(kind, newResource.Object, sourceNamespace, targetNamespace, options); err != nil {
+		logger.Error(err, "Failed to rewrite references")
 		return err
 	}
 
-	logger.Info("Successfully copied ConfigMap", "Name", name)
-	return nil
-}
-
-// copySecret copies a Secret resource
-func (h *ResourceHandler) copySecret(ctx context.Context, name, sourceNamespace, targetNamespace string) error {
-	logger := log.FromContext(ctx)
-
-	// Get the source secret
-	srcSecret := &corev1.Secret{}
-	if err := h.client.Get(ctx, client.ObjectKey{Namespace: sourceNamespace, Name: name}, srcSecret); err != nil {
-		logger.Error(err, "Failed to get source Secret")
+	// Give copied Ingresses and HTTPRoutes preview hostnames
+	if err := h.rewriteHosts(newResource, targetNamespace); err != nil {
+		logger.Error(err, "Failed to rewrite hosts")
 		return err
 	}
 
-	// Create a new secret for the target
-	newSecret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        srcSecret.Name,
-			Namespace:   targetNamespace,
-			Labels:      srcSecret.Labels,
-			Annotations: srcSecret.Annotations,
-			// Don't set owner references across namespaces - it won't work
-			// OwnerReferences: []metav1.OwnerReference{h.ownerRef},
-		},
-		Type:       srcSecret.Type,
-		Data:       srcSecret.Data,
-		StringData: srcSecret.StringData,
+	// Apply the transformation rules selected by kind and filter
+	if err := h.applyRules(newResource); err != nil {
+		logger.Error(err, "Failed to apply transformation rules")
+		return err
 	}
 
-	// Add labels to track resources created by ShareKube
-	if newSecret.Labels == nil {
-		newSecret.Labels = make(map[string]string)
+	// Add tracking labels
+	h.addOwnershipLabels(newResource)
+	h.setCopyConflictPolicy(newResource, options.conflictPolicy)
+
+	// Hold the copy back until the transformation pipeline ran, see Flush
+	if h.transformer != nil {
+		h.staged = append(h.staged, newResource)
+		logger.Info("Staged resource for transformation", "Kind", kind, "Name", name)
+		return nil
 	}
-	// Only keep ownership labels - simplify tracking to the minimum needed for cleanup
-	newSecret.Labels["sharekube.dev/owner-name"] = h.sharekubeName
-	newSecret.Labels["sharekube.dev/owner-namespace"] = h.sharekubeNamespace
-
-	// Remove resource version from metadata
-	newSecret.ResourceVersion = ""
 
-	// Create the secret in the target namespace
-	if err := h.client.Create(ctx, newSecret); err != nil {
-		logger.Error(err, "Failed to create Secret in target namespace")
+	if err := h.createResource(ctx, gvr, newResource); err != nil {
 		return err
 	}
 
-	logger.Info("Successfully copied Secret", "Name", name)
+	logger.Info("Successfully copied resource", "Kind", kind, "Name", name)
 	return nil
 }
 
-// copyGenericResource copies an arbitrary resource type using dynamic client
-func (h *ResourceHandler) copyGenericResource(ctx context.Context, kind, name, sourceNamespace, targetNamespace string) error {
+// createResource creates a prepared copy in its namespace
+func (h *ResourceHandler) createResource(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error {
 	logger := log.FromContext(ctx)
-	logger.Info("Copying generic resource", "Kind", kind, "Name", name)
 
-	// Determine the GVR for the kind
-	gvr, err := getGVRForKind(kind)
-	if err != nil {
-		logger.Error(err, "Failed to determine GVR for kind", "Kind", kind)
+	// Create the resource in the target namespace
+	setContentHash(obj)
+	_, err := h.dynClient.Resource(gvr).Namespace(obj.GetNamespace()).Create(ctx, obj, metav1.CreateOptions{})
+	adopted := false
+	if apierrors.IsAlreadyExists(err) {
+		var existing *unstructured.Unstructured
+		existing, err = h.dynClient.Resource(gvr).Namespace(obj.GetNamespace()).Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err == nil {
+			if h.owns(existing) {
+				// Copied by an earlier reconcile, e.g. before waiting for a wave or a snapshot
+				logger.Info("Resource was already copied", "Kind", obj.GetKind(), "Name", obj.GetName())
+				err = h.checkDrift(ctx, gvr, obj, existing)
+			} else {
+				err = h.resolveConflict(ctx, gvr, obj, existing)
+				adopted = err == nil
+			}
+		}
+	}
+	if errors.Is(err, ErrConflictSkipped) {
 		return err
 	}
-
-	// Get the source resource
-	srcResource, err := h.dynClient.Resource(gvr).Namespace(sourceNamespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
-		logger.Error(err, "Failed to get source resource")
+		logger.Error(err, "Failed to create resource in target namespace", "Kind", obj.GetKind(), "Name", obj.GetName())
 		return err
 	}
+	h.recordApplied(obj, adopted)
+	h.recordEndpoints(obj)
+	return nil
+}
 
-	// Prepare the resource for copying
-	newResource := srcResource.DeepCopy()
-	newResource.SetResourceVersion("")
-	newResource.SetNamespace(targetNamespace)
-	newResource.SetUID("")
-	newResource.SetCreationTimestamp(metav1.Time{})
-	newResource.SetGeneration(0)
-	newResource.SetSelfLink("")
-	newResource.SetManagedFields(nil)
-
-	// Don't add owner reference for cross-namespace resources
-	// ownerRefs := newResource.GetOwnerReferences()
-	// ownerRefs = append(ownerRefs, h.ownerRef)
-	// newResource.SetOwnerReferences(ownerRefs)
-
-	// Remove status field if present
-	unstructured.RemoveNestedField(newResource.Object, "status")
+// owns reports whether an object carries the ShareKube's ownership labels
+func (h *ResourceHandler) owns(obj *unstructured.Unstructured) bool {
+	labels := obj.GetLabels()
+	return labels["sharekube.dev/owner-name"] == h.sharekubeName && labels["sharekube.dev/owner-namespace"] == h.sharekubeNamespace
+}
 
-	// Add tracking labels
-	labels := newResource.GetLabels()
+// addOwnershipLabels labels a copy with the ShareKube that owns it
+func (h *ResourceHandler) addOwnershipLabels(obj *unstructured.Unstructured) {
+	labels := obj.GetLabels()
 	if labels == nil {
 		labels = make(map[string]string)
 	}
 	// Only keep ownership labels - simplify tracking to the minimum needed for cleanup
 	labels["sharekube.dev/owner-name"] = h.sharekubeName
 	labels["sharekube.dev/owner-namespace"] = h.sharekubeNamespace
-	newResource.SetLabels(labels)
-
-	// Create the resource in the target namespace
-	_, err = h.dynClient.Resource(gvr).Namespace(targetNamespace).Create(ctx, newResource, metav1.CreateOptions{})
-	if err != nil {
-		logger.Error(err, "Failed to create resource in target namespace")
-		return err
-	}
-
-	logger.Info("Successfully copied generic resource", "Kind", kind, "Name", name)
-	return nil
+	obj.SetLabels(labels)
 }
 
 // getGVRForKind returns the GroupVersionResource for a given kind
@@ -308,19 +284,31 @@ func (h *ResourceHandler) copyGenericResource(ctx context.Context, kind, name, s
 func getGVRForKind(kind string) (schema.GroupVersionResource, error) {
 	// This is a simplified mapping - in a real implementation you would use the discovery client
 	kindToGVR := map[string]schema.GroupVersionResource{
-		"Deployment":  {Group: "apps", Version: "v1", Resource: "deployments"},
-		"Service":     {Group: "", Version: "v1", Resource: "services"},
-		"ConfigMap":   {Group: "", Version: "v1", Resource: "configmaps"},
-		"Secret":      {Group: "", Version: "v1", Resource: "secrets"},
-		"Pod":         {Group: "", Version: "v1", Resource: "pods"},
-		"Ingress":     {Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
-		"StatefulSet": {Group: "apps", Version: "v1", Resource: "statefulsets"},
-		"DaemonSet":   {Group: "apps", Version: "v1", Resource: "daemonsets"},
-		"Job":         {Group: "batch", Version: "v1", Resource: "jobs"},
-		"CronJob":     {Group: "batch", Version: "v1", Resource: "cronjobs"},
+		"Deployment":              {Group: "apps", Version: "v1", Resource: "deployments"},
+		"Service":                 {Group: "", Version: "v1", Resource: "services"},
+		"ConfigMap":               {Group: "", Version: "v1", Resource: "configmaps"},
+		"Secret":                  {Group: "", Version: "v1", Resource: "secrets"},
+		"Pod":                     {Group: "", Version: "v1", Resource: "pods"},
+		"PersistentVolumeClaim":   {Group: "", Version: "v1", Resource: "persistentvolumeclaims"},
+		"ServiceAccount":          {Group: "", Version: "v1", Resource: "serviceaccounts"},
+		"Ingress":                 {Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+		"StatefulSet":             {Group: "apps", Version: "v1", Resource: "statefulsets"},
+		"ReplicaSet":              {Group: "apps", Version: "v1", Resource: "replicasets"},
+		"DaemonSet":               {Group: "apps", Version: "v1", Resource: "daemonsets"},
+		"Job":                     {Group: "batch", Version: "v1", Resource: "jobs"},
+		"CronJob":                 {Group: "batch", Version: "v1", Resource: "cronjobs"},
+		"HorizontalPodAutoscaler": {Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"},
+		"HTTPRoute":               {Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"},
+		"PodDisruptionBudget":     {Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"},
+		"NetworkPolicy":           {Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"},
+		"Role":                    {Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"},
+		"RoleBinding":             {Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"},
 	}
 
 	gvr, ok := kindToGVR[kind]
+	if !ok {
+		gvr, ok = lookupRegisteredKind(kind)
+	}
 	if !ok {
 		return schema.GroupVersionResource{}, fmt.Errorf("unknown kind: %s", kind)
 	}
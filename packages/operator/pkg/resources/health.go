@@ -0,0 +1,186 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// kindPriorities orders the kinds of a wave so the objects workloads depend on are copied before them.
+// Kinds not listed are copied along with the workloads.
+var kindPriorities = map[string]int{
+	"Namespace":               0,
+	"ServiceAccount":          1,
+	"Role":                    2,
+	"RoleBinding":             2,
+	"ConfigMap":               3,
+	"Secret":                  4,
+	"PersistentVolumeClaim":   5,
+	"Service":                 6,
+	"Deployment":              7,
+	"StatefulSet":             7,
+	"DaemonSet":               7,
+	"ReplicaSet":              7,
+	"Pod":                     7,
+	"Job":                     7,
+	"CronJob":                 7,
+	"HorizontalPodAutoscaler": 8,
+	"PodDisruptionBudget":     8,
+	"Ingress":                 9,
+	"HTTPRoute":               9,
+}
+
+// KindPriority returns the position of a kind in the copy order of a wave, lower first
+func KindPriority(kind string) int {
+	if priority, ok := kindPriorities[kind]; ok {
+		return priority
+	}
+	return kindPriorities["Deployment"]
+}
+
+// CheckReady reports whether the copy of a resource in the target namespace is ready, and why not
+func (h *ResourceHandler) CheckReady(ctx context.Context, kind, name, namespace string) (bool, string, error) {
+	gvr, err := getGVRForKind(kind)
+	if err != nil {
+		return false, "", err
+	}
+	obj, err := h.dynClient.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, "not found", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	ready, message := IsReady(obj)
+	return ready, message, nil
+}
+
+// IsReady reports whether an object has reached its desired state, and why not, following the rules of kstatus:
+// workloads must have observed their latest generation and have their replicas updated and available,
+// Jobs must be complete, claims bound, and other objects must not report a false Ready or true Reconciling
+// or Stalled condition. Objects without a status, like ConfigMaps, are ready once they exist.
+func IsReady(obj *unstructured.Unstructured) (bool, string) {
+	if observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration"); found && observed < obj.GetGeneration() {
+		return false, fmt.Sprintf("generation %d is not observed yet", obj.GetGeneration())
+	}
+
+	switch obj.GetKind() {
+	case "Deployment":
+		replicas := desiredReplicas(obj)
+		if updated := statusInt(obj, "updatedReplicas"); updated < replicas {
+			return false, fmt.Sprintf("%d of %d replicas updated", updated, replicas)
+		}
+		if available := statusInt(obj, "availableReplicas"); available < replicas {
+			return false, fmt.Sprintf("%d of %d replicas available", available, replicas)
+		}
+		return true, ""
+	case "StatefulSet":
+		replicas := desiredReplicas(obj)
+		if ready := statusInt(obj, "readyReplicas"); ready < replicas {
+			return false, fmt.Sprintf("%d of %d replicas ready", ready, replicas)
+		}
+		current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+		update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+		if current != update {
+			return false, fmt.Sprintf("rolling out revision %s", update)
+		}
+		return true, ""
+	case "ReplicaSet":
+		replicas := desiredReplicas(obj)
+		if available := statusInt(obj, "availableReplicas"); available < replicas {
+			return false, fmt.Sprintf("%d of %d replicas available", available, replicas)
+		}
+		return true, ""
+	case "DaemonSet":
+		if _, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration"); !found {
+			return false, "not scheduled yet"
+		}
+		desired := statusInt(obj, "desiredNumberScheduled")
+		if updated := statusInt(obj, "updatedNumberScheduled"); updated < desired {
+			return false, fmt.Sprintf("%d of %d pods updated", updated, desired)
+		}
+		if available := statusInt(obj, "numberAvailable"); available < desired {
+			return false, fmt.Sprintf("%d of %d pods available", available, desired)
+		}
+		return true, ""
+	case "Job":
+		if status, message, found := conditionOf(obj, "Failed"); found && status == string(metav1.ConditionTrue) {
+			return false, fmt.Sprintf("failed: %s", message)
+		}
+		if status, _, found := conditionOf(obj, "Complete"); found && status == string(metav1.ConditionTrue) {
+			return true, ""
+		}
+		completions, found, _ := unstructured.NestedInt64(obj.Object, "spec", "completions")
+		if !found {
+			completions = 1
+		}
+		return false, fmt.Sprintf("%d of %d completions", statusInt(obj, "succeeded"), completions)
+	case "PersistentVolumeClaim":
+		if phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase"); phase != "Bound" {
+			return false, "not bound"
+		}
+		return true, ""
+	case "Pod":
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		if phase == "Succeeded" {
+			return true, ""
+		}
+		if status, _, found := conditionOf(obj, "Ready"); found && status == string(metav1.ConditionTrue) {
+			return true, ""
+		}
+		return false, fmt.Sprintf("pod is %s", phase)
+	case "Service":
+		serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+		if serviceType != "LoadBalancer" {
+			return true, ""
+		}
+		if ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress"); len(ingress) == 0 {
+			return false, "load balancer is not provisioned yet"
+		}
+		return true, ""
+	}
+
+	if status, message, found := conditionOf(obj, "Stalled"); found && status == string(metav1.ConditionTrue) {
+		return false, fmt.Sprintf("stalled: %s", message)
+	}
+	if status, message, found := conditionOf(obj, "Reconciling"); found && status == string(metav1.ConditionTrue) {
+		return false, fmt.Sprintf("reconciling: %s", message)
+	}
+	if status, message, found := conditionOf(obj, "Ready"); found && status != string(metav1.ConditionTrue) {
+		return false, fmt.Sprintf("not ready: %s", message)
+	}
+	return true, ""
+}
+
+// desiredReplicas returns the replicas a workload asks for, which default to 1
+func desiredReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
+
+// statusInt returns an integer status field, or 0 if it is not set
+func statusInt(obj *unstructured.Unstructured, field string) int64 {
+	value, _, _ := unstructured.NestedInt64(obj.Object, "status", field)
+	return value
+}
+
+// conditionOf returns the status and message of a status condition
+func conditionOf(obj *unstructured.Unstructured, conditionType string) (string, string, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != conditionType {
+			continue
+		}
+		status, _ := condition["status"].(string)
+		message, _ := condition["message"].(string)
+		return status, message, true
+	}
+	return "", "", false
+}
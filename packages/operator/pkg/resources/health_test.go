@@ -0,0 +1,232 @@
+package resources
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestIsReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		object  string
+		ready   bool
+		message string
+	}{
+		{
+			name: "ConfigMap exists",
+			object: `
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: settings}`,
+			ready: true,
+		},
+		{
+			name: "generation not observed",
+			object: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: api, generation: 3}
+spec: {replicas: 1}
+status: {observedGeneration: 2, updatedReplicas: 1, availableReplicas: 1}`,
+			message: "generation 3 is not observed yet",
+		},
+		{
+			name: "Deployment rolling out",
+			object: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: api, generation: 1}
+spec: {replicas: 3}
+status: {observedGeneration: 1, updatedReplicas: 2, availableReplicas: 3}`,
+			message: "2 of 3 replicas updated",
+		},
+		{
+			name: "Deployment defaults to one replica",
+			object: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: api}
+status: {updatedReplicas: 1}`,
+			message: "0 of 1 replicas available",
+		},
+		{
+			name: "Deployment available",
+			object: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: api, generation: 1}
+spec: {replicas: 2}
+status: {observedGeneration: 1, updatedReplicas: 2, availableReplicas: 2}`,
+			ready: true,
+		},
+		{
+			name: "Deployment scaled to zero",
+			object: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: api}
+spec: {replicas: 0}`,
+			ready: true,
+		},
+		{
+			name: "StatefulSet rolling out a revision",
+			object: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata: {name: db}
+spec: {replicas: 1}
+status: {readyReplicas: 1, currentRevision: db-1, updateRevision: db-2}`,
+			message: "rolling out revision db-2",
+		},
+		{
+			name: "DaemonSet not scheduled",
+			object: `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata: {name: agent}`,
+			message: "not scheduled yet",
+		},
+		{
+			name: "DaemonSet available",
+			object: `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata: {name: agent}
+status: {observedGeneration: 1, desiredNumberScheduled: 2, updatedNumberScheduled: 2, numberAvailable: 2}`,
+			ready: true,
+		},
+		{
+			name: "Job running",
+			object: `
+apiVersion: batch/v1
+kind: Job
+metadata: {name: migrate}
+spec: {completions: 2}
+status: {succeeded: 1}`,
+			message: "1 of 2 completions",
+		},
+		{
+			name: "Job failed",
+			object: `
+apiVersion: batch/v1
+kind: Job
+metadata: {name: migrate}
+status:
+  conditions:
+  - {type: Failed, status: "True", message: BackoffLimitExceeded}`,
+			message: "failed: BackoffLimitExceeded",
+		},
+		{
+			name: "Job complete",
+			object: `
+apiVersion: batch/v1
+kind: Job
+metadata: {name: migrate}
+status:
+  conditions:
+  - {type: Complete, status: "True"}`,
+			ready: true,
+		},
+		{
+			name: "claim pending",
+			object: `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata: {name: data}
+status: {phase: Pending}`,
+			message: "not bound",
+		},
+		{
+			name: "completed Pod",
+			object: `
+apiVersion: v1
+kind: Pod
+metadata: {name: seed}
+status: {phase: Succeeded}`,
+			ready: true,
+		},
+		{
+			name: "LoadBalancer without an address",
+			object: `
+apiVersion: v1
+kind: Service
+metadata: {name: api}
+spec: {type: LoadBalancer}`,
+			message: "load balancer is not provisioned yet",
+		},
+		{
+			name: "ClusterIP Service",
+			object: `
+apiVersion: v1
+kind: Service
+metadata: {name: api}
+spec: {type: ClusterIP}`,
+			ready: true,
+		},
+		{
+			name: "custom resource reconciling",
+			object: `
+apiVersion: example.com/v1
+kind: Database
+metadata: {name: db}
+status:
+  conditions:
+  - {type: Reconciling, status: "True", message: provisioning}`,
+			message: "reconciling: provisioning",
+		},
+		{
+			name: "custom resource not ready",
+			object: `
+apiVersion: example.com/v1
+kind: Database
+metadata: {name: db}
+status:
+  conditions:
+  - {type: Ready, status: "False", message: waiting for storage}`,
+			message: "not ready: waiting for storage",
+		},
+		{
+			name: "custom resource ready",
+			object: `
+apiVersion: example.com/v1
+kind: Database
+metadata: {name: db}
+status:
+  conditions:
+  - {type: Ready, status: "True"}`,
+			ready: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := yaml.YAMLToJSON([]byte(tt.object))
+			if err != nil {
+				t.Fatal(err)
+			}
+			obj := &unstructured.Unstructured{}
+			if err := obj.UnmarshalJSON(data); err != nil {
+				t.Fatal(err)
+			}
+
+			ready, message := IsReady(obj)
+			if ready != tt.ready || message != tt.message {
+				t.Errorf("IsReady() = %v, %q, want %v, %q", ready, message, tt.ready, tt.message)
+			}
+		})
+	}
+}
+
+func TestKindPriority(t *testing.T) {
+	order := []string{"ServiceAccount", "RoleBinding", "ConfigMap", "Secret", "PersistentVolumeClaim", "Service", "Deployment", "HorizontalPodAutoscaler"}
+	for i := 1; i < len(order); i++ {
+		if KindPriority(order[i-1]) >= KindPriority(order[i]) {
+			t.Errorf("KindPriority(%s) is not lower than KindPriority(%s)", order[i-1], order[i])
+		}
+	}
+	if KindPriority("Widget") != KindPriority("Deployment") {
+		t.Error("KindPriority() of an unknown kind differs from the workloads'")
+	}
+}
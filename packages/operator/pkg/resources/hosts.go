@@ -0,0 +1,213 @@
+package resources
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// SetHostRewrite configures how hostnames of copied Ingresses and HTTPRoutes are rewritten
+func (h *ResourceHandler) SetHostRewrite(rules *sharekubev1alpha1.HostRewrite) {
+	h.hosts = rules
+}
+
+// Endpoints returns the preview URLs of the Ingresses and HTTPRoutes copied so far
+func (h *ResourceHandler) Endpoints() []sharekubev1alpha1.Endpoint {
+	return h.endpoints
+}
+
+// rewriteHosts applies the host rules to an Ingress or HTTPRoute copy
+func (h *ResourceHandler) rewriteHosts(obj *unstructured.Unstructured, targetNamespace string) error {
+	if h.hosts == nil {
+		return nil
+	}
+
+	tmpl, err := template.New("host").Option("missingkey=error").Parse(h.hosts.Template)
+	if err != nil {
+		return fmt.Errorf("invalid hosts template %q: %w", h.hosts.Template, err)
+	}
+	rendered := map[string]string{}
+	render := func(host string) (string, error) {
+		if value, ok := rendered[host]; ok {
+			return value, nil
+		}
+		value, err := h.renderHost(tmpl, host, targetNamespace)
+		if err != nil {
+			return "", err
+		}
+		rendered[host] = value
+		return value, nil
+	}
+
+	switch obj.GetKind() {
+	case "Ingress":
+		rules, _, err := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		if err != nil {
+			return err
+		}
+		for _, item := range rules {
+			rule, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			host, _ := rule["host"].(string)
+			if host == "" {
+				continue
+			}
+			if rule["host"], err = render(host); err != nil {
+				return err
+			}
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, rules, "spec", "rules"); err != nil {
+			return err
+		}
+
+		tls, found, err := unstructured.NestedSlice(obj.Object, "spec", "tls")
+		if err != nil || !found {
+			return err
+		}
+		for _, item := range tls {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			hosts, _, err := unstructured.NestedStringSlice(entry, "hosts")
+			if err != nil {
+				return err
+			}
+			for i, host := range hosts {
+				if hosts[i], err = render(host); err != nil {
+					return err
+				}
+			}
+			if err := unstructured.SetNestedStringSlice(entry, hosts, "hosts"); err != nil {
+				return err
+			}
+			// Production certificates do not cover preview hosts
+			if h.hosts.TLSSecretName != "" {
+				entry["secretName"] = h.hosts.TLSSecretName
+			}
+		}
+		return unstructured.SetNestedSlice(obj.Object, tls, "spec", "tls")
+
+	case "HTTPRoute":
+		hostnames, found, err := unstructured.NestedStringSlice(obj.Object, "spec", "hostnames")
+		if err != nil {
+			return err
+		}
+		if found {
+			for i, host := range hostnames {
+				if hostnames[i], err = render(host); err != nil {
+					return err
+				}
+			}
+			if err := unstructured.SetNestedStringSlice(obj.Object, hostnames, "spec", "hostnames"); err != nil {
+				return err
+			}
+		}
+
+		if len(h.hosts.ParentRefs) == 0 {
+			return nil
+		}
+		parentRefs := make([]interface{}, 0, len(h.hosts.ParentRefs))
+		for _, ref := range h.hosts.ParentRefs {
+			parentRef := map[string]interface{}{
+				"group": "gateway.networking.k8s.io",
+				"kind":  "Gateway",
+				"name":  ref.Name,
+			}
+			if ref.Namespace != "" {
+				parentRef["namespace"] = ref.Namespace
+			}
+			if ref.SectionName != "" {
+				parentRef["sectionName"] = ref.SectionName
+			}
+			parentRefs = append(parentRefs, parentRef)
+		}
+		return unstructured.SetNestedSlice(obj.Object, parentRefs, "spec", "parentRefs")
+	}
+
+	return nil
+}
+
+// renderHost renders the host template for a single original hostname
+func (h *ResourceHandler) renderHost(tmpl *template.Template, host, targetNamespace string) (string, error) {
+	wildcard := strings.HasPrefix(host, "*.")
+	bare := strings.TrimPrefix(host, "*.")
+	subdomain := strings.SplitN(bare, ".", 2)[0]
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]string{
+		"name":      h.sharekubeName,
+		"namespace": targetNamespace,
+		"host":      bare,
+		"subdomain": subdomain,
+	}); err != nil {
+		return "", fmt.Errorf("failed to render hosts template for %q: %w", host, err)
+	}
+
+	rendered := strings.ToLower(strings.TrimSpace(buf.String()))
+	if errs := validation.IsDNS1123Subdomain(rendered); len(errs) > 0 {
+		return "", fmt.Errorf("invalid host %q rendered for %q: %s", rendered, host, strings.Join(errs, ", "))
+	}
+	if wildcard {
+		rendered = "*." + rendered
+	}
+	return rendered, nil
+}
+
+// recordEndpoints collects the URLs served by a copied Ingress or HTTPRoute
+func (h *ResourceHandler) recordEndpoints(obj *unstructured.Unstructured) {
+	var hosts []string
+	secure := map[string]bool{}
+
+	switch obj.GetKind() {
+	case "Ingress":
+		rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		for _, item := range rules {
+			if rule, ok := item.(map[string]interface{}); ok {
+				if host, _ := rule["host"].(string); host != "" {
+					hosts = append(hosts, host)
+				}
+			}
+		}
+		tls, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tls")
+		for _, item := range tls {
+			if entry, ok := item.(map[string]interface{}); ok {
+				tlsHosts, _, _ := unstructured.NestedStringSlice(entry, "hosts")
+				for _, host := range tlsHosts {
+					secure[host] = true
+				}
+			}
+		}
+	case "HTTPRoute":
+		// The listener decides about TLS, which is not visible on the route
+		hosts, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "hostnames")
+	default:
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, host := range hosts {
+		// Wildcard hosts have no single URL
+		if seen[host] || strings.HasPrefix(host, "*.") {
+			continue
+		}
+		seen[host] = true
+		scheme := "http"
+		if secure[host] {
+			scheme = "https"
+		}
+		h.endpoints = append(h.endpoints, sharekubev1alpha1.Endpoint{
+			Kind: obj.GetKind(),
+			Name: obj.GetName(),
+			URL:  fmt.Sprintf("%s://%s/", scheme, host),
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestRenderHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		host     string
+		want     string
+		wantErr  bool
+	}{
+		{name: "subdomain", template: "{{.subdomain}}-{{.name}}.preview.example.com", host: "shop.example.com", want: "shop-my-preview.preview.example.com"},
+		{name: "namespace", template: "{{.namespace}}.{{.host}}", host: "shop.example.com", want: "preview.shop.example.com"},
+		{name: "wildcard", template: "{{.name}}.{{.host}}", host: "*.example.com", want: "*.my-preview.example.com"},
+		{name: "lowercased and trimmed", template: " {{.subdomain}}.Preview.Example.com ", host: "shop.example.com", want: "shop.preview.example.com"},
+		{name: "unknown key", template: "{{.branch}}.example.com", host: "shop.example.com", wantErr: true},
+		{name: "invalid host", template: "{{.subdomain}}_preview.example.com", host: "shop.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := template.Must(template.New("host").Option("missingkey=error").Parse(tt.template))
+			h := &ResourceHandler{sharekubeName: "my-preview"}
+			got, err := h.renderHost(tmpl, tt.host, "preview")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderHost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteHostsRecordsEndpoints(t *testing.T) {
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": "shop"},
+		"spec": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"host": "shop.example.com"},
+				map[string]interface{}{"host": "api.example.com"},
+				map[string]interface{}{"host": "*.example.com"},
+			},
+			"tls": []interface{}{
+				map[string]interface{}{"hosts": []interface{}{"shop.example.com"}, "secretName": "production-tls"},
+			},
+		},
+	}}
+
+	h := &ResourceHandler{sharekubeName: "pr-1", hosts: &sharekubev1alpha1.HostRewrite{
+		Template:      "{{.subdomain}}-{{.name}}.preview.example.com",
+		TLSSecretName: "preview-tls",
+	}}
+	if err := h.rewriteHosts(ingress, "preview"); err != nil {
+		t.Fatalf("rewriteHosts() error = %v", err)
+	}
+	h.recordEndpoints(ingress)
+
+	tls, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "tls")
+	if secret := tls[0].(map[string]interface{})["secretName"]; secret != "preview-tls" {
+		t.Errorf("tls secretName = %v, want preview-tls", secret)
+	}
+	want := []sharekubev1alpha1.Endpoint{
+		{Kind: "Ingress", Name: "shop", URL: "https://shop-pr-1.preview.example.com/"},
+		{Kind: "Ingress", Name: "shop", URL: "http://api-pr-1.preview.example.com/"},
+	}
+	if !reflect.DeepEqual(h.Endpoints(), want) {
+		t.Errorf("Endpoints() = %v, want %v", h.Endpoints(), want)
+	}
+}
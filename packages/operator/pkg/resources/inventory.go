@@ -0,0 +1,89 @@
+package resources
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// Applied returns the objects written to the target namespace, including copies that already existed
+func (h *ResourceHandler) Applied() []sharekubev1alpha1.InventoryEntry {
+	return h.applied
+}
+
+// recordApplied adds a written object to the inventory, marking objects that were adopted or overwritten
+func (h *ResourceHandler) recordApplied(obj *unstructured.Unstructured, adopted bool) {
+	h.applied = append(h.applied, sharekubev1alpha1.InventoryEntry{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Adopted:    adopted,
+	})
+}
+
+// Prune deletes an object of the inventory. Objects that are gone or no longer carry the ShareKube's
+// ownership labels are left alone.
+func (h *ResourceHandler) Prune(ctx context.Context, entry sharekubev1alpha1.InventoryEntry) error {
+	gvr, err := getGVRForKind(entry.Kind)
+	if err != nil {
+		return err
+	}
+
+	existing, err := h.dynClient.Resource(gvr).Namespace(entry.Namespace).Get(ctx, entry.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !h.owns(existing) {
+		return nil
+	}
+
+	// Dependents like the pods of a pruned Deployment go with it
+	propagation := metav1.DeletePropagationBackground
+	err = h.dynClient.Resource(gvr).Namespace(entry.Namespace).Delete(ctx, entry.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	log.FromContext(ctx).Info("Pruned copy", "Kind", entry.Kind, "Name", entry.Name, "Namespace", entry.Namespace)
+	return nil
+}
+
+// Release hands an adopted or overwritten object back by removing the ShareKube's ownership labels, keeping the object
+func (h *ResourceHandler) Release(ctx context.Context, entry sharekubev1alpha1.InventoryEntry) error {
+	gvr, err := getGVRForKind(entry.Kind)
+	if err != nil {
+		return err
+	}
+
+	existing, err := h.dynClient.Resource(gvr).Namespace(entry.Namespace).Get(ctx, entry.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !h.owns(existing) {
+		return nil
+	}
+
+	labels := existing.GetLabels()
+	delete(labels, "sharekube.dev/owner-name")
+	delete(labels, "sharekube.dev/owner-namespace")
+	existing.SetLabels(labels)
+	annotations := existing.GetAnnotations()
+	delete(annotations, ContentHashAnnotation)
+	existing.SetAnnotations(annotations)
+	if _, err := h.dynClient.Resource(gvr).Namespace(entry.Namespace).Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Released adopted object", "Kind", entry.Kind, "Name", entry.Name, "Namespace", entry.Namespace)
+	return nil
+}
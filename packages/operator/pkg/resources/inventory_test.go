@@ -0,0 +1,91 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestPruneAndRelease(t *testing.T) {
+	configMap := func(labels map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":        "settings",
+				"namespace":   "preview",
+				"labels":      labels,
+				"annotations": map[string]interface{}{ContentHashAnnotation: "abc"},
+			},
+		}}
+	}
+	owned := map[string]interface{}{"app": "api", "sharekube.dev/owner-name": "my-preview", "sharekube.dev/owner-namespace": "dev"}
+	otherOwner := map[string]interface{}{"sharekube.dev/owner-name": "other", "sharekube.dev/owner-namespace": "dev"}
+
+	tests := []struct {
+		name       string
+		existing   []runtime.Object
+		release    bool
+		wantExists bool
+		wantLabels map[string]string
+	}{
+		{name: "prunes an owned copy", existing: []runtime.Object{configMap(owned)}},
+		{name: "already gone"},
+		{name: "keeps an object of another ShareKube", existing: []runtime.Object{configMap(otherOwner)}, wantExists: true, wantLabels: map[string]string{"sharekube.dev/owner-name": "other", "sharekube.dev/owner-namespace": "dev"}},
+		{name: "releases an owned object", existing: []runtime.Object{configMap(owned)}, release: true, wantExists: true, wantLabels: map[string]string{"app": "api"}},
+		{name: "releases nothing once gone", release: true},
+	}
+
+	gvr, err := getGVRForKind("ConfigMap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := sharekubev1alpha1.InventoryEntry{APIVersion: "v1", Kind: "ConfigMap", Namespace: "preview", Name: "settings"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), tt.existing...)
+			h := NewResourceHandler(nil, dynClient, runtime.NewScheme(), metav1.OwnerReference{}, "my-preview", "dev")
+
+			var err error
+			if tt.release {
+				err = h.Release(context.Background(), entry)
+			} else {
+				err = h.Prune(context.Background(), entry)
+			}
+			if err != nil {
+				t.Fatalf("Prune() or Release() error = %v", err)
+			}
+
+			obj, err := dynClient.Resource(gvr).Namespace("preview").Get(context.Background(), "settings", metav1.GetOptions{})
+			if !tt.wantExists {
+				if !apierrors.IsNotFound(err) {
+					t.Errorf("Get() error = %v, want not found", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			labels := obj.GetLabels()
+			if len(labels) != len(tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", labels, tt.wantLabels)
+			}
+			for key, value := range tt.wantLabels {
+				if labels[key] != value {
+					t.Errorf("labels = %v, want %v", labels, tt.wantLabels)
+				}
+			}
+			if _, ok := obj.GetAnnotations()[ContentHashAnnotation]; ok == tt.release {
+				t.Errorf("annotations = %v, want the content hash removed only on release", obj.GetAnnotations())
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package resources
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// NamePlaceholder is replaced with the source object's name in name templates
+const NamePlaceholder = "$(NAME)"
+
+// InstanceLabel is added to the selectors and pod labels of renamed copies so they never select the originals
+const InstanceLabel = "sharekube.dev/instance"
+
+// nameReference is a field that refers to another object by name
+type nameReference struct {
+	// kind is the kind of the referenced object
+	kind string
+	// path locates the name; "*" matches every list item
+	path []string
+}
+
+// podSpecNameReferences lists name references inside a pod spec
+var podSpecNameReferences = []nameReference{
+	{kind: "ConfigMap", path: []string{"volumes", "*", "configMap", "name"}},
+	{kind: "ConfigMap", path: []string{"volumes", "*", "projected", "sources", "*", "configMap", "name"}},
+	{kind: "Secret", path: []string{"volumes", "*", "secret", "secretName"}},
+	{kind: "Secret", path: []string{"volumes", "*", "projected", "sources", "*", "secret", "name"}},
+	{kind: "Secret", path: []string{"imagePullSecrets", "*", "name"}},
+	{kind: "PersistentVolumeClaim", path: []string{"volumes", "*", "persistentVolumeClaim", "claimName"}},
+	{kind: "ServiceAccount", path: []string{"serviceAccountName"}},
+}
+
+// containerNameReferences lists name references inside a container
+var containerNameReferences = []nameReference{
+	{kind: "ConfigMap", path: []string{"env", "*", "valueFrom", "configMapKeyRef", "name"}},
+	{kind: "ConfigMap", path: []string{"envFrom", "*", "configMapRef", "name"}},
+	{kind: "Secret", path: []string{"env", "*", "valueFrom", "secretKeyRef", "name"}},
+	{kind: "Secret", path: []string{"envFrom", "*", "secretRef", "name"}},
+}
+
+// objectNameReferences lists name references outside pod specs, by the kind of the referring object
+var objectNameReferences = map[string][]nameReference{
+	"Ingress": {
+		{kind: "Service", path: []string{"spec", "defaultBackend", "service", "name"}},
+		{kind: "Service", path: []string{"spec", "rules", "*", "http", "paths", "*", "backend", "service", "name"}},
+		{kind: "Secret", path: []string{"spec", "tls", "*", "secretName"}},
+	},
+	"HTTPRoute": {
+		{kind: "Service", path: []string{"spec", "rules", "*", "backendRefs", "*", "name"}},
+	},
+	"StatefulSet": {
+		{kind: "Service", path: []string{"spec", "serviceName"}},
+	},
+}
+
+// podSpecPaths locates the pod specs of workload kinds
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// SetNameTemplate renames copies with the template and updates references between the copied resources
+func (h *ResourceHandler) SetNameTemplate(template string, copied []sharekubev1alpha1.Resource) {
+	h.nameTemplate = template
+	h.copiedNames = make(map[string]map[string]bool)
+	for _, resource := range copied {
+		if h.copiedNames[resource.Kind] == nil {
+			h.copiedNames[resource.Kind] = make(map[string]bool)
+		}
+		h.copiedNames[resource.Kind][resource.Name] = true
+	}
+}
+
+// RenderName applies a name template to the name of a source object
+func RenderName(template, name string) (string, error) {
+	if template == "" {
+		return name, nil
+	}
+	if !strings.Contains(template, NamePlaceholder) {
+		return "", fmt.Errorf("invalid nameTemplate %q: must contain %s", template, NamePlaceholder)
+	}
+	rendered := strings.ReplaceAll(template, NamePlaceholder, name)
+	if errs := validation.IsDNS1123Subdomain(rendered); len(errs) > 0 {
+		return "", fmt.Errorf("invalid name %q rendered from nameTemplate: %s", rendered, strings.Join(errs, ", "))
+	}
+	return rendered, nil
+}
+
+// renameObject renames the copy and the references it holds to other copied resources
+func (h *ResourceHandler) renameObject(kind string, obj map[string]interface{}) error {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	if metadata == nil {
+		return fmt.Errorf("%s has no metadata", kind)
+	}
+	name, _ := metadata["name"].(string)
+	renamed, err := RenderName(h.nameTemplate, name)
+	if err != nil {
+		return err
+	}
+	metadata["name"] = renamed
+
+	refs := append([]nameReference{}, objectNameReferences[kind]...)
+	if path, ok := podSpecPaths[kind]; ok {
+		for _, ref := range podSpecNameReferences {
+			refs = append(refs, nameReference{kind: ref.kind, path: concatPath(path, ref.path)})
+		}
+		for _, containers := range []string{"initContainers", "containers"} {
+			for _, ref := range containerNameReferences {
+				refs = append(refs, nameReference{kind: ref.kind, path: concatPath(path, []string{containers, "*"}, ref.path)})
+			}
+		}
+	}
+	for _, ref := range refs {
+		if err := h.renameAtPath(obj, ref.path, ref.kind); err != nil {
+			return err
+		}
+	}
+
+	// Autoscalers name their target kind next to the name
+	if kind == "HorizontalPodAutoscaler" {
+		targetKind, _, _ := unstructured.NestedString(obj, "spec", "scaleTargetRef", "kind")
+		if err := h.renameAtPath(obj, []string{"spec", "scaleTargetRef", "name"}, targetKind); err != nil {
+			return err
+		}
+	}
+
+	// RoleBindings name the kind of their role and of each subject next to the name; users and groups are never renamed
+	if kind == "RoleBinding" {
+		if roleRef, ok := obj["roleRef"].(map[string]interface{}); ok && roleRef["kind"] == "Role" {
+			if err := h.renameAtPath(roleRef, []string{"name"}, "Role"); err != nil {
+				return err
+			}
+		}
+		subjects, _ := obj["subjects"].([]interface{})
+		for _, subject := range subjects {
+			if fields, ok := subject.(map[string]interface{}); ok && fields["kind"] == "ServiceAccount" {
+				if err := h.renameAtPath(fields, []string{"name"}, "ServiceAccount"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return h.isolateSelectors(kind, obj)
+}
+
+// renameAtPath renames the reference at path when it names a copied resource of the kind
+func (h *ResourceHandler) renameAtPath(value interface{}, path []string, kind string) error {
+	if len(path) == 0 {
+		return nil
+	}
+	if path[0] == "*" {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for _, item := range items {
+			if err := h.renameAtPath(item, path[1:], kind); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if len(path) > 1 {
+		return h.renameAtPath(fields[path[0]], path[1:], kind)
+	}
+
+	current, ok := fields[path[0]].(string)
+	if !ok || !h.copiedNames[kind][current] {
+		return nil
+	}
+	renamed, err := RenderName(h.nameTemplate, current)
+	if err != nil {
+		return err
+	}
+	fields[path[0]] = renamed
+	return nil
+}
+
+// isolateSelectors adds the instance label to pod labels and selectors so renamed copies only select each other
+func (h *ResourceHandler) isolateSelectors(kind string, obj map[string]interface{}) error {
+	var labelPaths [][]string
+	switch kind {
+	case "Service":
+		// Services without a selector point at manually managed endpoints
+		if selector, _, _ := unstructured.NestedStringMap(obj, "spec", "selector"); len(selector) > 0 {
+			labelPaths = append(labelPaths, []string{"spec", "selector"})
+		}
+	case "Pod":
+		labelPaths = append(labelPaths, []string{"metadata", "labels"})
+	case "Deployment", "StatefulSet", "ReplicaSet", "DaemonSet":
+		labelPaths = append(labelPaths,
+			[]string{"spec", "selector", "matchLabels"},
+			[]string{"spec", "template", "metadata", "labels"})
+	case "Job":
+		// Job selectors are generated by the API server
+		labelPaths = append(labelPaths, []string{"spec", "template", "metadata", "labels"})
+	case "CronJob":
+		labelPaths = append(labelPaths, []string{"spec", "jobTemplate", "spec", "template", "metadata", "labels"})
+	case "PodDisruptionBudget":
+		labelPaths = append(labelPaths, []string{"spec", "selector", "matchLabels"})
+	}
+
+	for _, path := range labelPaths {
+		labels, _, err := unstructured.NestedStringMap(obj, path...)
+		if err != nil {
+			return err
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[InstanceLabel] = h.sharekubeName
+		if err := unstructured.SetNestedStringMap(obj, labels, path...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// concatPath joins path segments into a new slice
+func concatPath(parts ...[]string) []string {
+	var path []string
+	for _, part := range parts {
+		path = append(path, part...)
+	}
+	return path
+}
@@ -0,0 +1,196 @@
+package resources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/yaml"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestCopyRoleBindingRenamesServiceAccountSubjects(t *testing.T) {
+	source := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "RoleBinding",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "dev"},
+		"roleRef": map[string]interface{}{
+			"apiGroup": "rbac.authorization.k8s.io",
+			"kind":     "Role",
+			"name":     "app",
+		},
+		"subjects": []interface{}{
+			map[string]interface{}{"kind": "ServiceAccount", "name": "app", "namespace": "dev"},
+			map[string]interface{}{"kind": "User", "name": "app"},
+		},
+	}}
+	dynClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), source)
+	handler := NewResourceHandler(nil, dynClient, runtime.NewScheme(), metav1.OwnerReference{}, "my-preview", "ci")
+	handler.SetNameTemplate("$(NAME)-pr1", []sharekubev1alpha1.Resource{
+		{Kind: "ServiceAccount", Name: "app"},
+		{Kind: "Role", Name: "app"},
+		{Kind: "RoleBinding", Name: "app"},
+	})
+
+	if err := handler.CopyResource(context.Background(), "RoleBinding", "app", "dev", "preview"); err != nil {
+		t.Fatalf("CopyResource() error = %v", err)
+	}
+
+	gvr, _ := getGVRForKind("RoleBinding")
+	copied, err := dynClient.Resource(gvr).Namespace("preview").Get(context.Background(), "app-pr1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("renamed RoleBinding not found: %v", err)
+	}
+	if roleName, _, _ := unstructured.NestedString(copied.Object, "roleRef", "name"); roleName != "app-pr1" {
+		t.Errorf("roleRef.name = %q, want app-pr1", roleName)
+	}
+	subjects, _, _ := unstructured.NestedSlice(copied.Object, "subjects")
+	want := []string{"app-pr1", "app"}
+	for i, subject := range subjects {
+		if name := subject.(map[string]interface{})["name"]; name != want[i] {
+			t.Errorf("subjects[%d].name = %v, want %s", i, name, want[i])
+		}
+	}
+}
+
+func TestRenderName(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{name: "no template", template: "", want: "app"},
+		{name: "prefix", template: "pr-42-$(NAME)", want: "pr-42-app"},
+		{name: "suffix", template: "$(NAME)-preview", want: "app-preview"},
+		{name: "repeated placeholder", template: "$(NAME)-$(NAME)", want: "app-app"},
+		{name: "missing placeholder", template: "preview", wantErr: true},
+		{name: "invalid rendered name", template: "PR_$(NAME)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderName(tt.template, "app")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenderName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RenderName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameObject(t *testing.T) {
+	copied := []sharekubev1alpha1.Resource{
+		{Kind: "ConfigMap", Name: "config"},
+		{Kind: "Secret", Name: "credentials"},
+		{Kind: "Service", Name: "web"},
+		{Kind: "Deployment", Name: "web"},
+	}
+
+	tests := []struct {
+		name   string
+		kind   string
+		object string
+		want   string
+	}{
+		{
+			name: "references to copies in a pod template",
+			kind: "Deployment",
+			object: `
+metadata: {name: web}
+spec:
+  selector: {matchLabels: {app: web}}
+  template:
+    metadata: {labels: {app: web}}
+    spec:
+      volumes:
+      - {name: config, configMap: {name: config}}
+      - {name: shared, configMap: {name: shared}}
+      containers:
+      - name: web
+        envFrom: [{secretRef: {name: credentials}}]`,
+			want: `
+metadata: {name: pr-web}
+spec:
+  selector: {matchLabels: {app: web, sharekube.dev/instance: my-preview}}
+  template:
+    metadata: {labels: {app: web, sharekube.dev/instance: my-preview}}
+    spec:
+      volumes:
+      - {name: config, configMap: {name: pr-config}}
+      - {name: shared, configMap: {name: shared}}
+      containers:
+      - name: web
+        envFrom: [{secretRef: {name: pr-credentials}}]`,
+		},
+		{
+			name: "Ingress backends",
+			kind: "Ingress",
+			object: `
+metadata: {name: web}
+spec:
+  rules:
+  - http:
+      paths:
+      - backend: {service: {name: web}}
+      - backend: {service: {name: api}}`,
+			want: `
+metadata: {name: pr-web}
+spec:
+  rules:
+  - http:
+      paths:
+      - backend: {service: {name: pr-web}}
+      - backend: {service: {name: api}}`,
+		},
+		{
+			name: "autoscaler target",
+			kind: "HorizontalPodAutoscaler",
+			object: `
+metadata: {name: web}
+spec: {scaleTargetRef: {kind: Deployment, name: web}}`,
+			want: `
+metadata: {name: pr-web}
+spec: {scaleTargetRef: {kind: Deployment, name: pr-web}}`,
+		},
+		{
+			name: "Service without a selector",
+			kind: "Service",
+			object: `
+metadata: {name: web}
+spec: {ports: [{port: 80}]}`,
+			want: `
+metadata: {name: pr-web}
+spec: {ports: [{port: 80}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var obj, want map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.object), &obj); err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			h := &ResourceHandler{sharekubeName: "my-preview"}
+			h.SetNameTemplate("pr-$(NAME)", copied)
+			if err := h.renameObject(tt.kind, obj); err != nil {
+				t.Fatalf("renameObject() error = %v", err)
+			}
+			if !reflect.DeepEqual(obj, want) {
+				got, _ := yaml.Marshal(obj)
+				t.Errorf("renameObject() =\n%s", got)
+			}
+		})
+	}
+}
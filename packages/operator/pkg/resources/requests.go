@@ -0,0 +1,135 @@
+package resources
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// WorkloadFootprint describes the pods a copy of a workload would run
+type WorkloadFootprint struct {
+	// PodSpec is the template of the pods the workload runs
+	PodSpec *corev1.PodSpec
+	// Replicas is the number of pods the workload runs
+	Replicas int32
+	// Scalable reports whether the replica count can be overridden with WithReplicas
+	Scalable bool
+}
+
+// GetWorkloadFootprint returns the footprint of a workload, or nil for kinds that do not run pods
+func GetWorkloadFootprint(ctx context.Context, c client.Reader, kind, name, namespace string) (*WorkloadFootprint, error) {
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+
+	switch kind {
+	case "Deployment":
+		obj := &appsv1.Deployment{}
+		if err := c.Get(ctx, key, obj); err != nil {
+			return nil, err
+		}
+		return &WorkloadFootprint{PodSpec: &obj.Spec.Template.Spec, Replicas: ReplicasOrDefault(obj.Spec.Replicas), Scalable: true}, nil
+	case "StatefulSet":
+		obj := &appsv1.StatefulSet{}
+		if err := c.Get(ctx, key, obj); err != nil {
+			return nil, err
+		}
+		return &WorkloadFootprint{PodSpec: &obj.Spec.Template.Spec, Replicas: ReplicasOrDefault(obj.Spec.Replicas), Scalable: true}, nil
+	case "ReplicaSet":
+		obj := &appsv1.ReplicaSet{}
+		if err := c.Get(ctx, key, obj); err != nil {
+			return nil, err
+		}
+		return &WorkloadFootprint{PodSpec: &obj.Spec.Template.Spec, Replicas: ReplicasOrDefault(obj.Spec.Replicas), Scalable: true}, nil
+	case "DaemonSet":
+		// The node count of the target is unknown, so a DaemonSet is counted as a single pod
+		obj := &appsv1.DaemonSet{}
+		if err := c.Get(ctx, key, obj); err != nil {
+			return nil, err
+		}
+		return &WorkloadFootprint{PodSpec: &obj.Spec.Template.Spec, Replicas: 1}, nil
+	case "Job":
+		obj := &batchv1.Job{}
+		if err := c.Get(ctx, key, obj); err != nil {
+			return nil, err
+		}
+		return &WorkloadFootprint{PodSpec: &obj.Spec.Template.Spec, Replicas: ReplicasOrDefault(obj.Spec.Parallelism)}, nil
+	case "Pod":
+		obj := &corev1.Pod{}
+		if err := c.Get(ctx, key, obj); err != nil {
+			return nil, err
+		}
+		return &WorkloadFootprint{PodSpec: &obj.Spec, Replicas: 1}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// PodRequests returns the CPU and memory requests of a single pod
+func (f *WorkloadFootprint) PodRequests() corev1.ResourceList {
+	return podRequests(f.PodSpec)
+}
+
+// Requests returns the aggregate CPU and memory requests of all replicas
+func (f *WorkloadFootprint) Requests() corev1.ResourceList {
+	return scaleResourceList(f.PodRequests(), f.Replicas)
+}
+
+// WorkloadRequests returns the aggregate CPU and memory requests a copy of the given workload would make
+// once the scaling rules are applied. Kinds that do not run pods return an empty list.
+func WorkloadRequests(ctx context.Context, c client.Reader, kind, name, namespace string, rules *sharekubev1alpha1.ScalingRules) (corev1.ResourceList, error) {
+	footprint, err := GetWorkloadFootprint(ctx, c, kind, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if footprint == nil {
+		return corev1.ResourceList{}, nil
+	}
+	if err := footprint.ApplyScaling(rules); err != nil {
+		return nil, err
+	}
+	return footprint.Requests(), nil
+}
+
+// AddResourceList adds the CPU and memory quantities of src into dst
+func AddResourceList(dst, src corev1.ResourceList) {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		q, ok := src[name]
+		if !ok {
+			continue
+		}
+		total := dst[name]
+		total.Add(q)
+		dst[name] = total
+	}
+}
+
+// scaleResourceList multiplies every quantity in the list by the given factor
+func scaleResourceList(list corev1.ResourceList, factor int32) corev1.ResourceList {
+	scaled := corev1.ResourceList{}
+	for name, q := range list {
+		scaled[name] = *resource.NewMilliQuantity(q.MilliValue()*int64(factor), q.Format)
+	}
+	return scaled
+}
+
+// podRequests sums the CPU and memory requests of all regular containers in a pod spec
+func podRequests(spec *corev1.PodSpec) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		AddResourceList(total, container.Resources.Requests)
+	}
+	return total
+}
+
+// ReplicasOrDefault returns the replica count, defaulting to one like the API server does
+func ReplicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
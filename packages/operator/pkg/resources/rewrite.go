@@ -0,0 +1,265 @@
+package resources
+
+import (
+	"regexp"
+	"strings"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// NamespacePlaceholder is replaced with the source and target namespace in reference rewrite patterns
+const NamespacePlaceholder = "$(NAMESPACE)"
+
+// namespaceLabelKey is the label every namespace carries with its own name
+const namespaceLabelKey = "kubernetes.io/metadata.name"
+
+// wellKnownNamespacePaths lists fields that hold a namespace name; "*" matches every list item
+var wellKnownNamespacePaths = [][]string{
+	// RoleBinding and ClusterRoleBinding subjects
+	{"subjects", "*", "namespace"},
+	// Gateway API route parents and backends
+	{"spec", "parentRefs", "*", "namespace"},
+	{"spec", "rules", "*", "backendRefs", "*", "namespace"},
+}
+
+// namespaceSelectorPaths lists the NetworkPolicy peers that can select the source namespace by name
+var namespaceSelectorPaths = [][]string{
+	{"spec", "ingress", "*", "from", "*", "namespaceSelector"},
+	{"spec", "egress", "*", "to", "*", "namespaceSelector"},
+}
+
+// SetReferenceRewrite configures how references to the source namespace are rewritten in copies
+func (h *ResourceHandler) SetReferenceRewrite(rules *sharekubev1alpha1.ReferenceRewrite) {
+	h.referenceRewrite = rules
+}
+
+// WithoutReferenceRewrite copies the resource without rewriting source namespace references
+func WithoutReferenceRewrite() CopyOption {
+	return func(o *copyOptions) {
+		o.skipReferenceRewrite = true
+	}
+}
+
+// rewriteObject points namespace references at the target namespace and renames the copy when a name template is set
+func (h *ResourceHandler) rewriteObject(kind string, obj map[string]interface{}, sourceNamespace, targetNamespace string, options copyOptions) error {
+	if h.shouldRewriteReferences(sourceNamespace, targetNamespace, options) {
+		h.rewriteReferences(kind, obj, sourceNamespace, targetNamespace)
+	}
+	if h.nameTemplate != "" {
+		return h.renameObject(kind, obj)
+	}
+	return nil
+}
+
+// shouldRewriteReferences reports whether the rewrite pass runs for this copy
+func (h *ResourceHandler) shouldRewriteReferences(sourceNamespace, targetNamespace string, options copyOptions) bool {
+	if sourceNamespace == targetNamespace || options.skipReferenceRewrite {
+		return false
+	}
+	return h.referenceRewrite == nil || !h.referenceRewrite.Disabled
+}
+
+// rewriteReferences replaces references to the source namespace in an unstructured object with the target namespace.
+// It rewrites cluster DNS names and service account usernames in every string outside the object's metadata,
+// namespace fields at well-known paths, and the configured patterns in ConfigMap data. Secret data is left untouched.
+func (h *ResourceHandler) rewriteReferences(kind string, obj map[string]interface{}, sourceNamespace, targetNamespace string) {
+	replacer := newReferenceReplacer(sourceNamespace, targetNamespace)
+
+	for _, path := range wellKnownNamespacePaths {
+		replaceAtPath(obj, path, sourceNamespace, targetNamespace)
+	}
+	for _, path := range namespaceSelectorPaths {
+		visitPath(obj, path, func(selector interface{}) {
+			rewriteNamespaceSelector(selector, sourceNamespace, targetNamespace)
+		})
+	}
+
+	for key, value := range obj {
+		switch {
+		case key == "apiVersion" || key == "kind" || key == "metadata" || key == "status":
+			continue
+		case kind == "Secret" && (key == "data" || key == "stringData"):
+			continue
+		}
+		obj[key] = rewriteStrings(value, replacer.replace)
+	}
+
+	// Annotations often carry upstream hosts, for example for ingress controllers
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			for key, value := range annotations {
+				if strings.HasPrefix(key, "sharekube.dev/") {
+					continue
+				}
+				annotations[key] = rewriteStrings(value, replacer.replace)
+			}
+		}
+	}
+
+	if kind == "ConfigMap" && h.referenceRewrite != nil && len(h.referenceRewrite.Patterns) > 0 {
+		var pairs []string
+		for _, pattern := range h.referenceRewrite.Patterns {
+			if !strings.Contains(pattern, NamespacePlaceholder) {
+				continue
+			}
+			pairs = append(pairs,
+				strings.ReplaceAll(pattern, NamespacePlaceholder, sourceNamespace),
+				strings.ReplaceAll(pattern, NamespacePlaceholder, targetNamespace))
+		}
+		if len(pairs) > 0 {
+			patterns := strings.NewReplacer(pairs...)
+			if data, ok := obj["data"].(map[string]interface{}); ok {
+				obj["data"] = rewriteStrings(data, patterns.Replace)
+			}
+		}
+	}
+}
+
+// referenceReplacer rewrites namespace references embedded in free-form strings
+type referenceReplacer struct {
+	dnsName         *regexp.Regexp
+	shortDNSName    *regexp.Regexp
+	serviceAccount  *regexp.Regexp
+	sourceNamespace string
+	targetNamespace string
+}
+
+// newReferenceReplacer matches <service>.<namespace>.svc and <service>.<namespace> DNS names
+// and system:serviceaccount:<namespace>: usernames
+func newReferenceReplacer(sourceNamespace, targetNamespace string) *referenceReplacer {
+	quoted := regexp.QuoteMeta(sourceNamespace)
+	return &referenceReplacer{
+		dnsName: regexp.MustCompile(`\.` + quoted + `\.svc\b`),
+		// The service name must not follow a dot, so subdomains of longer hostnames are left alone
+		shortDNSName:    regexp.MustCompile(`(?:^|[^\w.-])[a-z0-9](?:[-a-z0-9]*[a-z0-9])?\.` + quoted),
+		serviceAccount:  regexp.MustCompile(`\bsystem:serviceaccount:` + quoted + `:`),
+		sourceNamespace: sourceNamespace,
+		targetNamespace: targetNamespace,
+	}
+}
+
+// replace rewrites the references in a single string
+func (r *referenceReplacer) replace(value string) string {
+	value = r.dnsName.ReplaceAllLiteralString(value, "."+r.targetNamespace+".svc")
+	value = r.replaceShortDNSNames(value)
+	return r.serviceAccount.ReplaceAllLiteralString(value, "system:serviceaccount:"+r.targetNamespace+":")
+}
+
+// replaceShortDNSNames rewrites <service>.<namespace> names that end the hostname, such as
+// api.dev or api.dev:8080, but not api.dev.example.com
+func (r *referenceReplacer) replaceShortDNSNames(value string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range r.shortDNSName.FindAllStringIndex(value, -1) {
+		end := match[1]
+		if end < len(value) && isHostnameByte(value[end]) {
+			continue
+		}
+		b.WriteString(value[last : end-len(r.sourceNamespace)])
+		b.WriteString(r.targetNamespace)
+		last = end
+	}
+	if last == 0 {
+		return value
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// isHostnameByte reports whether c can continue a hostname
+func isHostnameByte(c byte) bool {
+	return c == '.' || c == '-' || c == '_' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// rewriteNamespaceSelector points a label selector matching the source namespace by name at the target namespace
+func rewriteNamespaceSelector(value interface{}, from, to string) {
+	selector, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	replaceAtPath(selector, []string{"matchLabels", namespaceLabelKey}, from, to)
+
+	expressions, _ := selector["matchExpressions"].([]interface{})
+	for _, item := range expressions {
+		expression, ok := item.(map[string]interface{})
+		if !ok || expression["key"] != namespaceLabelKey {
+			continue
+		}
+		values, _ := expression["values"].([]interface{})
+		for i, v := range values {
+			if v == from {
+				values[i] = to
+			}
+		}
+	}
+}
+
+// rewriteStrings applies fn to every string in a nested unstructured value
+func rewriteStrings(value interface{}, fn func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = rewriteStrings(item, fn)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = rewriteStrings(item, fn)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// visitPath calls fn with every value found at path
+func visitPath(value interface{}, path []string, fn func(interface{})) {
+	if len(path) == 0 {
+		if value != nil {
+			fn(value)
+		}
+		return
+	}
+	if path[0] == "*" {
+		items, _ := value.([]interface{})
+		for _, item := range items {
+			visitPath(item, path[1:], fn)
+		}
+		return
+	}
+	if fields, ok := value.(map[string]interface{}); ok {
+		visitPath(fields[path[0]], path[1:], fn)
+	}
+}
+
+// replaceAtPath replaces the string at path with to when it equals from
+func replaceAtPath(value interface{}, path []string, from, to string) {
+	if len(path) == 0 {
+		return
+	}
+	if path[0] == "*" {
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for _, item := range items {
+			replaceAtPath(item, path[1:], from, to)
+		}
+		return
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		if current, ok := fields[path[0]].(string); ok && current == from {
+			fields[path[0]] = to
+		}
+		return
+	}
+	replaceAtPath(fields[path[0]], path[1:], from, to)
+}
@@ -0,0 +1,206 @@
+package resources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/yaml"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestCopyRoleBindingRewritesSubjects(t *testing.T) {
+	source := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "RoleBinding",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "dev"},
+		"roleRef": map[string]interface{}{
+			"apiGroup": "rbac.authorization.k8s.io",
+			"kind":     "Role",
+			"name":     "app",
+		},
+		"subjects": []interface{}{
+			map[string]interface{}{"kind": "ServiceAccount", "name": "app", "namespace": "dev"},
+			map[string]interface{}{"kind": "ServiceAccount", "name": "monitoring", "namespace": "observability"},
+		},
+	}}
+	dynClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), source)
+	handler := NewResourceHandler(nil, dynClient, runtime.NewScheme(), metav1.OwnerReference{}, "my-preview", "ci")
+
+	if err := handler.CopyResource(context.Background(), "RoleBinding", "app", "dev", "preview"); err != nil {
+		t.Fatalf("CopyResource() error = %v", err)
+	}
+
+	gvr, _ := getGVRForKind("RoleBinding")
+	copied, err := dynClient.Resource(gvr).Namespace("preview").Get(context.Background(), "app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("copied RoleBinding not found: %v", err)
+	}
+	subjects, _, _ := unstructured.NestedSlice(copied.Object, "subjects")
+	want := []string{"preview", "observability"}
+	for i, subject := range subjects {
+		if namespace := subject.(map[string]interface{})["namespace"]; namespace != want[i] {
+			t.Errorf("subjects[%d].namespace = %v, want %s", i, namespace, want[i])
+		}
+	}
+	if owner := copied.GetLabels()["sharekube.dev/owner-name"]; owner != "my-preview" {
+		t.Errorf("owner-name label = %q, want my-preview", owner)
+	}
+}
+
+func TestRewriteReferences(t *testing.T) {
+	patterns := &sharekubev1alpha1.ReferenceRewrite{Patterns: []string{"db-$(NAMESPACE).internal", "no placeholder"}}
+
+	tests := []struct {
+		name    string
+		kind    string
+		rewrite *sharekubev1alpha1.ReferenceRewrite
+		object  string
+		want    string
+	}{
+		{
+			name: "cluster DNS names and service accounts",
+			kind: "Deployment",
+			object: `
+metadata: {name: app, namespace: dev, labels: {host: api.dev.svc}}
+spec:
+  env:
+  - {name: API, value: "http://api.dev.svc.cluster.local:8080"}
+  - {name: OTHER, value: "http://api.devel.svc:8080"}
+  - {name: USER, value: "system:serviceaccount:dev:app"}`,
+			want: `
+metadata: {name: app, namespace: dev, labels: {host: api.dev.svc}}
+spec:
+  env:
+  - {name: API, value: "http://api.preview.svc.cluster.local:8080"}
+  - {name: OTHER, value: "http://api.devel.svc:8080"}
+  - {name: USER, value: "system:serviceaccount:preview:app"}`,
+		},
+		{
+			name: "short service names",
+			kind: "Deployment",
+			object: `
+spec:
+  env:
+  - {name: API, value: "http://api.dev:8080/v1"}
+  - {name: HOSTS, value: "api.dev,db.dev"}
+  - {name: DB, value: db.dev}
+  - {name: EXTERNAL, value: "https://www.api.dev.example.com"}
+  - {name: SUBDOMAIN, value: "https://status.api.dev"}
+  - {name: OTHER, value: "api.devel"}`,
+			want: `
+spec:
+  env:
+  - {name: API, value: "http://api.preview:8080/v1"}
+  - {name: HOSTS, value: "api.preview,db.preview"}
+  - {name: DB, value: db.preview}
+  - {name: EXTERNAL, value: "https://www.api.dev.example.com"}
+  - {name: SUBDOMAIN, value: "https://status.api.dev"}
+  - {name: OTHER, value: "api.devel"}`,
+		},
+		{
+			name: "annotations except the ones of ShareKube",
+			kind: "Ingress",
+			object: `
+metadata:
+  annotations: {upstream: web.dev.svc, sharekube.dev/source: web.dev.svc}`,
+			want: `
+metadata:
+  annotations: {upstream: web.preview.svc, sharekube.dev/source: web.dev.svc}`,
+		},
+		{
+			name: "namespace fields at well-known paths",
+			kind: "NetworkPolicy",
+			object: `
+spec:
+  ingress:
+  - from:
+    - namespaceSelector: {matchLabels: {kubernetes.io/metadata.name: dev}}
+    - namespaceSelector: {matchLabels: {kubernetes.io/metadata.name: monitoring}}`,
+			want: `
+spec:
+  ingress:
+  - from:
+    - namespaceSelector: {matchLabels: {kubernetes.io/metadata.name: preview}}
+    - namespaceSelector: {matchLabels: {kubernetes.io/metadata.name: monitoring}}`,
+		},
+		{
+			name: "namespace selector expressions",
+			kind: "NetworkPolicy",
+			object: `
+spec:
+  egress:
+  - to:
+    - namespaceSelector:
+        matchExpressions:
+        - {key: kubernetes.io/metadata.name, operator: In, values: [dev, monitoring]}
+        - {key: team, operator: In, values: [dev]}`,
+			want: `
+spec:
+  egress:
+  - to:
+    - namespaceSelector:
+        matchExpressions:
+        - {key: kubernetes.io/metadata.name, operator: In, values: [preview, monitoring]}
+        - {key: team, operator: In, values: [dev]}`,
+		},
+		{
+			name: "namespace fields elsewhere are kept",
+			kind: "ConfigMap",
+			object: `
+data: {namespace: dev}`,
+			want: `
+data: {namespace: dev}`,
+		},
+		{
+			name: "Secret data is left untouched",
+			kind: "Secret",
+			object: `
+stringData: {url: "http://api.dev.svc"}`,
+			want: `
+stringData: {url: "http://api.dev.svc"}`,
+		},
+		{
+			name:    "ConfigMap patterns",
+			kind:    "ConfigMap",
+			rewrite: patterns,
+			object: `
+data: {dsn: "postgres://db-dev.internal/app", note: "no placeholder"}`,
+			want: `
+data: {dsn: "postgres://db-preview.internal/app", note: "no placeholder"}`,
+		},
+		{
+			name:    "patterns only apply to ConfigMaps",
+			kind:    "Deployment",
+			rewrite: patterns,
+			object: `
+spec: {dsn: "postgres://db-dev.internal/app"}`,
+			want: `
+spec: {dsn: "postgres://db-dev.internal/app"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var obj, want map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.object), &obj); err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			h := &ResourceHandler{referenceRewrite: tt.rewrite}
+			h.rewriteReferences(tt.kind, obj, "dev", "preview")
+			if !reflect.DeepEqual(obj, want) {
+				got, _ := yaml.Marshal(obj)
+				t.Errorf("rewriteReferences() =\n%s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package resources
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// celCostLimit bounds the runtime cost of evaluating a single expression
+const celCostLimit = 1000000
+
+// protectedPaths are fields rules may not touch, because copies are tracked and cleaned up by them
+var protectedPaths = []string{"apiVersion", "kind", "metadata.name", "metadata.namespace"}
+
+// compiledRule is a transformation rule with its expressions compiled
+type compiledRule struct {
+	kind         string
+	filter       cel.Program
+	removeFields [][]string
+	mutations    []compiledMutation
+}
+
+// compiledMutation sets the field at path to the result of program
+type compiledMutation struct {
+	path    []string
+	program cel.Program
+}
+
+var (
+	celEnvOnce sync.Once
+	celEnv     *cel.Env
+	celEnvErr  error
+)
+
+// expressionEnv returns the CEL environment expressions are compiled in, with the copy bound to `object`
+func expressionEnv() (*cel.Env, error) {
+	celEnvOnce.Do(func() {
+		celEnv, celEnvErr = cel.NewEnv(
+			cel.Variable("object", cel.DynType),
+			ext.Strings(),
+		)
+	})
+	return celEnv, celEnvErr
+}
+
+// ValidateTransformationRules compiles the expressions of the rules and reports the invalid ones
+func ValidateTransformationRules(rules []sharekubev1alpha1.TransformationRule, path *field.Path) field.ErrorList {
+	_, errs := compileRules(rules, path)
+	return errs
+}
+
+// SetTransformationRules compiles the transformation rules applied to copies
+func (h *ResourceHandler) SetTransformationRules(rules []sharekubev1alpha1.TransformationRule) error {
+	compiled, errs := compileRules(rules, field.NewPath("spec", "transformationRules"))
+	if len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	h.rules = compiled
+	return nil
+}
+
+// compileRules compiles the filters and mutations of the rules and validates their paths
+func compileRules(rules []sharekubev1alpha1.TransformationRule, path *field.Path) ([]compiledRule, field.ErrorList) {
+	var errs field.ErrorList
+	env, err := expressionEnv()
+	if err != nil {
+		return nil, append(errs, field.InternalError(path, err))
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		rulePath := path.Index(i)
+		c := compiledRule{kind: rule.Kind}
+
+		if rule.Kind == "" {
+			errs = append(errs, field.Required(rulePath.Child("kind"), ""))
+		}
+
+		if rule.Filter != "" {
+			ast, err := compileExpression(env, rule.Filter)
+			if err == nil && ast.OutputType().String() != cel.BoolType.String() && ast.OutputType().String() != cel.DynType.String() {
+				err = fmt.Errorf("must evaluate to bool, not %s", ast.OutputType())
+			}
+			if err == nil {
+				c.filter, err = env.Program(ast, cel.CostLimit(celCostLimit))
+			}
+			if err != nil {
+				errs = append(errs, field.Invalid(rulePath.Child("filter"), rule.Filter, err.Error()))
+			}
+		}
+
+		for j, removeField := range rule.RemoveFields {
+			fields, err := parseFieldPath(removeField)
+			if err != nil {
+				errs = append(errs, field.Invalid(rulePath.Child("removeFields").Index(j), removeField, err.Error()))
+				continue
+			}
+			c.removeFields = append(c.removeFields, fields)
+		}
+
+		for j, mutation := range rule.Mutations {
+			mutationPath := rulePath.Child("mutations").Index(j)
+			fields, err := parseFieldPath(mutation.Path)
+			if err != nil {
+				errs = append(errs, field.Invalid(mutationPath.Child("path"), mutation.Path, err.Error()))
+			}
+			ast, err := compileExpression(env, mutation.Expression)
+			if err != nil {
+				errs = append(errs, field.Invalid(mutationPath.Child("expression"), mutation.Expression, err.Error()))
+				continue
+			}
+			program, err := env.Program(ast, cel.CostLimit(celCostLimit))
+			if err != nil {
+				errs = append(errs, field.Invalid(mutationPath.Child("expression"), mutation.Expression, err.Error()))
+				continue
+			}
+			c.mutations = append(c.mutations, compiledMutation{path: fields, program: program})
+		}
+
+		compiled = append(compiled, c)
+	}
+	return compiled, errs
+}
+
+// compileExpression parses and type-checks a CEL expression
+func compileExpression(env *cel.Env, expression string) (*cel.Ast, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, fmt.Errorf("expression must not be empty")
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	return ast, nil
+}
+
+// parseFieldPath splits the path of a field rules may modify
+func parseFieldPath(path string) ([]string, error) {
+	fields, err := splitFieldPath(path)
+	if err != nil {
+		return nil, err
+	}
+	joined := strings.Join(fields, ".")
+	for _, protected := range protectedPaths {
+		if joined == protected || strings.HasPrefix(protected, joined+".") {
+			return nil, fmt.Errorf("must not modify %s", protected)
+		}
+	}
+	return fields, nil
+}
+
+// splitFieldPath splits a dot-separated field path, where `\.` is a literal dot within a key
+func splitFieldPath(path string) ([]string, error) {
+	var fields []string
+	var current strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			current.WriteByte('.')
+			i++
+		case path[i] == '.':
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(path[i])
+		}
+	}
+	fields = append(fields, current.String())
+
+	for _, f := range fields {
+		if f == "" {
+			return nil, fmt.Errorf("must be a dot-separated path without empty segments")
+		}
+	}
+	return fields, nil
+}
+
+// applyRules runs the transformation rules matching the copy's kind and filter
+func (h *ResourceHandler) applyRules(obj *unstructured.Unstructured) error {
+	for i, rule := range h.rules {
+		if rule.kind != obj.GetKind() {
+			continue
+		}
+
+		if rule.filter != nil {
+			val, _, err := rule.filter.Eval(map[string]interface{}{"object": obj.Object})
+			if err != nil {
+				return fmt.Errorf("failed to evaluate filter of transformation rule %d: %w", i, err)
+			}
+			matched, ok := val.(types.Bool)
+			if !ok {
+				return fmt.Errorf("filter of transformation rule %d returned %s instead of bool", i, val.Type().TypeName())
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		for _, fields := range rule.removeFields {
+			unstructured.RemoveNestedField(obj.Object, fields...)
+		}
+
+		for _, mutation := range rule.mutations {
+			val, _, err := mutation.program.Eval(map[string]interface{}{"object": obj.Object})
+			if err != nil {
+				return fmt.Errorf("failed to evaluate mutation of %s in transformation rule %d: %w", strings.Join(mutation.path, "."), i, err)
+			}
+			value, err := celToNative(val)
+			if err != nil {
+				return fmt.Errorf("invalid result of mutation of %s in transformation rule %d: %w", strings.Join(mutation.path, "."), i, err)
+			}
+			if err := unstructured.SetNestedField(obj.Object, value, mutation.path...); err != nil {
+				return fmt.Errorf("failed to set %s in transformation rule %d: %w", strings.Join(mutation.path, "."), i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// celToNative converts the result of an expression into a value unstructured objects can hold
+func celToNative(val ref.Val) (interface{}, error) {
+	switch v := val.(type) {
+	case types.Null:
+		return nil, nil
+	case types.Bool:
+		return bool(v), nil
+	case types.Int:
+		return int64(v), nil
+	case types.Uint:
+		return int64(v), nil
+	case types.Double:
+		return float64(v), nil
+	case types.String:
+		return string(v), nil
+	case traits.Mapper:
+		out := map[string]interface{}{}
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			key := it.Next()
+			k, ok := key.(types.String)
+			if !ok {
+				return nil, fmt.Errorf("map keys must be strings, not %s", key.Type().TypeName())
+			}
+			item, err := celToNative(v.Get(key))
+			if err != nil {
+				return nil, err
+			}
+			out[string(k)] = item
+		}
+		return out, nil
+	case traits.Lister:
+		size, _ := v.Size().(types.Int)
+		out := make([]interface{}, 0, int(size))
+		for i := types.Int(0); i < size; i++ {
+			item, err := celToNative(v.Get(i))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, item)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported result type %s", val.Type().TypeName())
+}
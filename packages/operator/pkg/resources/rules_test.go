@@ -0,0 +1,165 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestCompileRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   sharekubev1alpha1.TransformationRule
+		errors []string
+	}{
+		{
+			name: "valid",
+			rule: sharekubev1alpha1.TransformationRule{
+				Kind:         "Deployment",
+				Filter:       `object.metadata.name.startsWith("web")`,
+				RemoveFields: []string{`metadata.annotations.example\.com/owner`},
+				Mutations:    []sharekubev1alpha1.FieldMutation{{Path: "spec.replicas", Expression: "1"}},
+			},
+		},
+		{
+			name:   "missing kind",
+			rule:   sharekubev1alpha1.TransformationRule{},
+			errors: []string{"rules[0].kind"},
+		},
+		{
+			name:   "filter not returning bool",
+			rule:   sharekubev1alpha1.TransformationRule{Kind: "Service", Filter: `"yes"`},
+			errors: []string{"rules[0].filter"},
+		},
+		{
+			name:   "invalid filter",
+			rule:   sharekubev1alpha1.TransformationRule{Kind: "Service", Filter: "object.spec.("},
+			errors: []string{"rules[0].filter"},
+		},
+		{
+			name:   "protected fields",
+			rule:   sharekubev1alpha1.TransformationRule{Kind: "Service", RemoveFields: []string{"metadata", "kind", "metadata.labels"}},
+			errors: []string{"rules[0].removeFields[0]", "rules[0].removeFields[1]"},
+		},
+		{
+			name:   "empty path segment",
+			rule:   sharekubev1alpha1.TransformationRule{Kind: "Service", RemoveFields: []string{"spec..ports"}},
+			errors: []string{"rules[0].removeFields[0]"},
+		},
+		{
+			name: "invalid mutation",
+			rule: sharekubev1alpha1.TransformationRule{Kind: "Service", Mutations: []sharekubev1alpha1.FieldMutation{
+				{Path: "metadata.name", Expression: `"renamed"`},
+				{Path: "spec.type", Expression: " "},
+			}},
+			errors: []string{"rules[0].mutations[0].path", "rules[0].mutations[1].expression"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := compileRules([]sharekubev1alpha1.TransformationRule{tt.rule}, field.NewPath("rules"))
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.errors) {
+				t.Errorf("compileRules() errors = %v, want %v", errs, tt.errors)
+			}
+		})
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	deployment := `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web, annotations: {example.com/owner: team-a, team: web}}
+spec: {replicas: 3, template: {spec: {containers: [{name: web, image: "web:1.0"}]}}}`
+
+	tests := []struct {
+		name    string
+		rule    sharekubev1alpha1.TransformationRule
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "remove and mutate",
+			rule: sharekubev1alpha1.TransformationRule{
+				Kind:         "Deployment",
+				RemoveFields: []string{`metadata.annotations.example\.com/owner`},
+				Mutations: []sharekubev1alpha1.FieldMutation{
+					{Path: "spec.replicas", Expression: "object.spec.replicas - 2"},
+					{Path: "metadata.labels", Expression: `{"preview": "true"}`},
+				},
+			},
+			want: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web, annotations: {team: web}, labels: {preview: "true"}}
+spec: {replicas: 1, template: {spec: {containers: [{name: web, image: "web:1.0"}]}}}`,
+		},
+		{
+			name: "filter not matching",
+			rule: sharekubev1alpha1.TransformationRule{
+				Kind:         "Deployment",
+				Filter:       `object.metadata.name == "api"`,
+				RemoveFields: []string{"spec.replicas"},
+			},
+			want: deployment,
+		},
+		{
+			name: "other kind",
+			rule: sharekubev1alpha1.TransformationRule{Kind: "StatefulSet", RemoveFields: []string{"spec.replicas"}},
+			want: deployment,
+		},
+		{
+			name: "failing mutation",
+			rule: sharekubev1alpha1.TransformationRule{
+				Kind:      "Deployment",
+				Mutations: []sharekubev1alpha1.FieldMutation{{Path: "spec.paused", Expression: "object.spec.missing"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal([]byte(deployment), &obj.Object); err != nil {
+				t.Fatal(err)
+			}
+			// Integers in unstructured objects are int64, as decoded from the API server
+			if err := unstructured.SetNestedField(obj.Object, int64(3), "spec", "replicas"); err != nil {
+				t.Fatal(err)
+			}
+
+			h := &ResourceHandler{}
+			if err := h.SetTransformationRules([]sharekubev1alpha1.TransformationRule{tt.rule}); err != nil {
+				t.Fatalf("SetTransformationRules() error = %v", err)
+			}
+			err := h.applyRules(obj)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var want map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := yaml.Marshal(obj.Object)
+			wantYAML, _ := yaml.Marshal(want)
+			if string(got) != string(wantYAML) {
+				t.Errorf("applyRules() =\n%s\nwant\n%s", got, wantYAML)
+			}
+		})
+	}
+}
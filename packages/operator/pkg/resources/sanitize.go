@@ -0,0 +1,299 @@
+package resources
+
+import (
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Sanitizer strips the fields of a copy that only make sense for the source object,
+// such as allocated addresses, controller-generated selectors or bindings to cluster state
+type Sanitizer interface {
+	Sanitize(obj *unstructured.Unstructured) error
+}
+
+// SanitizerFunc adapts a function to the Sanitizer interface
+type SanitizerFunc func(obj *unstructured.Unstructured) error
+
+// Sanitize calls f(obj)
+func (f SanitizerFunc) Sanitize(obj *unstructured.Unstructured) error {
+	return f(obj)
+}
+
+var (
+	registryMu sync.RWMutex
+	// sanitizers holds the Sanitizer for each kind
+	sanitizers = map[schema.GroupKind]Sanitizer{}
+	// registeredKinds maps kinds registered by downstream code to their resources
+	registeredKinds = map[string]schema.GroupVersionResource{}
+)
+
+// RegisterSanitizer registers the Sanitizer for a kind, replacing any previous one
+func RegisterSanitizer(gk schema.GroupKind, sanitizer Sanitizer) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	sanitizers[gk] = sanitizer
+}
+
+// RegisterKind makes a kind the handler does not know about, such as a custom resource, copyable
+func RegisterKind(kind string, gvr schema.GroupVersionResource) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registeredKinds[kind] = gvr
+}
+
+// lookupRegisteredKind returns the resource of a kind registered with RegisterKind
+func lookupRegisteredKind(kind string) (schema.GroupVersionResource, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	gvr, ok := registeredKinds[kind]
+	return gvr, ok
+}
+
+// RegisteredKinds returns the kinds registered with RegisterKind and their resources
+func RegisteredKinds() map[string]schema.GroupVersionResource {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	kinds := make(map[string]schema.GroupVersionResource, len(registeredKinds))
+	for kind, gvr := range registeredKinds {
+		kinds[kind] = gvr
+	}
+	return kinds
+}
+
+// sanitizeObject clears the server-populated metadata and status of a copy, then runs the kind's Sanitizer
+func sanitizeObject(obj *unstructured.Unstructured) error {
+	obj.SetResourceVersion("")
+	obj.SetUID("")
+	obj.SetCreationTimestamp(metav1.Time{})
+	obj.SetDeletionTimestamp(nil)
+	obj.SetDeletionGracePeriodSeconds(nil)
+	obj.SetGeneration(0)
+	obj.SetSelfLink("")
+	obj.SetManagedFields(nil)
+	obj.SetFinalizers(nil)
+
+	// Owners live in the source namespace, and the garbage collector would delete copies pointing at them
+	obj.SetOwnerReferences(nil)
+
+	// Remove status field if present
+	unstructured.RemoveNestedField(obj.Object, "status")
+
+	registryMu.RLock()
+	sanitizer, ok := sanitizers[obj.GroupVersionKind().GroupKind()]
+	registryMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return sanitizer.Sanitize(obj)
+}
+
+func init() {
+	RegisterSanitizer(schema.GroupKind{Kind: "Pod"}, SanitizerFunc(sanitizePod))
+	RegisterSanitizer(schema.GroupKind{Kind: "Service"}, SanitizerFunc(sanitizeService))
+	RegisterSanitizer(schema.GroupKind{Kind: "Secret"}, SanitizerFunc(sanitizeSecret))
+	RegisterSanitizer(schema.GroupKind{Kind: "ServiceAccount"}, SanitizerFunc(sanitizeServiceAccount))
+	RegisterSanitizer(schema.GroupKind{Kind: "PersistentVolumeClaim"}, SanitizerFunc(sanitizePersistentVolumeClaim))
+	RegisterSanitizer(schema.GroupKind{Group: "apps", Kind: "Deployment"}, SanitizerFunc(sanitizeDeployment))
+	RegisterSanitizer(schema.GroupKind{Group: "apps", Kind: "ReplicaSet"}, SanitizerFunc(sanitizeDeployment))
+	RegisterSanitizer(schema.GroupKind{Group: "apps", Kind: "StatefulSet"}, SanitizerFunc(sanitizeStatefulSet))
+	RegisterSanitizer(schema.GroupKind{Group: "apps", Kind: "DaemonSet"}, SanitizerFunc(sanitizeDaemonSet))
+	RegisterSanitizer(schema.GroupKind{Group: "batch", Kind: "Job"}, SanitizerFunc(sanitizeJob))
+	RegisterSanitizer(schema.GroupKind{Group: "batch", Kind: "CronJob"}, SanitizerFunc(sanitizeCronJob))
+}
+
+// sanitizePod unbinds a Pod copy from its node and drops the injected service account token volume
+func sanitizePod(obj *unstructured.Unstructured) error {
+	return sanitizePodSpec(obj.Object, "spec")
+}
+
+// sanitizePodSpec clears the fields of the pod spec at path that are set by the scheduler or admission
+func sanitizePodSpec(obj map[string]interface{}, path ...string) error {
+	spec, found, err := unstructured.NestedMap(obj, path...)
+	if err != nil || !found {
+		return err
+	}
+	delete(spec, "nodeName")
+
+	// The token volume is injected again on admission, and keeping it would clash with the new one
+	volumes, _, err := unstructured.NestedSlice(spec, "volumes")
+	if err != nil {
+		return err
+	}
+	tokenVolumes := map[string]bool{}
+	kept := volumes[:0]
+	for _, item := range volumes {
+		volume, _ := item.(map[string]interface{})
+		name, _ := volume["name"].(string)
+		if strings.HasPrefix(name, "kube-api-access-") {
+			tokenVolumes[name] = true
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if len(tokenVolumes) > 0 {
+		if len(kept) == 0 {
+			delete(spec, "volumes")
+		} else {
+			spec["volumes"] = kept
+		}
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _, err := unstructured.NestedSlice(spec, field)
+			if err != nil {
+				return err
+			}
+			for _, item := range containers {
+				container, _ := item.(map[string]interface{})
+				mounts, _, err := unstructured.NestedSlice(container, "volumeMounts")
+				if err != nil {
+					return err
+				}
+				keptMounts := mounts[:0]
+				for _, mount := range mounts {
+					m, _ := mount.(map[string]interface{})
+					if name, _ := m["name"].(string); !tokenVolumes[name] {
+						keptMounts = append(keptMounts, mount)
+					}
+				}
+				if len(keptMounts) == 0 {
+					delete(container, "volumeMounts")
+				} else {
+					container["volumeMounts"] = keptMounts
+				}
+			}
+			if containers != nil {
+				spec[field] = containers
+			}
+		}
+	}
+
+	return unstructured.SetNestedMap(obj, spec, path...)
+}
+
+// sanitizeService clears the allocated addresses and node ports of a Service copy so the cluster assigns new ones
+func sanitizeService(obj *unstructured.Unstructured) error {
+	// Headless Services must stay headless
+	if clusterIP, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP"); clusterIP != "None" {
+		unstructured.RemoveNestedField(obj.Object, "spec", "clusterIP")
+		unstructured.RemoveNestedField(obj.Object, "spec", "clusterIPs")
+	}
+
+	ports, found, err := unstructured.NestedSlice(obj.Object, "spec", "ports")
+	if err != nil {
+		return err
+	}
+	if found {
+		for _, item := range ports {
+			if port, ok := item.(map[string]interface{}); ok {
+				delete(port, "nodePort")
+			}
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, ports, "spec", "ports"); err != nil {
+			return err
+		}
+	}
+
+	unstructured.RemoveNestedField(obj.Object, "spec", "healthCheckNodePort")
+	unstructured.RemoveNestedField(obj.Object, "spec", "loadBalancerIP")
+	unstructured.RemoveNestedField(obj.Object, "spec", "externalIPs")
+	return nil
+}
+
+// sanitizeSecret drops the binding of service account token Secrets to the source service account
+func sanitizeSecret(obj *unstructured.Unstructured) error {
+	removeAnnotations(obj, "kubernetes.io/service-account.uid")
+	return nil
+}
+
+// sanitizeServiceAccount drops the references to token Secrets generated for the source service account
+func sanitizeServiceAccount(obj *unstructured.Unstructured) error {
+	unstructured.RemoveNestedField(obj.Object, "secrets")
+	return nil
+}
+
+// sanitizePersistentVolumeClaim unbinds a claim copy from the source's volume so a new one is provisioned
+func sanitizePersistentVolumeClaim(obj *unstructured.Unstructured) error {
+	unstructured.RemoveNestedField(obj.Object, "spec", "volumeName")
+	removeAnnotations(obj,
+		"pv.kubernetes.io/bind-completed",
+		"pv.kubernetes.io/bound-by-controller",
+		"volume.beta.kubernetes.io/storage-provisioner",
+		"volume.kubernetes.io/storage-provisioner",
+		"volume.kubernetes.io/selected-node")
+	return nil
+}
+
+// sanitizeDeployment drops the rollout bookkeeping of Deployments and ReplicaSets
+func sanitizeDeployment(obj *unstructured.Unstructured) error {
+	removeAnnotations(obj,
+		"deployment.kubernetes.io/revision",
+		"deployment.kubernetes.io/desired-replicas",
+		"deployment.kubernetes.io/max-replicas")
+	return sanitizePodSpec(obj.Object, "spec", "template", "spec")
+}
+
+// sanitizeStatefulSet clears the pod template of a StatefulSet copy
+func sanitizeStatefulSet(obj *unstructured.Unstructured) error {
+	return sanitizePodSpec(obj.Object, "spec", "template", "spec")
+}
+
+// sanitizeDaemonSet drops the template generation bookkeeping of DaemonSets
+func sanitizeDaemonSet(obj *unstructured.Unstructured) error {
+	removeAnnotations(obj, "deprecated.daemonset.template.generation")
+	return sanitizePodSpec(obj.Object, "spec", "template", "spec")
+}
+
+// jobControllerLabels are generated for each Job and select only the source Job's pods
+var jobControllerLabels = []string{
+	"controller-uid",
+	"batch.kubernetes.io/controller-uid",
+	"job-name",
+	"batch.kubernetes.io/job-name",
+}
+
+// sanitizeJob drops the generated selector and controller labels so the API server generates new ones
+func sanitizeJob(obj *unstructured.Unstructured) error {
+	unstructured.RemoveNestedField(obj.Object, "spec", "selector")
+	unstructured.RemoveNestedField(obj.Object, "spec", "manualSelector")
+
+	labels := obj.GetLabels()
+	for _, key := range jobControllerLabels {
+		delete(labels, key)
+	}
+	obj.SetLabels(labels)
+
+	templateLabels, found, err := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "labels")
+	if err != nil {
+		return err
+	}
+	if found {
+		for _, key := range jobControllerLabels {
+			delete(templateLabels, key)
+		}
+		if err := unstructured.SetNestedStringMap(obj.Object, templateLabels, "spec", "template", "metadata", "labels"); err != nil {
+			return err
+		}
+	}
+
+	return sanitizePodSpec(obj.Object, "spec", "template", "spec")
+}
+
+// sanitizeCronJob clears the pod template of a CronJob copy
+func sanitizeCronJob(obj *unstructured.Unstructured) error {
+	return sanitizePodSpec(obj.Object, "spec", "jobTemplate", "spec", "template", "spec")
+}
+
+// removeAnnotations deletes the given annotations from the object
+func removeAnnotations(obj *unstructured.Unstructured, keys ...string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		return
+	}
+	for _, key := range keys {
+		delete(annotations, key)
+	}
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,189 @@
+package resources
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+func TestSanitizeObject(t *testing.T) {
+	tests := []struct {
+		name   string
+		object string
+		want   string
+	}{
+		{
+			name: "server-populated metadata and status",
+			object: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  resourceVersion: "42"
+  uid: 0b9c
+  generation: 3
+  finalizers: [example.com/keep]
+  ownerReferences: [{apiVersion: v1, kind: Pod, name: owner, uid: 1a2b}]
+status: {phase: Active}
+data: {key: value}`,
+			want: `
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: config}
+data: {key: value}`,
+		},
+		{
+			name: "Service addresses and node ports",
+			object: `
+apiVersion: v1
+kind: Service
+metadata: {name: web}
+spec:
+  clusterIP: 10.0.0.1
+  clusterIPs: [10.0.0.1]
+  loadBalancerIP: 1.2.3.4
+  healthCheckNodePort: 30001
+  ports: [{port: 80, nodePort: 30080}]`,
+			want: `
+apiVersion: v1
+kind: Service
+metadata: {name: web}
+spec:
+  ports: [{port: 80}]`,
+		},
+		{
+			name: "headless Service stays headless",
+			object: `
+apiVersion: v1
+kind: Service
+metadata: {name: db}
+spec: {clusterIP: None}`,
+			want: `
+apiVersion: v1
+kind: Service
+metadata: {name: db}
+spec: {clusterIP: None}`,
+		},
+		{
+			name: "Pod node binding and token volume",
+			object: `
+apiVersion: v1
+kind: Pod
+metadata: {name: app}
+spec:
+  nodeName: node-1
+  volumes: [{name: kube-api-access-x1y2}, {name: data}]
+  containers:
+  - name: app
+    volumeMounts: [{name: kube-api-access-x1y2, mountPath: /var/run/secrets}, {name: data, mountPath: /data}]`,
+			want: `
+apiVersion: v1
+kind: Pod
+metadata: {name: app}
+spec:
+  volumes: [{name: data}]
+  containers:
+  - name: app
+    volumeMounts: [{name: data, mountPath: /data}]`,
+		},
+		{
+			name: "Job selector and controller labels",
+			object: `
+apiVersion: batch/v1
+kind: Job
+metadata: {name: migrate, labels: {app: migrate, job-name: migrate}}
+spec:
+  selector: {matchLabels: {controller-uid: 1a2b}}
+  template:
+    metadata: {labels: {app: migrate, controller-uid: 1a2b, batch.kubernetes.io/job-name: migrate}}
+    spec: {containers: [{name: migrate}]}`,
+			want: `
+apiVersion: batch/v1
+kind: Job
+metadata: {name: migrate, labels: {app: migrate}}
+spec:
+  template:
+    metadata: {labels: {app: migrate}}
+    spec: {containers: [{name: migrate}]}`,
+		},
+		{
+			name: "PersistentVolumeClaim binding",
+			object: `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata: {name: data, annotations: {pv.kubernetes.io/bind-completed: "yes", team: web}}
+spec: {volumeName: pvc-1a2b, storageClassName: standard}`,
+			want: `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata: {name: data, annotations: {team: web}}
+spec: {storageClassName: standard}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal([]byte(tt.object), &obj.Object); err != nil {
+				t.Fatal(err)
+			}
+			var want map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := sanitizeObject(obj); err != nil {
+				t.Fatalf("sanitizeObject() error = %v", err)
+			}
+			if !reflect.DeepEqual(obj.Object, want) {
+				got, _ := yaml.Marshal(obj.Object)
+				t.Errorf("sanitizeObject() =\n%s", got)
+			}
+		})
+	}
+}
+
+func TestRegisterSanitizer(t *testing.T) {
+	gk := schema.GroupKind{Group: "example.com", Kind: "Widget"}
+	errSanitize := errors.New("sanitized")
+	RegisterSanitizer(gk, SanitizerFunc(func(obj *unstructured.Unstructured) error {
+		unstructured.RemoveNestedField(obj.Object, "spec", "endpoint")
+		return errSanitize
+	}))
+	defer func() {
+		registryMu.Lock()
+		delete(sanitizers, gk)
+		registryMu.Unlock()
+	}()
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "widget"},
+		"spec":       map[string]interface{}{"endpoint": "10.0.0.1", "size": "small"},
+	}}
+	if err := sanitizeObject(obj); !errors.Is(err, errSanitize) {
+		t.Errorf("sanitizeObject() error = %v, want the registered sanitizer's error", err)
+	}
+	if _, found, _ := unstructured.NestedString(obj.Object, "spec", "endpoint"); found {
+		t.Error("registered sanitizer did not run")
+	}
+}
+
+func TestRegisterKind(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	RegisterKind("Widget", gvr)
+	defer func() {
+		registryMu.Lock()
+		delete(registeredKinds, "Widget")
+		registryMu.Unlock()
+	}()
+
+	if got, err := getGVRForKind("Widget"); err != nil || got != gvr {
+		t.Errorf("getGVRForKind(Widget) = %v, %v, want %v", got, err, gvr)
+	}
+}
@@ -0,0 +1,218 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// HPAPolicyDrop skips copying HorizontalPodAutoscalers instead of clamping them
+const HPAPolicyDrop = "Drop"
+
+// ErrDropped is returned when a resource is intentionally left out of the preview
+var ErrDropped = errors.New("resource dropped")
+
+// SetScalingRules configures how copied workloads are resized
+func (h *ResourceHandler) SetScalingRules(rules *sharekubev1alpha1.ScalingRules) {
+	h.scaling = rules
+}
+
+// ApplyScaling resizes the footprint according to the scaling rules so quota checks see the copied size
+func (f *WorkloadFootprint) ApplyScaling(rules *sharekubev1alpha1.ScalingRules) error {
+	if rules == nil || !f.Scalable {
+		return nil
+	}
+	replicas := f.Replicas
+	if err := scaleWorkload(rules, &replicas, f.PodSpec); err != nil {
+		return err
+	}
+	f.Replicas = replicas
+	return nil
+}
+
+// isScalableKind reports whether scaling rules apply to the kind
+func isScalableKind(kind string) bool {
+	switch kind {
+	case "Deployment", "StatefulSet", "ReplicaSet":
+		return true
+	}
+	return false
+}
+
+// scaleWorkload applies the replica and resource rules to a workload's replica count and pod template
+func scaleWorkload(rules *sharekubev1alpha1.ScalingRules, replicas *int32, podSpec *corev1.PodSpec) error {
+	scaled, err := scaleReplicas(rules, *replicas)
+	if err != nil {
+		return err
+	}
+	*replicas = scaled
+
+	requestFactor, err := parseFactor("requestFactor", rules.RequestFactor)
+	if err != nil {
+		return err
+	}
+	limitFactor, err := parseFactor("limitFactor", rules.LimitFactor)
+	if err != nil {
+		return err
+	}
+
+	caps := corev1.ResourceList{}
+	if rules.MaxCPUPerContainer != nil {
+		caps[corev1.ResourceCPU] = *rules.MaxCPUPerContainer
+	}
+	if rules.MaxMemoryPerContainer != nil {
+		caps[corev1.ResourceMemory] = *rules.MaxMemoryPerContainer
+	}
+
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			res := &containers[i].Resources
+			res.Requests = scaleContainerResources(res.Requests, requestFactor, caps)
+			res.Limits = scaleContainerResources(res.Limits, limitFactor, caps)
+
+			// Keep requests within limits, or the API server rejects the pod
+			for name, limit := range res.Limits {
+				if request, ok := res.Requests[name]; ok && request.Cmp(limit) > 0 {
+					res.Requests[name] = limit.DeepCopy()
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// scaleReplicas applies the fixed, factor and maximum replica rules
+func scaleReplicas(rules *sharekubev1alpha1.ScalingRules, replicas int32) (int32, error) {
+	switch {
+	case rules.Replicas != nil:
+		replicas = *rules.Replicas
+	case rules.ReplicaFactor != "":
+		factor, err := parseFactor("replicaFactor", rules.ReplicaFactor)
+		if err != nil {
+			return 0, err
+		}
+		scaled := int32(math.Ceil(float64(replicas) * factor))
+		if scaled < 1 && replicas > 0 {
+			scaled = 1
+		}
+		replicas = scaled
+	}
+
+	if rules.MaxReplicas != nil && replicas > *rules.MaxReplicas {
+		replicas = *rules.MaxReplicas
+	}
+	return replicas, nil
+}
+
+// scaleContainerResources multiplies CPU and memory by the factor and caps them
+func scaleContainerResources(list corev1.ResourceList, factor float64, caps corev1.ResourceList) corev1.ResourceList {
+	if list == nil {
+		return nil
+	}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		q, ok := list[name]
+		if !ok {
+			continue
+		}
+		if factor != 1 {
+			q = *resource.NewMilliQuantity(int64(math.Ceil(float64(q.MilliValue())*factor)), q.Format)
+		}
+		if limit, ok := caps[name]; ok && q.Cmp(limit) > 0 {
+			q = limit.DeepCopy()
+		}
+		list[name] = q
+	}
+	return list
+}
+
+// parseFactor parses a decimal scaling factor, defaulting to 1 when unset
+func parseFactor(field, value string) (float64, error) {
+	if value == "" {
+		return 1, nil
+	}
+	factor, err := strconv.ParseFloat(value, 64)
+	if err != nil || factor < 0 {
+		return 0, fmt.Errorf("invalid scaling %s %q: must be a non-negative decimal", field, value)
+	}
+	return factor, nil
+}
+
+// scaleUnstructuredWorkload applies the scaling rules to a Deployment, StatefulSet or ReplicaSet copy
+func scaleUnstructuredWorkload(rules *sharekubev1alpha1.ScalingRules, obj *unstructured.Unstructured) error {
+	replicas := int32(1)
+	if value, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas"); err != nil {
+		return err
+	} else if found {
+		replicas = int32(value)
+	}
+
+	rawPodSpec, found, err := unstructured.NestedMap(obj.Object, "spec", "template", "spec")
+	if err != nil || !found {
+		return fmt.Errorf("failed to read pod template of %s %s: %v", obj.GetKind(), obj.GetName(), err)
+	}
+	podSpec := &corev1.PodSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawPodSpec, podSpec); err != nil {
+		return err
+	}
+
+	if err := scaleWorkload(rules, &replicas, podSpec); err != nil {
+		return err
+	}
+
+	rawPodSpec, err = runtime.DefaultUnstructuredConverter.ToUnstructured(podSpec)
+	if err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedMap(obj.Object, rawPodSpec, "spec", "template", "spec"); err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(obj.Object, int64(replicas), "spec", "replicas")
+}
+
+// clampHorizontalPodAutoscaler applies the replica rules to an HPA copy's minimum and maximum
+func clampHorizontalPodAutoscaler(rules *sharekubev1alpha1.ScalingRules, obj *unstructured.Unstructured) error {
+	maxReplicas, _, err := unstructured.NestedInt64(obj.Object, "spec", "maxReplicas")
+	if err != nil {
+		return err
+	}
+	minReplicas := int64(1)
+	if value, found, err := unstructured.NestedInt64(obj.Object, "spec", "minReplicas"); err != nil {
+		return err
+	} else if found {
+		minReplicas = value
+	}
+
+	scaledMax, err := scaleReplicas(rules, int32(maxReplicas))
+	if err != nil {
+		return err
+	}
+	scaledMin, err := scaleReplicas(rules, int32(minReplicas))
+	if err != nil {
+		return err
+	}
+
+	// HPAs require at least one replica on both bounds
+	if scaledMax < 1 {
+		scaledMax = 1
+	}
+	if scaledMin < 1 {
+		scaledMin = 1
+	}
+	if scaledMin > scaledMax {
+		scaledMin = scaledMax
+	}
+
+	if err := unstructured.SetNestedField(obj.Object, int64(scaledMax), "spec", "maxReplicas"); err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(obj.Object, int64(scaledMin), "spec", "minReplicas")
+}
@@ -0,0 +1,110 @@
+package resources
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestScaleReplicas(t *testing.T) {
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	tests := []struct {
+		name     string
+		rules    sharekubev1alpha1.ScalingRules
+		replicas int32
+		want     int32
+		wantErr  bool
+	}{
+		{name: "no rules", replicas: 3, want: 3},
+		{name: "fixed", rules: sharekubev1alpha1.ScalingRules{Replicas: int32Ptr(1)}, replicas: 5, want: 1},
+		{name: "fixed wins over factor", rules: sharekubev1alpha1.ScalingRules{Replicas: int32Ptr(2), ReplicaFactor: "0.1"}, replicas: 5, want: 2},
+		{name: "factor rounds up", rules: sharekubev1alpha1.ScalingRules{ReplicaFactor: "0.5"}, replicas: 5, want: 3},
+		{name: "factor keeps one replica", rules: sharekubev1alpha1.ScalingRules{ReplicaFactor: "0"}, replicas: 5, want: 1},
+		{name: "factor keeps zero replicas", rules: sharekubev1alpha1.ScalingRules{ReplicaFactor: "0.5"}, replicas: 0, want: 0},
+		{name: "maximum", rules: sharekubev1alpha1.ScalingRules{ReplicaFactor: "2", MaxReplicas: int32Ptr(4)}, replicas: 3, want: 4},
+		{name: "maximum caps fixed", rules: sharekubev1alpha1.ScalingRules{Replicas: int32Ptr(10), MaxReplicas: int32Ptr(2)}, replicas: 1, want: 2},
+		{name: "invalid factor", rules: sharekubev1alpha1.ScalingRules{ReplicaFactor: "half"}, replicas: 3, wantErr: true},
+		{name: "negative factor", rules: sharekubev1alpha1.ScalingRules{ReplicaFactor: "-1"}, replicas: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scaleReplicas(&tt.rules, tt.replicas)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scaleReplicas() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("scaleReplicas() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleWorkloadResources(t *testing.T) {
+	maxCPU := resource.MustParse("300m")
+
+	tests := []struct {
+		name         string
+		rules        sharekubev1alpha1.ScalingRules
+		requests     corev1.ResourceList
+		limits       corev1.ResourceList
+		wantRequests corev1.ResourceList
+		wantLimits   corev1.ResourceList
+	}{
+		{
+			name:         "factors",
+			rules:        sharekubev1alpha1.ScalingRules{RequestFactor: "0.5", LimitFactor: "0.25"},
+			requests:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+			limits:       corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+			wantRequests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("512Mi")},
+			wantLimits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+		},
+		{
+			name:         "cap per container",
+			rules:        sharekubev1alpha1.ScalingRules{MaxCPUPerContainer: &maxCPU},
+			requests:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			wantRequests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("300m")},
+		},
+		{
+			name:         "requests are kept within limits",
+			rules:        sharekubev1alpha1.ScalingRules{LimitFactor: "0.1"},
+			requests:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+			limits:       corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			wantRequests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			wantLimits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podSpec := &corev1.PodSpec{Containers: []corev1.Container{{
+				Name:      "app",
+				Resources: corev1.ResourceRequirements{Requests: tt.requests, Limits: tt.limits},
+			}}}
+			replicas := int32(1)
+			if err := scaleWorkload(&tt.rules, &replicas, podSpec); err != nil {
+				t.Fatalf("scaleWorkload() error = %v", err)
+			}
+			res := podSpec.Containers[0].Resources
+			assertResourceList(t, "requests", res.Requests, tt.wantRequests)
+			assertResourceList(t, "limits", res.Limits, tt.wantLimits)
+		})
+	}
+}
+
+func assertResourceList(t *testing.T, field string, got, want corev1.ResourceList) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", field, got, want)
+		return
+	}
+	for name, q := range want {
+		if g, ok := got[name]; !ok || g.Cmp(q) != 0 {
+			t.Errorf("%s[%s] = %s, want %s", field, name, g.String(), q.String())
+		}
+	}
+}
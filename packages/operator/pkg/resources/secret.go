@@ -0,0 +1,185 @@
+package resources
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// Secret actions of a SecretRule
+const (
+	SecretActionCopy        = "Copy"
+	SecretActionDrop        = "Drop"
+	SecretActionRandom      = "Random"
+	SecretActionPlaceholder = "Placeholder"
+	SecretActionTemplate    = "Template"
+)
+
+// SecretPolicyAnnotation records the action applied to each key of a copied Secret
+const SecretPolicyAnnotation = "sharekube.dev/secret-policy"
+
+const (
+	defaultRandomLength  = 32
+	defaultRandomCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	defaultPlaceholder   = "REDACTED"
+)
+
+// SetSecretPolicy configures how the data of copied Secrets is masked or regenerated
+func (h *ResourceHandler) SetSecretPolicy(policy *sharekubev1alpha1.SecretPolicy) {
+	h.secretPolicy = policy
+}
+
+// applySecretPolicy replaces the data of a Secret copy according to the first rule matching each key
+func (h *ResourceHandler) applySecretPolicy(obj *unstructured.Unstructured, targetNamespace string) error {
+	if h.secretPolicy == nil {
+		return nil
+	}
+
+	encoded, _, err := unstructured.NestedStringMap(obj.Object, "data")
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(encoded))
+	for key := range encoded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data := map[string]string{}
+	actions := map[string]string{}
+	var templated []string
+	for _, key := range keys {
+		rule := h.secretRuleFor(obj.GetName(), key)
+		if rule == nil {
+			rule = &sharekubev1alpha1.SecretRule{Action: SecretActionCopy}
+		}
+		actions[key] = rule.Action
+
+		switch rule.Action {
+		case SecretActionCopy:
+			value, err := base64.StdEncoding.DecodeString(encoded[key])
+			if err != nil {
+				return fmt.Errorf("invalid data of key %s: %w", key, err)
+			}
+			data[key] = string(value)
+		case SecretActionDrop:
+		case SecretActionRandom:
+			value, err := randomString(rule.Length, rule.Charset)
+			if err != nil {
+				return fmt.Errorf("failed to generate value of key %s: %w", key, err)
+			}
+			data[key] = value
+		case SecretActionPlaceholder:
+			data[key] = rule.Value
+			if data[key] == "" {
+				data[key] = defaultPlaceholder
+			}
+		case SecretActionTemplate:
+			// Rendered once the other keys are known, so templates can embed generated values
+			templated = append(templated, key)
+		default:
+			return fmt.Errorf("unknown secret action %q for key %s", rule.Action, key)
+		}
+	}
+
+	rendered := map[string]string{}
+	for _, key := range templated {
+		rule := h.secretRuleFor(obj.GetName(), key)
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(rule.Template)
+		if err != nil {
+			return fmt.Errorf("invalid template for key %s: %w", key, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, map[string]interface{}{
+			"name":      h.sharekubeName,
+			"namespace": targetNamespace,
+			"secret":    obj.GetName(),
+			"key":       key,
+			"data":      data,
+		}); err != nil {
+			return fmt.Errorf("failed to render template for key %s: %w", key, err)
+		}
+		rendered[key] = buf.String()
+	}
+	for key, value := range rendered {
+		data[key] = value
+	}
+
+	result := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		result[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	if len(result) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "data")
+	} else if err := unstructured.SetNestedMap(obj.Object, result, "data"); err != nil {
+		return err
+	}
+
+	recorded, err := json.Marshal(actions)
+	if err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[SecretPolicyAnnotation] = string(recorded)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// secretRuleFor returns the first rule matching the Secret and key, or nil if the key is copied as is
+func (h *ResourceHandler) secretRuleFor(secret, key string) *sharekubev1alpha1.SecretRule {
+	for i, rule := range h.secretPolicy.Rules {
+		if rule.Name != "" && rule.Name != secret {
+			continue
+		}
+		if len(rule.Keys) > 0 && !containsString(rule.Keys, key) {
+			continue
+		}
+		return &h.secretPolicy.Rules[i]
+	}
+	return nil
+}
+
+// randomString draws a value of the given length from the charset using a cryptographic source
+func randomString(length int, charset string) (string, error) {
+	if length <= 0 {
+		length = defaultRandomLength
+	}
+	if charset == "" {
+		charset = defaultRandomCharset
+	}
+	chars := []rune(charset)
+	size := big.NewInt(int64(len(chars)))
+
+	out := make([]rune, length)
+	for i := range out {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		out[i] = chars[n.Int64()]
+	}
+	return string(out), nil
+}
+
+// containsString reports whether the slice contains the value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
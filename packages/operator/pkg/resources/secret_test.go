@@ -0,0 +1,120 @@
+package resources
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+func TestApplySecretPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []sharekubev1alpha1.SecretRule
+		want    map[string]string
+		random  map[string]int
+		actions map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "keys without a rule are copied",
+			rules:   []sharekubev1alpha1.SecretRule{{Name: "other", Action: SecretActionDrop}},
+			want:    map[string]string{"username": "admin", "password": "hunter2"},
+			actions: map[string]string{"username": SecretActionCopy, "password": SecretActionCopy},
+		},
+		{
+			name: "first matching rule wins",
+			rules: []sharekubev1alpha1.SecretRule{
+				{Name: "db", Keys: []string{"password"}, Action: SecretActionPlaceholder},
+				{Action: SecretActionDrop},
+			},
+			want:    map[string]string{"password": "REDACTED"},
+			actions: map[string]string{"username": SecretActionDrop, "password": SecretActionPlaceholder},
+		},
+		{
+			name: "random and template",
+			rules: []sharekubev1alpha1.SecretRule{
+				{Keys: []string{"password"}, Action: SecretActionRandom, Length: 12, Charset: "abc"},
+				{Keys: []string{"username"}, Action: SecretActionTemplate, Template: "{{.secret}}-{{.name}}-{{.namespace}}:{{.data.password}}"},
+			},
+			random:  map[string]int{"password": 12},
+			actions: map[string]string{"username": SecretActionTemplate, "password": SecretActionRandom},
+		},
+		{
+			name:    "custom placeholder",
+			rules:   []sharekubev1alpha1.SecretRule{{Keys: []string{"password"}, Action: SecretActionPlaceholder, Value: "changeme"}},
+			want:    map[string]string{"username": "admin", "password": "changeme"},
+			actions: map[string]string{"username": SecretActionCopy, "password": SecretActionPlaceholder},
+		},
+		{
+			name:    "template with an unknown key",
+			rules:   []sharekubev1alpha1.SecretRule{{Keys: []string{"username"}, Action: SecretActionTemplate, Template: "{{.user}}"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown action",
+			rules:   []sharekubev1alpha1.SecretRule{{Action: "Encrypt"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"metadata":   map[string]interface{}{"name": "db"},
+				"data": map[string]interface{}{
+					"username": base64.StdEncoding.EncodeToString([]byte("admin")),
+					"password": base64.StdEncoding.EncodeToString([]byte("hunter2")),
+				},
+			}}
+
+			h := &ResourceHandler{sharekubeName: "my-preview"}
+			h.SetSecretPolicy(&sharekubev1alpha1.SecretPolicy{Rules: tt.rules})
+			err := h.applySecretPolicy(obj, "preview")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applySecretPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			encoded, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+			data := map[string]string{}
+			for key, value := range encoded {
+				decoded, err := base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					t.Fatalf("data of key %s is not base64: %v", key, err)
+				}
+				data[key] = string(decoded)
+			}
+
+			for key, length := range tt.random {
+				if len(data[key]) != length || strings.Trim(data[key], "abc") != "" {
+					t.Errorf("random value of %s = %q, want %d characters from abc", key, data[key], length)
+				}
+			}
+			if tt.random != nil {
+				if want := "db-my-preview-preview:" + data["password"]; data["username"] != want {
+					t.Errorf("templated username = %q, want %q", data["username"], want)
+				}
+			} else if !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("data = %v, want %v", data, tt.want)
+			}
+
+			var actions map[string]string
+			if err := json.Unmarshal([]byte(obj.GetAnnotations()[SecretPolicyAnnotation]), &actions); err != nil {
+				t.Fatalf("invalid %s annotation: %v", SecretPolicyAnnotation, err)
+			}
+			if !reflect.DeepEqual(actions, tt.actions) {
+				t.Errorf("recorded actions = %v, want %v", actions, tt.actions)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package resources
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ServiceTypePreserve keeps the type of copied NodePort and LoadBalancer Services
+const ServiceTypePreserve = "Preserve"
+
+// SetServiceTypePolicy configures whether NodePort and LoadBalancer Services keep their type in the preview
+func (h *ResourceHandler) SetServiceTypePolicy(policy string) {
+	h.serviceTypePolicy = policy
+}
+
+// applyServiceTypePolicy converts NodePort and LoadBalancer Service copies to ClusterIP unless the type is preserved
+func (h *ResourceHandler) applyServiceTypePolicy(obj *unstructured.Unstructured) error {
+	if h.serviceTypePolicy == ServiceTypePreserve {
+		return nil
+	}
+	serviceType, _, err := unstructured.NestedString(obj.Object, "spec", "type")
+	if err != nil {
+		return err
+	}
+	if serviceType != "NodePort" && serviceType != "LoadBalancer" {
+		return nil
+	}
+
+	// Drop the fields the API server only accepts on NodePort and LoadBalancer Services
+	for _, field := range []string{"externalTrafficPolicy", "allocateLoadBalancerNodePorts", "loadBalancerClass", "loadBalancerSourceRanges"} {
+		unstructured.RemoveNestedField(obj.Object, "spec", field)
+	}
+	return unstructured.SetNestedField(obj.Object, "ClusterIP", "spec", "type")
+}
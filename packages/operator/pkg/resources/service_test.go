@@ -0,0 +1,84 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestApplyServiceTypePolicy(t *testing.T) {
+	loadBalancer := `
+spec:
+  type: LoadBalancer
+  externalTrafficPolicy: Local
+  allocateLoadBalancerNodePorts: true
+  loadBalancerClass: example.com/lb
+  loadBalancerSourceRanges: [10.0.0.0/8]
+  ports: [{port: 80}]`
+
+	tests := []struct {
+		name    string
+		policy  string
+		service string
+		want    string
+	}{
+		{
+			name:    "LoadBalancer becomes ClusterIP",
+			service: loadBalancer,
+			want: `
+spec: {type: ClusterIP, ports: [{port: 80}]}`,
+		},
+		{
+			name: "NodePort becomes ClusterIP",
+			service: `
+spec: {type: NodePort, externalTrafficPolicy: Cluster, ports: [{port: 80}]}`,
+			want: `
+spec: {type: ClusterIP, ports: [{port: 80}]}`,
+		},
+		{
+			name: "ClusterIP is kept",
+			service: `
+spec: {type: ClusterIP, ports: [{port: 80}]}`,
+			want: `
+spec: {type: ClusterIP, ports: [{port: 80}]}`,
+		},
+		{
+			name: "ExternalName is kept",
+			service: `
+spec: {type: ExternalName, externalName: db.example.com}`,
+			want: `
+spec: {type: ExternalName, externalName: db.example.com}`,
+		},
+		{
+			name:    "Preserve",
+			policy:  ServiceTypePreserve,
+			service: loadBalancer,
+			want:    loadBalancer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal([]byte(tt.service), &obj.Object); err != nil {
+				t.Fatal(err)
+			}
+			var want map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			h := &ResourceHandler{}
+			h.SetServiceTypePolicy(tt.policy)
+			if err := h.applyServiceTypePolicy(obj); err != nil {
+				t.Fatalf("applyServiceTypePolicy() error = %v", err)
+			}
+			if !reflect.DeepEqual(obj.Object, want) {
+				got, _ := yaml.Marshal(obj.Object)
+				t.Errorf("applyServiceTypePolicy() =\n%s", got)
+			}
+		})
+	}
+}
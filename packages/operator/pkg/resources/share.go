@@ -0,0 +1,68 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// ShareAnnotation lets source owners mark an object as never shareable or explicitly allowed
+	ShareAnnotation = "sharekube.dev/share"
+
+	// ShareWithAnnotation restricts sharing to target namespaces matching a comma-separated list of globs
+	ShareWithAnnotation = "sharekube.dev/share-with"
+
+	// ShareNever forbids copying the annotated object
+	ShareNever = "never"
+
+	// ShareAllowed explicitly opts the annotated object in to being copied
+	ShareAllowed = "allowed"
+)
+
+// ErrNotShareable is returned when a source object's annotations forbid copying it
+var ErrNotShareable = errors.New("resource is not shareable")
+
+// SetRequireShareOptIn configures whether source objects must opt in before they can be copied
+func (h *ResourceHandler) SetRequireShareOptIn(required bool) {
+	h.requireShareOptIn = required
+}
+
+// isShareable evaluates the share annotations of a source object against the target namespace
+func isShareable(annotations map[string]string, targetNamespace string, requireOptIn bool) error {
+	share := strings.TrimSpace(annotations[ShareAnnotation])
+	if share == ShareNever {
+		return fmt.Errorf("%w: annotated %s=%s", ErrNotShareable, ShareAnnotation, ShareNever)
+	}
+
+	if shareWith, ok := annotations[ShareWithAnnotation]; ok {
+		if !matchesNamespaceGlob(shareWith, targetNamespace) {
+			return fmt.Errorf("%w: target namespace %q does not match %s=%q",
+				ErrNotShareable, targetNamespace, ShareWithAnnotation, shareWith)
+		}
+		// A matching share-with annotation is an explicit opt-in
+		return nil
+	}
+
+	if requireOptIn && share != ShareAllowed {
+		return fmt.Errorf("%w: opt-in required, annotate with %s=%s or %s",
+			ErrNotShareable, ShareAnnotation, ShareAllowed, ShareWithAnnotation)
+	}
+
+	return nil
+}
+
+// matchesNamespaceGlob reports whether namespace matches any of the comma-separated glob patterns
+func matchesNamespaceGlob(patterns, namespace string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if matched, err := path.Match(pattern, namespace); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package resources
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsShareable(t *testing.T) {
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		target       string
+		requireOptIn bool
+		shareable    bool
+	}{
+		{
+			name:      "no annotations",
+			target:    "preview",
+			shareable: true,
+		},
+		{
+			name:         "no annotations with opt-in required",
+			target:       "preview",
+			requireOptIn: true,
+		},
+		{
+			name:        "never",
+			annotations: map[string]string{ShareAnnotation: ShareNever},
+			target:      "preview",
+		},
+		{
+			name:        "never wins over a matching share-with",
+			annotations: map[string]string{ShareAnnotation: " never ", ShareWithAnnotation: "*"},
+			target:      "preview",
+		},
+		{
+			name:         "allowed with opt-in required",
+			annotations:  map[string]string{ShareAnnotation: ShareAllowed},
+			target:       "preview",
+			requireOptIn: true,
+			shareable:    true,
+		},
+		{
+			name:         "matching share-with opts in",
+			annotations:  map[string]string{ShareWithAnnotation: "staging, preview-*"},
+			target:       "preview-42",
+			requireOptIn: true,
+			shareable:    true,
+		},
+		{
+			name:        "share-with not matching the target",
+			annotations: map[string]string{ShareAnnotation: ShareAllowed, ShareWithAnnotation: "preview-*"},
+			target:      "production",
+		},
+		{
+			name:        "empty share-with matches nothing",
+			annotations: map[string]string{ShareWithAnnotation: " , "},
+			target:      "preview",
+		},
+		{
+			name:        "invalid glob matches nothing",
+			annotations: map[string]string{ShareWithAnnotation: "preview-["},
+			target:      "preview-[",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := isShareable(tt.annotations, tt.target, tt.requireOptIn)
+			if tt.shareable && err != nil {
+				t.Errorf("isShareable() error = %v, want shareable", err)
+			}
+			if !tt.shareable && !errors.Is(err, ErrNotShareable) {
+				t.Errorf("isShareable() error = %v, want ErrNotShareable", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Transformer transforms the staged copies as a whole and returns the objects to write
+type Transformer func(ctx context.Context, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error)
+
+// SetTransformer makes CopyResource stage copies instead of writing them; Flush transforms and writes them
+func (h *ResourceHandler) SetTransformer(transformer Transformer) {
+	h.transformer = transformer
+}
+
+// Flush runs the transformer on the staged copies and writes the objects it returns to the target namespace.
+// Objects added by the transformer are written as well, and objects it drops are not.
+func (h *ResourceHandler) Flush(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	if h.transformer == nil || len(h.staged) == 0 {
+		return nil
+	}
+	staged := h.staged
+	h.staged = nil
+	targetNamespace := staged[0].GetNamespace()
+
+	objects, err := h.transformer(ctx, staged)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		// Transformations must not move objects out of the preview or drop the labels used for cleanup
+		obj.SetNamespace(targetNamespace)
+		h.addOwnershipLabels(obj)
+
+		gvr, err := getGVRForKind(obj.GetKind())
+		if err != nil {
+			return fmt.Errorf("cannot write transformed %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		err = h.createResource(ctx, gvr, obj)
+		if errors.Is(err, ErrConflictSkipped) {
+			logger.Info("Skipping transformed resource", "Kind", obj.GetKind(), "Name", obj.GetName(), "Reason", err.Error())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		logger.Info("Successfully copied transformed resource", "Kind", obj.GetKind(), "Name", obj.GetName())
+	}
+
+	return nil
+}
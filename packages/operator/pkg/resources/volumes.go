@@ -0,0 +1,223 @@
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// Volume copy modes of copied PersistentVolumeClaims
+const (
+	VolumeCopyEmpty    = "Empty"
+	VolumeCopySnapshot = "Snapshot"
+	VolumeCopyClone    = "Clone"
+)
+
+// ErrSnapshotPending is returned when a claim copy waits for the snapshot of its source to become ready
+var ErrSnapshotPending = errors.New("volume snapshot is not ready")
+
+var (
+	// VolumeSnapshotGVR is the resource of CSI VolumeSnapshots
+	VolumeSnapshotGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+	// VolumeSnapshotContentGVR is the resource of CSI VolumeSnapshotContents
+	VolumeSnapshotContentGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshotcontents"}
+)
+
+// SetVolumeCopy configures how copied PersistentVolumeClaims get their data
+func (h *ResourceHandler) SetVolumeCopy(volumeCopy *sharekubev1alpha1.VolumeCopy) {
+	h.volumeCopy = volumeCopy
+}
+
+// WithVolumeCopyMode overrides the volume copy mode for a copied PersistentVolumeClaim
+func WithVolumeCopyMode(mode string) CopyOption {
+	return func(o *copyOptions) {
+		o.volumeCopyMode = mode
+	}
+}
+
+// SnapshotName returns the name of the VolumeSnapshot a ShareKube takes of a source claim
+func SnapshotName(sharekubeName, claimName string) string {
+	name := fmt.Sprintf("sharekube-%s-%s", sharekubeName, claimName)
+	if len(name) <= 253 {
+		return name
+	}
+	return fmt.Sprintf("%s-%x", name[:236], sha256.Sum256([]byte(name)))[:253]
+}
+
+// prepareVolumeData points a claim copy at the data of its source claim according to the volume copy mode
+func (h *ResourceHandler) prepareVolumeData(ctx context.Context, obj *unstructured.Unstructured, claimName, sourceNamespace, targetNamespace string, options copyOptions) error {
+	mode := options.volumeCopyMode
+	if mode == "" && h.volumeCopy != nil {
+		mode = h.volumeCopy.Mode
+	}
+
+	// Data sources of the source claim live in the source namespace
+	if sourceNamespace != targetNamespace {
+		unstructured.RemoveNestedField(obj.Object, "spec", "dataSource")
+		unstructured.RemoveNestedField(obj.Object, "spec", "dataSourceRef")
+	}
+
+	switch mode {
+	case "", VolumeCopyEmpty:
+		return nil
+	case VolumeCopyClone:
+		// CSI cloning only works within a namespace
+		if sourceNamespace == targetNamespace {
+			return setDataSource(obj, "", "PersistentVolumeClaim", claimName)
+		}
+		log.FromContext(ctx).Info("Cloning across namespaces is not supported, restoring from a snapshot instead",
+			"Name", claimName, "From", sourceNamespace, "To", targetNamespace)
+		fallthrough
+	case VolumeCopySnapshot:
+		snapshotName, err := h.ensureSnapshot(ctx, claimName, sourceNamespace, targetNamespace)
+		if err != nil {
+			return err
+		}
+		return setDataSource(obj, VolumeSnapshotGVR.Group, "VolumeSnapshot", snapshotName)
+	}
+	return fmt.Errorf("unknown volume copy mode %q", mode)
+}
+
+// ensureSnapshot snapshots the source claim and makes the snapshot available in the target namespace.
+// It returns ErrSnapshotPending until the snapshot is ready to use.
+func (h *ResourceHandler) ensureSnapshot(ctx context.Context, claimName, sourceNamespace, targetNamespace string) (string, error) {
+	logger := log.FromContext(ctx)
+	name := SnapshotName(h.sharekubeName, claimName)
+
+	snapshot, err := h.dynClient.Resource(VolumeSnapshotGVR).Namespace(sourceNamespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		snapshot = &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": VolumeSnapshotGVR.GroupVersion().String(),
+			"kind":       "VolumeSnapshot",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": sourceNamespace,
+			},
+			"spec": map[string]interface{}{
+				"source": map[string]interface{}{
+					"persistentVolumeClaimName": claimName,
+				},
+			},
+		}}
+		if h.volumeCopy != nil && h.volumeCopy.VolumeSnapshotClassName != "" {
+			if err := unstructured.SetNestedField(snapshot.Object, h.volumeCopy.VolumeSnapshotClassName, "spec", "volumeSnapshotClassName"); err != nil {
+				return "", err
+			}
+		}
+		h.addOwnershipLabels(snapshot)
+		if _, err := h.dynClient.Resource(VolumeSnapshotGVR).Namespace(sourceNamespace).Create(ctx, snapshot, metav1.CreateOptions{}); err != nil {
+			logger.Error(err, "Failed to create VolumeSnapshot", "Name", name, "Namespace", sourceNamespace)
+			return "", err
+		}
+		logger.Info("Created VolumeSnapshot", "Name", name, "Namespace", sourceNamespace)
+		return name, fmt.Errorf("%w: %s/%s was just created", ErrSnapshotPending, sourceNamespace, name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found && message != "" {
+		return name, fmt.Errorf("VolumeSnapshot %s/%s failed: %s", sourceNamespace, name, message)
+	}
+	ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	contentName, _, _ := unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+	if !ready || contentName == "" {
+		return name, fmt.Errorf("%w: %s/%s is not ready to use", ErrSnapshotPending, sourceNamespace, name)
+	}
+
+	if sourceNamespace == targetNamespace {
+		return name, nil
+	}
+	return name, h.importSnapshot(ctx, name, contentName, targetNamespace)
+}
+
+// importSnapshot binds a pre-provisioned VolumeSnapshotContent pointing at the source snapshot's data
+// to a VolumeSnapshot of the same name in the target namespace, because claims can only be restored
+// from snapshots in their own namespace
+func (h *ResourceHandler) importSnapshot(ctx context.Context, name, sourceContentName, targetNamespace string) error {
+	logger := log.FromContext(ctx)
+
+	sourceContent, err := h.dynClient.Resource(VolumeSnapshotContentGVR).Get(ctx, sourceContentName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	snapshotHandle, _, _ := unstructured.NestedString(sourceContent.Object, "status", "snapshotHandle")
+	driver, _, _ := unstructured.NestedString(sourceContent.Object, "spec", "driver")
+	if snapshotHandle == "" || driver == "" {
+		return fmt.Errorf("%w: VolumeSnapshotContent %s has no snapshot handle yet", ErrSnapshotPending, sourceContentName)
+	}
+
+	contentName := SnapshotName(h.sharekubeName+"-"+targetNamespace, name)
+	content := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": VolumeSnapshotContentGVR.GroupVersion().String(),
+		"kind":       "VolumeSnapshotContent",
+		"metadata": map[string]interface{}{
+			"name": contentName,
+		},
+		"spec": map[string]interface{}{
+			// The source snapshot owns the data, deleting the imported one must not delete it
+			"deletionPolicy": "Retain",
+			"driver":         driver,
+			"source": map[string]interface{}{
+				"snapshotHandle": snapshotHandle,
+			},
+			"volumeSnapshotRef": map[string]interface{}{
+				"name":      name,
+				"namespace": targetNamespace,
+			},
+		},
+	}}
+	if className, found, _ := unstructured.NestedString(sourceContent.Object, "spec", "volumeSnapshotClassName"); found && className != "" {
+		if err := unstructured.SetNestedField(content.Object, className, "spec", "volumeSnapshotClassName"); err != nil {
+			return err
+		}
+	}
+	h.addOwnershipLabels(content)
+	if _, err := h.dynClient.Resource(VolumeSnapshotContentGVR).Create(ctx, content, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		logger.Error(err, "Failed to create VolumeSnapshotContent", "Name", contentName)
+		return err
+	}
+
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": VolumeSnapshotGVR.GroupVersion().String(),
+		"kind":       "VolumeSnapshot",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": targetNamespace,
+		},
+		"spec": map[string]interface{}{
+			"source": map[string]interface{}{
+				"volumeSnapshotContentName": contentName,
+			},
+		},
+	}}
+	h.addOwnershipLabels(snapshot)
+	if _, err := h.dynClient.Resource(VolumeSnapshotGVR).Namespace(targetNamespace).Create(ctx, snapshot, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		logger.Error(err, "Failed to create VolumeSnapshot", "Name", name, "Namespace", targetNamespace)
+		return err
+	}
+	return nil
+}
+
+// setDataSource makes a claim copy restore its data from the given object
+func setDataSource(obj *unstructured.Unstructured, apiGroup, kind, name string) error {
+	dataSource := map[string]interface{}{
+		"kind": kind,
+		"name": name,
+	}
+	if apiGroup != "" {
+		dataSource["apiGroup"] = apiGroup
+	}
+	// The API server mirrors dataSource into dataSourceRef, and a stale one would conflict
+	unstructured.RemoveNestedField(obj.Object, "spec", "dataSourceRef")
+	return unstructured.SetNestedMap(obj.Object, dataSource, "spec", "dataSource")
+}
@@ -0,0 +1,164 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestSnapshotName(t *testing.T) {
+	long := strings.Repeat("a", 250)
+
+	tests := []struct {
+		name    string
+		claim   string
+		want    string
+		wantLen int
+		differs string
+	}{
+		{name: "short claim", claim: "data", want: "sharekube-my-preview-data"},
+		{name: "long claim is truncated", claim: long, wantLen: 253},
+		{name: "long claims stay distinct", claim: long, differs: long + "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SnapshotName("my-preview", tt.claim)
+			if tt.want != "" && got != tt.want {
+				t.Errorf("SnapshotName() = %q, want %q", got, tt.want)
+			}
+			if tt.wantLen != 0 && len(got) != tt.wantLen {
+				t.Errorf("SnapshotName() has %d characters, want %d", len(got), tt.wantLen)
+			}
+			if tt.differs != "" && SnapshotName("my-preview", tt.differs) == got {
+				t.Error("SnapshotName() returned the same name for different long claims")
+			}
+		})
+	}
+}
+
+func TestPrepareVolumeData(t *testing.T) {
+	snapshot := func(namespace string, status map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshot",
+			"metadata":   map[string]interface{}{"name": "sharekube-my-preview-data", "namespace": namespace},
+			"status":     status,
+		}}
+	}
+	ready := map[string]interface{}{"readyToUse": true, "boundVolumeSnapshotContentName": "content-1"}
+
+	tests := []struct {
+		name       string
+		mode       string
+		target     string
+		existing   []runtime.Object
+		dataSource map[string]interface{}
+		pending    bool
+		wantErr    bool
+	}{
+		{
+			name:   "empty drops the data source of the source claim",
+			mode:   VolumeCopyEmpty,
+			target: "preview",
+		},
+		{
+			name:       "clone within the namespace",
+			mode:       VolumeCopyClone,
+			target:     "dev",
+			dataSource: map[string]interface{}{"kind": "PersistentVolumeClaim", "name": "data"},
+		},
+		{
+			name:    "snapshot is taken first",
+			mode:    VolumeCopySnapshot,
+			target:  "dev",
+			pending: true,
+		},
+		{
+			name:     "snapshot not ready yet",
+			mode:     VolumeCopySnapshot,
+			target:   "dev",
+			existing: []runtime.Object{snapshot("dev", map[string]interface{}{"readyToUse": false})},
+			pending:  true,
+		},
+		{
+			name:       "ready snapshot within the namespace",
+			mode:       VolumeCopySnapshot,
+			target:     "dev",
+			existing:   []runtime.Object{snapshot("dev", ready)},
+			dataSource: map[string]interface{}{"apiGroup": "snapshot.storage.k8s.io", "kind": "VolumeSnapshot", "name": "sharekube-my-preview-data"},
+		},
+		{
+			name:     "failed snapshot",
+			mode:     VolumeCopySnapshot,
+			target:   "dev",
+			existing: []runtime.Object{snapshot("dev", map[string]interface{}{"error": map[string]interface{}{"message": "no space"}})},
+			wantErr:  true,
+		},
+		{
+			name:     "clone across namespaces restores from a snapshot",
+			mode:     VolumeCopyClone,
+			target:   "preview",
+			existing: []runtime.Object{snapshot("dev", map[string]interface{}{"readyToUse": false})},
+			pending:  true,
+		},
+		{
+			name:    "unknown mode",
+			mode:    "Rsync",
+			target:  "preview",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "PersistentVolumeClaim",
+				"metadata":   map[string]interface{}{"name": "data", "namespace": tt.target},
+				"spec": map[string]interface{}{
+					"dataSource":    map[string]interface{}{"kind": "VolumeSnapshot", "name": "nightly"},
+					"dataSourceRef": map[string]interface{}{"kind": "VolumeSnapshot", "name": "nightly"},
+				},
+			}}
+			dynClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), tt.existing...)
+			h := NewResourceHandler(nil, dynClient, runtime.NewScheme(), metav1.OwnerReference{}, "my-preview", "ci")
+
+			err := h.prepareVolumeData(context.Background(), claim, "data", "dev", tt.target, copyOptions{volumeCopyMode: tt.mode})
+			if pending := errors.Is(err, ErrSnapshotPending); pending != tt.pending {
+				t.Fatalf("prepareVolumeData() error = %v, want pending %v", err, tt.pending)
+			}
+			if tt.pending {
+				if _, err := dynClient.Resource(VolumeSnapshotGVR).Namespace("dev").Get(context.Background(), "sharekube-my-preview-data", metav1.GetOptions{}); err != nil {
+					t.Errorf("source snapshot was not created: %v", err)
+				}
+				return
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prepareVolumeData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			dataSource, _, _ := unstructured.NestedMap(claim.Object, "spec", "dataSource")
+			if len(dataSource) != len(tt.dataSource) {
+				t.Fatalf("dataSource = %v, want %v", dataSource, tt.dataSource)
+			}
+			for key, value := range tt.dataSource {
+				if dataSource[key] != value {
+					t.Errorf("dataSource.%s = %v, want %v", key, dataSource[key], value)
+				}
+			}
+			if _, found, _ := unstructured.NestedMap(claim.Object, "spec", "dataSourceRef"); found {
+				t.Error("dataSourceRef was kept")
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+	"github.com/miloszsobczak/sharekube/packages/operator/pkg/resources"
+)
+
+//+kubebuilder:webhook:path=/mutate-sharekube-dev-v1alpha1-sharekube,mutating=true,failurePolicy=fail,sideEffects=None,groups=sharekube.dev,resources=sharekubes,verbs=create,versions=v1alpha1,name=msharekube.sharekube.dev,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-sharekube-dev-v1alpha1-sharekube,mutating=false,failurePolicy=fail,sideEffects=None,groups=sharekube.dev,resources=sharekubes,verbs=create;update,versions=v1alpha1,name=vsharekube.sharekube.dev,admissionReviewVersions=v1
+
+// ShareKubeWebhook records who creates ShareKubes and rejects ShareKubes that would only fail once reconciled
+type ShareKubeWebhook struct{}
+
+// SetupWithManager registers the mutating and validating webhooks for ShareKubes with the manager's webhook server
+func (w *ShareKubeWebhook) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&sharekubev1alpha1.ShareKube{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+// Default records the requesting user as the creator of a new ShareKube
+func (w *ShareKubeWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	sharekube, ok := obj.(*sharekubev1alpha1.ShareKube)
+	if !ok {
+		return fmt.Errorf("expected a ShareKube but got %T", obj)
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if req.Operation != admissionv1.Create {
+		return nil
+	}
+	if _, ok := sharekube.Annotations[sharekubev1alpha1.CreatorAnnotation]; !ok {
+		if sharekube.Annotations == nil {
+			sharekube.Annotations = make(map[string]string)
+		}
+		sharekube.Annotations[sharekubev1alpha1.CreatorAnnotation] = req.UserInfo.Username
+	}
+	return nil
+}
+
+// ValidateCreate validates a new ShareKube
+func (w *ShareKubeWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	sharekube, ok := obj.(*sharekubev1alpha1.ShareKube)
+	if !ok {
+		return nil, fmt.Errorf("expected a ShareKube but got %T", obj)
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs field.ErrorList
+	if creator := sharekube.Annotations[sharekubev1alpha1.CreatorAnnotation]; creator != req.UserInfo.Username {
+		errs = append(errs, field.Forbidden(creatorPath(), fmt.Sprintf("must name the requesting user %q", req.UserInfo.Username)))
+	}
+	errs = append(errs, validateSpec(sharekube)...)
+	return nil, invalid(sharekube, errs)
+}
+
+// ValidateUpdate validates a changed ShareKube
+func (w *ShareKubeWebhook) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldSharekube, ok := oldObj.(*sharekubev1alpha1.ShareKube)
+	if !ok {
+		return nil, fmt.Errorf("expected a ShareKube but got %T", oldObj)
+	}
+	sharekube, ok := newObj.(*sharekubev1alpha1.ShareKube)
+	if !ok {
+		return nil, fmt.Errorf("expected a ShareKube but got %T", newObj)
+	}
+
+	var errs field.ErrorList
+	if sharekube.Annotations[sharekubev1alpha1.CreatorAnnotation] != oldSharekube.Annotations[sharekubev1alpha1.CreatorAnnotation] {
+		errs = append(errs, field.Forbidden(creatorPath(), "is immutable"))
+	}
+	errs = append(errs, validateSpec(sharekube)...)
+	return nil, invalid(sharekube, errs)
+}
+
+// ValidateDelete allows every deletion
+func (w *ShareKubeWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateSpec rejects durations the controller could not parse, CEL expressions that do not compile
+// and invalid patterns of the ConfigMap policy
+func validateSpec(sharekube *sharekubev1alpha1.ShareKube) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	errs = append(errs, resources.ValidateTransformationRules(sharekube.Spec.TransformationRules, specPath.Child("transformationRules"))...)
+	errs = append(errs, resources.ValidateConfigMapPolicy(sharekube.Spec.ConfigMapPolicy, specPath.Child("configMapPolicy"))...)
+	if _, err := time.ParseDuration(sharekube.Spec.TTL); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("ttl"), sharekube.Spec.TTL, err.Error()))
+	}
+	if sharekube.Spec.IdleTimeout != "" {
+		if _, err := time.ParseDuration(sharekube.Spec.IdleTimeout); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("idleTimeout"), sharekube.Spec.IdleTimeout, err.Error()))
+		}
+	}
+	if sharekube.Spec.ReadinessTimeout != "" {
+		if _, err := time.ParseDuration(sharekube.Spec.ReadinessTimeout); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("readinessTimeout"), sharekube.Spec.ReadinessTimeout, err.Error()))
+		}
+	}
+	return errs
+}
+
+// creatorPath returns the field path of the creator annotation
+func creatorPath() *field.Path {
+	return field.NewPath("metadata", "annotations").Key(sharekubev1alpha1.CreatorAnnotation)
+}
+
+// invalid returns the Invalid error reporting the errors of a ShareKube, or nil without errors
+func invalid(sharekube *sharekubev1alpha1.ShareKube, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(sharekubev1alpha1.GroupVersion.WithKind("ShareKube").GroupKind(), sharekube.Name, errs)
+}
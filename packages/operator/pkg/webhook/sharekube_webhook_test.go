@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	sharekubev1alpha1 "github.com/miloszsobczak/sharekube/packages/operator/api/v1alpha1"
+)
+
+// requestContext returns a context carrying an admission request of the user
+func requestContext(operation admissionv1.Operation, username string) context.Context {
+	return admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: operation,
+		UserInfo:  authenticationv1.UserInfo{Username: username},
+	}})
+}
+
+// withCreator returns a ShareKube annotated with the creator, or without the annotation if it is empty
+func withCreator(creator string) *sharekubev1alpha1.ShareKube {
+	sk := &sharekubev1alpha1.ShareKube{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-preview", Namespace: "dev"},
+		Spec:       sharekubev1alpha1.ShareKubeSpec{TTL: "24h"},
+	}
+	if creator != "" {
+		sk.Annotations = map[string]string{sharekubev1alpha1.CreatorAnnotation: creator}
+	}
+	return sk
+}
+
+func TestDefault(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation admissionv1.Operation
+		creator   string
+		want      string
+	}{
+		{name: "records the creator", operation: admissionv1.Create, want: "alice"},
+		{name: "keeps a supplied creator for validation", operation: admissionv1.Create, creator: "bob", want: "bob"},
+		{name: "leaves updates alone", operation: admissionv1.Update},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := withCreator(tt.creator)
+			if err := (&ShareKubeWebhook{}).Default(requestContext(tt.operation, "alice"), sk); err != nil {
+				t.Fatalf("Default() error = %v", err)
+			}
+			if got := sk.Annotations[sharekubev1alpha1.CreatorAnnotation]; got != tt.want {
+				t.Errorf("creator = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCreator(t *testing.T) {
+	tests := []struct {
+		name       string
+		oldCreator string
+		creator    string
+		update     bool
+		wantErr    bool
+	}{
+		{name: "created by the requesting user", creator: "alice"},
+		{name: "created naming another user", creator: "bob", wantErr: true},
+		{name: "created without a creator", wantErr: true},
+		{name: "updated keeping the creator", update: true, oldCreator: "bob", creator: "bob"},
+		{name: "updated changing the creator", update: true, oldCreator: "bob", creator: "alice", wantErr: true},
+		{name: "updated removing the creator", update: true, oldCreator: "bob", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &ShareKubeWebhook{}
+			var err error
+			if tt.update {
+				_, err = w.ValidateUpdate(requestContext(admissionv1.Update, "alice"), withCreator(tt.oldCreator), withCreator(tt.creator))
+			} else {
+				_, err = w.ValidateCreate(requestContext(admissionv1.Create, "alice"), withCreator(tt.creator))
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	tests := []struct {
+		name             string
+		ttl              string
+		idleTimeout      string
+		readinessTimeout string
+		rules            []sharekubev1alpha1.TransformationRule
+		policy           *sharekubev1alpha1.ConfigMapPolicy
+		wantErr          bool
+	}{
+		{name: "TTL only", ttl: "24h"},
+		{name: "TTL and idle timeout", ttl: "24h", idleTimeout: "2h"},
+		{name: "missing TTL", wantErr: true},
+		{name: "invalid TTL", ttl: "forever", wantErr: true},
+		{name: "invalid idle timeout", ttl: "24h", idleTimeout: "a while", wantErr: true},
+		{name: "invalid readiness timeout", ttl: "24h", readinessTimeout: "soon", wantErr: true},
+		{name: "valid CEL filter", ttl: "24h", rules: []sharekubev1alpha1.TransformationRule{{Kind: "Deployment", Filter: "object.metadata.name == 'api'"}}},
+		{name: "invalid CEL filter", ttl: "24h", rules: []sharekubev1alpha1.TransformationRule{{Kind: "Deployment", Filter: "object.metadata.name =="}}, wantErr: true},
+		{name: "invalid ConfigMap pattern", ttl: "24h", policy: &sharekubev1alpha1.ConfigMapPolicy{Rules: []sharekubev1alpha1.ConfigMapRule{{
+			Replacements: []sharekubev1alpha1.RegexReplacement{{Pattern: "(unclosed", Replacement: "x"}},
+		}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &ShareKubeWebhook{}
+			sk := withCreator("alice")
+			sk.Spec.TTL = tt.ttl
+			sk.Spec.IdleTimeout = tt.idleTimeout
+			sk.Spec.ReadinessTimeout = tt.readinessTimeout
+			sk.Spec.TransformationRules = tt.rules
+			sk.Spec.ConfigMapPolicy = tt.policy
+
+			if _, err := w.ValidateCreate(requestContext(admissionv1.Create, "alice"), sk); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := w.ValidateUpdate(requestContext(admissionv1.Update, "alice"), withCreator("alice"), sk); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}